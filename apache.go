@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"net"
+	"strings"
+)
+
+const (
+	// Timestamp layout of the Common Log Format, e.g. 10/Oct/2000:13:55:36 -0700
+	apacheTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// Escapes quoted CLF fields, as Apache does.
+var apacheQuoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// ApacheFormatter formats HTTP request events as Apache access log lines, in the Common
+// Log Format (CLF), or the Combined Log Format, which adds the referer and user agent.
+// It reads the params set by (*Log).HTTPRequest: remote_addr, method, path, proto, status,
+// referer, user_agent, and the optional params "user" and "bytes". Missing values are "-".
+//
+// Example (Combined):
+//      127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://x/" "Mozilla/4.08"
+type ApacheFormatter struct {
+	name     string
+	combined bool
+}
+
+// Create a new Apache access log formatter. If combined is true, the Combined Log Format is
+// used, else the Common Log Format.
+// Returns an EventFormatter interface.
+func Apache(combined bool) EventFormatter {
+	af := &ApacheFormatter{name: "apache_common", combined: combined}
+	if combined {
+		af.name = "apache_combined"
+	}
+	return af
+}
+
+// Returns the name of the formatter
+func (af *ApacheFormatter) Name() string {
+	return af.name
+}
+
+// Implements EventFormatter interface.
+func (af *ApacheFormatter) Format(em EventMsg) (msg string, err error) {
+	p := em.Params
+	host := p["remote_addr"]
+	if h, _, sErr := net.SplitHostPort(host); sErr == nil {
+		host = h
+	}
+	request := strings.Join([]string{
+		apacheField(p["method"]), apacheField(p["path"]), apacheField(p["proto"]),
+	}, " ")
+
+	msg = strings.Join([]string{
+		apacheField(host),
+		"-",
+		apacheField(p["user"]),
+		"[" + em.Timestamp.Format(apacheTimeFormat) + "]",
+		apacheQuote(request),
+		apacheField(p["status"]),
+		apacheField(p["bytes"]),
+	}, " ")
+	if af.combined {
+		msg += " " + apacheQuote(apacheField(p["referer"])) + " " + apacheQuote(apacheField(p["user_agent"]))
+	}
+	return
+}
+
+// Returns "-" for an empty value.
+func apacheField(v string) string {
+	if len(v) == 0 {
+		return "-"
+	}
+	return v
+}
+
+func apacheQuote(v string) string {
+	return `"` + apacheQuoteReplacer.Replace(v) + `"`
+}
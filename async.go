@@ -0,0 +1,277 @@
+// Async Logging
+// In async mode, LogEvent formats each event in the caller's goroutine, and queues the output
+// for a background goroutine, which writes it to the modules. A slow writer does not stall
+// the caller, unless the queue is full and the overflow policy is OverflowBlock.
+//
+// Flush blocks until the queued messages are written, and Barrier until the messages queued
+// before it are written, e.g. in a test. Close drains the queue, and stops the background
+// goroutine, before closing the modules.
+//
+// Example:
+//
+//	l := logger.LogManger("MyApp", f)
+//	l.AsyncBuffer(1024, logger.OverflowDropOldest)
+//	defer l.Close()
+package logger
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// The behavior of LogEvent when the async queue is full
+type OverflowPolicy int
+
+const (
+	// Wait for space in the queue. No messages are lost.
+	OverflowBlock OverflowPolicy = iota
+	// Drop the oldest queued message to make space.
+	OverflowDropOldest
+	// Drop the new message.
+	OverflowDropNewest
+)
+
+var overflowPolicyName = []string{"block", "drop-oldest", "drop-newest"}
+
+// Returns the string representation of the overflow policy, e.g. "OverflowPolicy(99)" if it is
+// not valid.
+func (op OverflowPolicy) String() string {
+	if op < OverflowBlock || int(op) >= len(overflowPolicyName) {
+		return "OverflowPolicy(" + strconv.Itoa(int(op)) + ")"
+	}
+	return overflowPolicyName[op]
+}
+
+// A formatted message queued for a module, or a barrier.
+type asyncWrite struct {
+	w       LogWriter
+	sev     Severity
+	msg     []byte
+	handler func(w LogWriter, err error) // The error handler of the Log
+	// Closed when the background goroutine reaches it. Never dropped. See Barrier.
+	barrier chan struct{}
+}
+
+// The queue and background writer of a Log in async mode.
+type asyncQueue struct {
+	ch      chan asyncWrite
+	policy  OverflowPolicy
+	dropped uint64
+	// Held for reading while sending, so the channel is not closed during a send.
+	closeMu sync.RWMutex
+	closed  bool
+	// Count of queued messages not yet written or dropped. Signals drained at zero.
+	mu      sync.Mutex
+	pending int
+	drained *sync.Cond
+	// The goroutine id of the background goroutine. Guarded by mu.
+	writerID string
+	done     chan struct{}
+}
+
+// Start async mode, with a queue of size messages, and the overflow policy when it is full.
+// Returns InvalidArgumentError if size is less than 1, the policy is invalid, or the Log is
+// already in async mode.
+// This is goroutine safe.
+func (l *Log) AsyncBuffer(size int, policy OverflowPolicy) error {
+	if size < 1 || policy < OverflowBlock || policy > OverflowDropNewest {
+		return InvalidArgumentError
+	}
+	l.modulesMu.Lock()
+	defer l.modulesMu.Unlock()
+	if l.getAsync() != nil {
+		return InvalidArgumentError
+	}
+	aq := &asyncQueue{
+		ch:     make(chan asyncWrite, size),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	aq.drained = sync.NewCond(&aq.mu)
+	go aq.run()
+	l.async.Store(aq)
+	return nil
+}
+
+// Returns the async queue, or nil if the Log is not in async mode.
+func (l *Log) getAsync() *asyncQueue {
+	aq, _ := l.async.Load().(*asyncQueue)
+	return aq
+}
+
+// Returns the number of messages dropped because the async queue was full.
+func (l *Log) AsyncDropped() uint64 {
+	aq := l.getAsync()
+	if aq == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&aq.dropped)
+}
+
+// Block until the messages queued before the call are written or dropped, e.g. in a test, to
+// assert the output of an async Log without sleeping. Unlike Flush, messages queued during the
+// wait are not waited for, and the modules are not flushed.
+// Returns immediately if the Log is not in async mode, or is closed, or if called from a module's
+// Write, i.e. the background goroutine, which would wait for itself.
+// This is goroutine safe.
+func (l *Log) Barrier() {
+	if aq := l.getAsync(); aq != nil {
+		aq.barrier()
+	}
+}
+
+// Write queued messages until the queue is closed.
+func (aq *asyncQueue) run() {
+	defer close(aq.done)
+	aq.mu.Lock()
+	aq.writerID = goroutineID()
+	aq.mu.Unlock()
+	for aw := range aq.ch {
+		if aw.barrier != nil {
+			close(aw.barrier)
+			continue
+		}
+		writeModule(aw.w, aw.sev, aw.msg, aw.handler)
+		aq.complete()
+	}
+}
+
+// Queue a message for w, applying the overflow policy if the queue is full.
+// If the write fails, the handler, if any, is called from the background goroutine.
+// Messages queued after the queue is closed are dropped.
+func (aq *asyncQueue) enqueue(w LogWriter, sev Severity, msg []byte, handler func(w LogWriter, err error)) {
+	aq.closeMu.RLock()
+	defer aq.closeMu.RUnlock()
+	if aq.closed {
+		return
+	}
+
+	aq.mu.Lock()
+	aq.pending++
+	aq.mu.Unlock()
+
+	aw := asyncWrite{w: w, sev: sev, msg: msg, handler: handler}
+	switch aq.policy {
+	case OverflowDropNewest:
+		select {
+		case aq.ch <- aw:
+		default:
+			aq.drop()
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case aq.ch <- aw:
+				return
+			default:
+			}
+			select {
+			case old := <-aq.ch:
+				if old.barrier == nil {
+					aq.drop()
+				} else if !aq.skipBarrier(old) {
+					// The queue holds only barriers, so the new message is dropped.
+					aq.drop()
+					return
+				}
+			default:
+			}
+		}
+	default:
+		aq.ch <- aw
+	}
+}
+
+// Make room past a barrier b taken from the queue, by dropping the oldest message after it, and
+// queue b, and any barriers before that message, again. A barrier is only released by run, once
+// the messages before it are written, since a message taken by run may still be being written.
+// Returns false if there is no message to drop, i.e. the queue holds only barriers.
+func (aq *asyncQueue) skipBarrier(b asyncWrite) (dropped bool) {
+	held := []asyncWrite{b}
+	for !dropped {
+		select {
+		case old := <-aq.ch:
+			if old.barrier != nil {
+				held = append(held, old)
+				continue
+			}
+			aq.drop()
+			dropped = true
+			continue
+		default:
+		}
+		break
+	}
+	// There is room for them, unless another caller filled it, in which case this waits for run.
+	for _, h := range held {
+		aq.ch <- h
+	}
+	return dropped
+}
+
+func (aq *asyncQueue) drop() {
+	atomic.AddUint64(&aq.dropped, 1)
+	aq.complete()
+}
+
+// Mark a queued message written or dropped.
+func (aq *asyncQueue) complete() {
+	aq.mu.Lock()
+	defer aq.mu.Unlock()
+	aq.pending--
+	if aq.pending == 0 {
+		aq.drained.Broadcast()
+	}
+}
+
+// Block until the queued messages are written or dropped.
+// Returns immediately if called from a module's Write, which would wait for itself.
+func (aq *asyncQueue) flush() {
+	if aq.onWriter() {
+		return
+	}
+	aq.mu.Lock()
+	defer aq.mu.Unlock()
+	for aq.pending > 0 {
+		aq.drained.Wait()
+	}
+}
+
+// Queue a barrier, and block until it is reached. The barrier is not counted as pending.
+// A barrier is queued even if the queue is full, regardless of the overflow policy.
+func (aq *asyncQueue) barrier() {
+	if aq.onWriter() {
+		return
+	}
+	done := make(chan struct{})
+	aq.closeMu.RLock()
+	if aq.closed {
+		aq.closeMu.RUnlock()
+		return
+	}
+	aq.ch <- asyncWrite{barrier: done}
+	aq.closeMu.RUnlock()
+	<-done
+}
+
+// Returns true if the caller is the background goroutine, e.g. a module's Write.
+func (aq *asyncQueue) onWriter() bool {
+	aq.mu.Lock()
+	id := aq.writerID
+	aq.mu.Unlock()
+	return id != "" && id == goroutineID()
+}
+
+// Drain the queue, and stop the background goroutine. Later messages are dropped.
+func (aq *asyncQueue) close() {
+	aq.closeMu.Lock()
+	if aq.closed {
+		aq.closeMu.Unlock()
+		return
+	}
+	aq.closed = true
+	close(aq.ch)
+	aq.closeMu.Unlock()
+	<-aq.done
+}
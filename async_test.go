@@ -0,0 +1,231 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+// A testWriter that blocks each Write until released, and signals when a Write starts.
+type gateWriter struct {
+	testWriter
+	writing chan struct{}
+	release chan struct{}
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{writing: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (gw *gateWriter) Write(p []byte) (int, error) {
+	gw.writing <- struct{}{}
+	<-gw.release
+	return gw.testWriter.Write(p)
+}
+
+func TestLog_AsyncBuffer(t *testing.T) {
+	testName := "TestLog_AsyncBuffer"
+	gw := newGateWriter()
+	l := LogManger(testName, gw)
+	l.SetFormatter(&spyFormatter{})
+	gotestutil.AssertNil(t, l.AsyncBuffer(10, OverflowBlock), GetCaller()+" Expected async mode")
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.AsyncBuffer(10, OverflowBlock),
+		GetCaller()+" Expected an error when already async")
+
+	// The caller is not stalled by the blocked writer.
+	for i := 1; i <= 3; i++ {
+		l.Info(testName, fmt.Sprintf("msg %d", i), nil)
+	}
+	<-gw.writing
+	gotestutil.AssertEqual(t, 0, len(gw.Lines()), GetCaller()+" Expected no lines written yet")
+
+	close(gw.release)
+	l.Flush()
+	gotestutil.AssertEqual(t, []string{"msg 1", "msg 2", "msg 3"}, gw.Lines(), GetCaller()+" Expected all lines after Flush")
+
+	l.Info(testName, "msg 4", nil)
+	l.Close()
+	gotestutil.AssertEqual(t, 4, len(gw.Lines()), GetCaller()+" Expected the queue drained by Close")
+	l.Info(testName, "after close", nil)
+	gotestutil.AssertEqual(t, 4, len(gw.Lines()), GetCaller()+" Expected no lines after Close")
+}
+
+func TestLog_AsyncBufferOverflow(t *testing.T) {
+	testName := "TestLog_AsyncBufferOverflow"
+	tests := []struct {
+		policy   OverflowPolicy
+		expected []string
+	}{
+		{OverflowDropNewest, []string{"msg 1", "msg 2"}},
+		{OverflowDropOldest, []string{"msg 1", "msg 4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			gw := newGateWriter()
+			l := LogManger(testName, gw)
+			l.SetFormatter(&spyFormatter{})
+			gotestutil.AssertNil(t, l.AsyncBuffer(1, tt.policy), GetCaller()+" Expected async mode")
+
+			// The first message is being written, and the second fills the queue.
+			l.Info(testName, "msg 1", nil)
+			<-gw.writing
+			for i := 2; i <= 4; i++ {
+				l.Info(testName, fmt.Sprintf("msg %d", i), nil)
+			}
+			close(gw.release)
+			l.Close()
+
+			gotestutil.AssertEqual(t, tt.expected, gw.Lines(), GetCaller()+" Expected lines")
+			gotestutil.AssertEqual(t, uint64(2), l.AsyncDropped(), GetCaller()+" Expected dropped messages")
+		})
+	}
+}
+
+func TestLog_Barrier(t *testing.T) {
+	testName := "TestLog_Barrier"
+	gw := newGateWriter()
+	l := LogManger(testName, gw)
+	l.SetFormatter(&spyFormatter{})
+	l.Barrier()
+	gotestutil.AssertNil(t, l.AsyncBuffer(10, OverflowBlock), GetCaller()+" Expected async mode")
+	defer l.Close()
+
+	for i := 1; i <= 3; i++ {
+		l.Info(testName, fmt.Sprintf("msg %d", i), nil)
+	}
+	<-gw.writing
+	returned := make(chan struct{})
+	go func() {
+		l.Barrier()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+		t.Fatalf("%s Expected Barrier to wait for the queued messages", GetCaller())
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(gw.release)
+	<-returned
+	gotestutil.AssertEqual(t, []string{"msg 1", "msg 2", "msg 3"}, gw.Lines(), GetCaller()+" Expected all lines after Barrier")
+}
+
+// A testWriter that calls Barrier and Flush from its Write, i.e. the background goroutine.
+type barrierWriter struct {
+	testWriter
+	l *Log
+}
+
+func (bw *barrierWriter) Write(p []byte) (int, error) {
+	bw.l.Barrier()
+	bw.l.Flush()
+	return bw.testWriter.Write(p)
+}
+
+func TestLog_BarrierFromWriter(t *testing.T) {
+	testName := "TestLog_BarrierFromWriter"
+	bw := &barrierWriter{}
+	l := LogManger(testName, bw)
+	bw.l = l
+	l.SetFormatter(&spyFormatter{})
+	gotestutil.AssertNil(t, l.AsyncBuffer(10, OverflowBlock), GetCaller()+" Expected async mode")
+
+	l.Info(testName, "msg 1", nil)
+	l.Info(testName, "msg 2", nil)
+	returned := make(chan struct{})
+	go func() {
+		l.Barrier()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s Barrier deadlocked in a module's Write", GetCaller())
+	}
+	gotestutil.AssertEqual(t, []string{"msg 1", "msg 2"}, bw.Lines(), GetCaller()+" Expected all lines after Barrier")
+	l.Close()
+	l.Barrier()
+}
+
+func TestLog_BarrierDropOldest(t *testing.T) {
+	testName := "TestLog_BarrierDropOldest"
+	tests := []struct {
+		size     int
+		expected []string
+	}{
+		// Only the barrier is queued, so the new message is dropped.
+		{1, []string{"msg 1"}},
+		// The message after the barrier is dropped.
+		{2, []string{"msg 1", "msg 3"}},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.size), func(t *testing.T) {
+			gw := newGateWriter()
+			l := LogManger(testName, gw)
+			l.SetFormatter(&spyFormatter{})
+			gotestutil.AssertNil(t, l.AsyncBuffer(tt.size, OverflowDropOldest), GetCaller()+" Expected async mode")
+			defer l.Close()
+
+			// The first message is being written, and the barrier is queued.
+			l.Info(testName, "msg 1", nil)
+			<-gw.writing
+			returned := make(chan struct{})
+			go func() {
+				l.Barrier()
+				close(returned)
+			}()
+			for len(l.getAsync().ch) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			// The queue is full, so making room skips past the barrier, without releasing it.
+			for i := 2; i <= tt.size+1; i++ {
+				l.Info(testName, fmt.Sprintf("msg %d", i), nil)
+			}
+			select {
+			case <-returned:
+				t.Fatalf("%s Expected Barrier to wait for the write in progress", GetCaller())
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			close(gw.release)
+			<-returned
+			gotestutil.AssertEqual(t, "msg 1", gw.Lines()[0], GetCaller()+" Expected the write before the barrier")
+			l.Barrier()
+			gotestutil.AssertEqual(t, tt.expected, gw.Lines(), GetCaller()+" Expected the lines")
+			gotestutil.AssertEqual(t, uint64(1), l.AsyncDropped(), GetCaller()+" Expected a dropped message")
+		})
+	}
+}
+
+func TestOverflowPolicy_String(t *testing.T) {
+	gotestutil.AssertEqual(t, "drop-oldest", OverflowDropOldest.String(), GetCaller()+" Expected the name")
+	gotestutil.AssertEqual(t, "OverflowPolicy(99)", OverflowPolicy(99).String(), GetCaller()+" Expected a fallback")
+	gotestutil.AssertEqual(t, "OverflowPolicy(-1)", OverflowPolicy(-1).String(), GetCaller()+" Expected a fallback")
+}
+
+// Run with -race. Starts async mode while several goroutines log.
+func TestLog_AsyncBufferConcurrent(t *testing.T) {
+	testName := "TestLog_AsyncBufferConcurrent"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	const loggers, events = 4, 200
+	var wg sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				l.Info(testName, fmt.Sprintf("logger %d event %d", i, j), nil)
+			}
+		}(i)
+	}
+	gotestutil.AssertNil(t, l.AsyncBuffer(16, OverflowBlock), GetCaller()+" Expected async mode")
+	wg.Wait()
+	l.Close()
+	gotestutil.AssertEqual(t, loggers*events, len(tw.Lines()), GetCaller()+" Expected every event written")
+}
@@ -0,0 +1,68 @@
+// Caller capture adds the location of the logging call to each event, as the "caller" param.
+// The detail level is set with SetCallerFormat.
+package logger
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// The detail level of the caller param
+type CallerFormat int
+
+const (
+	// No caller param. This is the default.
+	CallerNone CallerFormat = iota
+	// The file and line, e.g. "main.go:42"
+	CallerShort
+	// The function name, qualified by the package name, e.g. "main.(*Server).handle"
+	CallerFunc
+	// The file, package path qualified function, and line, as formatted by GetCaller,
+	// e.g. "/main.go, github.com/me/app.(*Server).handle, Line 42"
+	CallerFull
+)
+
+// The prefix of the Log method names, e.g. "github.com/mooredwightd/logger.(*Log)."
+var logMethodPrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	i := strings.LastIndex(name, "/")
+	return name[:i+strings.Index(name[i+1:], ".")+1] + ".(*Log)."
+}()
+
+// Set the detail level of the "caller" param added to each event.
+// Capturing the caller has a cost on every event. CallerNone disables it.
+func (l *Log) SetCallerFormat(cf CallerFormat) {
+	l.callerFormat = cf
+}
+
+// Returns the location of the first caller outside of the Log methods, in the given format.
+func caller(cf CallerFormat) string {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, logMethodPrefix) {
+			return formatCaller(cf, f)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// Format a stack frame
+func formatCaller(cf CallerFormat, f runtime.Frame) string {
+	switch cf {
+	case CallerShort:
+		return fmt.Sprintf("%s:%d", f.File[strings.LastIndex(f.File, "/")+1:], f.Line)
+	case CallerFunc:
+		return f.Function[strings.LastIndex(f.Function, "/")+1:]
+	case CallerFull:
+		return fmt.Sprintf("%s, %s, Line %d",
+			f.File[strings.LastIndex(f.File, "/"):], f.Function, f.Line)
+	}
+	return ""
+}
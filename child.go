@@ -0,0 +1,118 @@
+// Child loggers share the writers, formatter, and filter of a parent Log, and add base params
+// to each event. Params passed at the call site win on a key collision.
+// Creating a child does not change the parent. Later changes of the writers, formatter, or
+// filter of either, e.g. RemoveLogger, apply to both. Close of a child does nothing.
+package logger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns a copy of the Log, with its own copy of the base params. The copy shares the
+// logState of the Log.
+func (l *Log) child() *Log {
+	c := *l
+	c.fields = copyParams(l.fields)
+	c.isChild = true
+	return &c
+}
+
+// Returns a child logger that adds the fields as params of each event, e.g. a request_id
+// and user_id in an HTTP handler. The child shares the writers, formatter, and filter.
+//
+// Example:
+//
+//	rl := l.With(map[string]string{"request_id": id, "user_id": uid})
+//	rl.Info("ORDER", "Order placed", map[string]string{"order_id": oid})
+func (l *Log) With(fields map[string]string) *Log {
+	c := l.child()
+	for k, v := range fields {
+		c.fields[c.key(k)] = v
+	}
+	return c
+}
+
+// Returns a child logger that adds the error as params of each event:
+//
+//	error        the error message
+//	error.cause  the message of the innermost error, if err wraps other errors
+//	error.types  the types of the errors in the chain, outermost first, e.g. "*fmt.wrapError,*os.PathError"
+//
+// An error that wraps several errors, e.g. from errors.Join, is walked depth first, so the types
+// include each branch, and error.cause has the innermost error of each, separated by "; ".
+// If err is nil, returns the Log unchanged.
+func (l *Log) WithError(err error) *Log {
+	if err == nil {
+		return l
+	}
+	c := l.child()
+	c.fields[c.key("error")] = err.Error()
+
+	types, causes := unwrapErrors(err, nil, nil)
+	if len(types) > 1 {
+		c.fields[c.key("error.cause")] = strings.Join(causes, "; ")
+	}
+	c.fields[c.key("error.types")] = strings.Join(types, ",")
+	return c
+}
+
+// Walks the errors wrapped by err depth first, i.e. by Unwrap() error, or Unwrap() []error, e.g.
+// errors.Join. Returns the types of the errors, outermost first, and the messages of the
+// innermost errors, which wrap no other error, appended to types and causes.
+func unwrapErrors(err error, types, causes []string) ([]string, []string) {
+	types = append(types, fmt.Sprintf("%T", err))
+	switch u := err.(type) {
+	case interface{ Unwrap() error }:
+		if e := u.Unwrap(); e != nil {
+			return unwrapErrors(e, types, causes)
+		}
+	case interface{ Unwrap() []error }:
+		var wrapped bool
+		for _, e := range u.Unwrap() {
+			if e != nil {
+				types, causes = unwrapErrors(e, types, causes)
+				wrapped = true
+			}
+		}
+		if wrapped {
+			return types, causes
+		}
+	}
+	return types, append(causes, err.Error())
+}
+
+// Returns a child logger that prefixes its param keys with the namespace and a ".", e.g.
+// "db.rows", to avoid collisions when several subsystems log through one logger.
+// Base params of the parent are not prefixed. Namespaces nest, e.g. "app.db.rows".
+func (l *Log) WithNamespace(ns string) *Log {
+	c := l.child()
+	c.namespace = c.key(ns)
+	return c
+}
+
+// Returns the param key prefixed with the namespace, if any.
+func (l *Log) key(k string) string {
+	if l.namespace == "" {
+		return k
+	}
+	return l.namespace + "." + k
+}
+
+// Returns the default and base params merged with the call site params. Call site params win,
+// and their keys are prefixed with the namespace, if any. Base params win over default params.
+// If there are no default or base params, or namespace, returns params unchanged.
+func (l *Log) mergeFields(params map[string]string) map[string]string {
+	defaults, _ := l.defaultParams.Load().(map[string]string)
+	if len(defaults) == 0 && len(l.fields) == 0 && l.namespace == "" {
+		return params
+	}
+	m := copyParams(defaults)
+	for k, v := range l.fields {
+		m[k] = v
+	}
+	for k, v := range params {
+		m[l.key(k)] = v
+	}
+	return m
+}
@@ -0,0 +1,126 @@
+// Circuit Breaker (CB)
+// A circuit breaker wraps a LogWriter and stops writing to it after a number of consecutive
+// write errors (disk full, network down, etc.). Once "open", writes are rejected until a cooldown
+// period expires. After the cooldown the circuit is "half-open", and the next write tests
+// recovery. A successful write closes the circuit, and a failed one re-opens it.
+//
+// Example:
+//
+//	f, _ := logger.File("/somepath/logs/app")
+//	cb := logger.CircuitBreaker(f, 5, time.Minute, func(w logger.LogWriter, err error) {
+//	    alert("log sink failing", err)
+//	})
+//	l := logger.LogManger("MyApp", cb)
+package logger
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The state of a circuit breaker
+type CircuitState int
+
+const (
+	// Writes pass through to the wrapped writer.
+	CircuitClosed CircuitState = iota
+	// Writes are rejected until the cooldown expires.
+	CircuitOpen
+	// The next write tests if the wrapped writer has recovered.
+	CircuitHalfOpen
+)
+
+var (
+	// Returned by a circuit breaker write while the circuit is open.
+	CircuitOpenError error = errors.New("Circuit Open Exception")
+
+	circuitStateName = []string{"closed", "open", "half-open"}
+)
+
+// Returns the string representation of the circuit state, e.g. "CircuitState(99)" if it is
+// not valid.
+func (cs CircuitState) String() string {
+	if cs < CircuitClosed || int(cs) >= len(circuitStateName) {
+		return "CircuitState(" + strconv.Itoa(int(cs)) + ")"
+	}
+	return circuitStateName[cs]
+}
+
+// Implements a LogWriter that wraps another LogWriter with a circuit breaker.
+type CircuitBreakerWriter struct {
+	w         LogWriter
+	threshold int                    // Consecutive errors before opening the circuit
+	cooldown  time.Duration          // Time the circuit stays open
+	onOpen    func(LogWriter, error) // Called each time the circuit opens
+	failures  int                    // Current count of consecutive errors
+	state     CircuitState
+	openedAt  time.Time
+	sync.Mutex
+}
+
+// Create a circuit breaker around the LogWriter w.
+// After threshold consecutive write errors, the circuit opens for the cooldown duration, and
+// onOpen (if not nil) is called with the wrapped writer and the last error.
+// A threshold less than 1 is set to 1.
+func CircuitBreaker(w LogWriter, threshold int, cooldown time.Duration,
+	onOpen func(LogWriter, error)) *CircuitBreakerWriter {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreakerWriter{w: w, threshold: threshold, cooldown: cooldown, onOpen: onOpen}
+}
+
+// Write a message to the wrapped writer. This implements the io.Writer interface
+// While the circuit is open, returns 0 and CircuitOpenError without writing.
+// This is goroutine safe.
+func (cb *CircuitBreakerWriter) Write(p []byte) (n int, err error) {
+	cb.Lock()
+	if cb.state == CircuitOpen {
+		if time.Since(cb.openedAt) < cb.cooldown {
+			cb.Unlock()
+			return 0, CircuitOpenError
+		}
+		cb.state = CircuitHalfOpen
+	}
+
+	n, err = cb.w.Write(p)
+	if err == nil {
+		cb.failures = 0
+		cb.state = CircuitClosed
+		cb.Unlock()
+		return
+	}
+
+	cb.failures++
+	opened := false
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+		opened = true
+	}
+	cb.Unlock()
+
+	// Call outside the lock, so the callback may use the writer.
+	if opened && cb.onOpen != nil {
+		cb.onOpen(cb.w, err)
+	}
+	return
+}
+
+// Close the wrapped writer. This implements the io.Closer interface
+func (cb *CircuitBreakerWriter) Close() error {
+	return cb.w.Close()
+}
+
+// Returns the current state of the circuit.
+// An open circuit whose cooldown has expired is reported as half-open.
+func (cb *CircuitBreakerWriter) State() CircuitState {
+	cb.Lock()
+	defer cb.Unlock()
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.cooldown {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
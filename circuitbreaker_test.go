@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+// A LogWriter that fails while fail is set.
+type failingWriter struct {
+	fail   bool
+	writes int
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	fw.writes++
+	if fw.fail {
+		return 0, errors.New("failingWriter: write failed")
+	}
+	return len(p), nil
+}
+
+func (fw *failingWriter) Close() error {
+	return nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	testName := "TestCircuitBreaker"
+	cooldown := 100 * time.Millisecond
+	fw := &failingWriter{fail: true}
+	opened := 0
+	cb := CircuitBreaker(fw, 3, cooldown, func(w LogWriter, err error) {
+		opened++
+	})
+
+	t.Run(testName+"=1", func(t *testing.T) {
+		// Consecutive failures open the circuit.
+		for i := 0; i < 3; i++ {
+			_, err := cb.Write([]byte("msg"))
+			gotestutil.AssertNotNil(t, err, "Expected a write error")
+		}
+		gotestutil.AssertEqual(t, CircuitOpen, cb.State(), "Expected an open circuit")
+		gotestutil.AssertEqual(t, 1, opened, "Expected the callback to fire once")
+
+		// Writes are rejected without reaching the writer.
+		_, err := cb.Write([]byte("msg"))
+		gotestutil.AssertEqual(t, CircuitOpenError, err, "Expected CircuitOpenError")
+		gotestutil.AssertEqual(t, 3, fw.writes, "Expected no write while open")
+	})
+
+	t.Run(testName+"=2", func(t *testing.T) {
+		// A failed half-open write re-opens the circuit.
+		time.Sleep(cooldown)
+		gotestutil.AssertEqual(t, CircuitHalfOpen, cb.State(), "Expected a half-open circuit")
+		_, err := cb.Write([]byte("msg"))
+		gotestutil.AssertNotNil(t, err, "Expected a write error")
+		gotestutil.AssertEqual(t, CircuitOpen, cb.State(), "Expected an open circuit")
+		gotestutil.AssertEqual(t, 2, opened, "Expected the callback to fire again")
+	})
+
+	t.Run(testName+"=3", func(t *testing.T) {
+		// Recovers after the cooldown.
+		fw.fail = false
+		time.Sleep(cooldown)
+		n, err := cb.Write([]byte("msg"))
+		gotestutil.AssertNil(t, err, "Expected a successful write")
+		gotestutil.AssertEqual(t, 3, n, "Expected 3 bytes written")
+		gotestutil.AssertEqual(t, CircuitClosed, cb.State(), "Expected a closed circuit")
+	})
+}
+
+func TestCircuitState_String(t *testing.T) {
+	gotestutil.AssertEqual(t, "half-open", CircuitHalfOpen.String(), GetCaller()+" Expected the name")
+	gotestutil.AssertEqual(t, "CircuitState(99)", CircuitState(99).String(), GetCaller()+" Expected a fallback")
+	gotestutil.AssertEqual(t, "CircuitState(-1)", CircuitState(-1).String(), GetCaller()+" Expected a fallback")
+}
@@ -0,0 +1,58 @@
+package logger
+
+import "fmt"
+
+// A serializable snapshot of a Log configuration, e.g. for debugging and admin endpoints.
+type Config struct {
+	Appname   string         `json:"appname"`
+	Hostname  string         `json:"hostname"`
+	Version   string         `json:"version"`
+	Filter    string         `json:"filter"`
+	Formatter string         `json:"formatter"`
+	Modules   []ModuleConfig `json:"modules"`
+}
+
+// The configuration of a LogWriter registered with the Log.
+// Policy and Filename are only set for a FileWriter.
+type ModuleConfig struct {
+	Policy    string `json:"policy,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	Filter    string `json:"filter"`
+	Formatter string `json:"formatter,omitempty"` // Set if the module has its own formatter
+}
+
+// Returns a snapshot of the current logger configuration.
+func (l *Log) Config() Config {
+	c := Config{
+		Appname:   l.appname,
+		Hostname:  l.hostname,
+		Version:   l.version,
+		Filter:    l.GetFilter().String(),
+		Formatter: formatterName(l.getFormatter()),
+	}
+	mods := l.modules()
+	c.Modules = make([]ModuleConfig, 0, len(mods))
+	for _, mod := range mods {
+		mc := ModuleConfig{Filter: mod.threshold(InvalidSeverity, l.GetFilter()).String(), Formatter: formatterName(mod.formatter)}
+		if fw, ok := mod.LogWriter.(FileWriter); ok {
+			mc.Policy = fw.LogPolicy().String()
+			mc.Filename = fw.LogFilename()
+		}
+		c.Modules = append(c.Modules, mc)
+	}
+	return c
+}
+
+// Returns the name of a formatter. If the formatter does not provide a Name() method,
+// the type name is used.
+func formatterName(ef EventFormatter) string {
+	if ef == nil {
+		return ""
+	}
+	if n, ok := ef.(interface {
+		Name() string
+	}); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", ef)
+}
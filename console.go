@@ -0,0 +1,97 @@
+package logger
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// ANSI escape sequences of the severity colors.
+const (
+	ansiReset   = "\x1b[0m"
+	ansiRed     = "\x1b[31m"
+	ansiBoldRed = "\x1b[1;31m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+	ansiGreen   = "\x1b[32m"
+	ansiGray    = "\x1b[90m"
+)
+
+var (
+	// Color of each severity, indexed by Severity.
+	severityColor = [...]string{
+		"", ansiBoldRed, ansiBoldRed, ansiBoldRed, ansiRed, ansiYellow, ansiCyan, ansiGreen, ansiGray,
+	}
+
+	// Returns true if f is a terminal. Replaced in tests.
+	isTerminal = func(f *os.File) bool {
+		fi, err := f.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0
+	}
+)
+
+// ConsoleFormatter formats events as compact, human-friendly lines for a terminal, e.g.
+//
+//	15:04:05 ERROR DB_CONN connection refused host=db1 retry=3
+//
+// The severity is colored with ANSI escapes, if stderr is a terminal. Params are sorted by key,
+// and quoted as in logfmt. This is intended for local development, not for log files.
+type ConsoleFormatter struct {
+	name  string
+	color bool
+}
+
+// Create a new console event message formatter.
+// Colors are enabled if stderr is a terminal, and the NO_COLOR environment variable is not set.
+func Console() *ConsoleFormatter {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	return &ConsoleFormatter{name: "console", color: !noColor && isTerminal(os.Stderr)}
+}
+
+// Returns the name of the formatter
+func (cf *ConsoleFormatter) Name() string {
+	return cf.name
+}
+
+// Enable colors, even if stderr is not a terminal, e.g. for a CI log viewer.
+// Returns the formatter, so options can be chained.
+func (cf *ConsoleFormatter) ForceColor() *ConsoleFormatter {
+	cf.color = true
+	return cf
+}
+
+// Disable colors.
+// Returns the formatter, so options can be chained.
+func (cf *ConsoleFormatter) DisableColor() *ConsoleFormatter {
+	cf.color = false
+	return cf
+}
+
+// Implements EventFormatter interface.
+func (cf *ConsoleFormatter) Format(em EventMsg) (msg string, err error) {
+	var b strings.Builder
+	b.WriteString(em.Timestamp.Format("15:04:05"))
+	b.WriteByte(' ')
+	sev := StringToSeverity(em.Sev)
+	if cf.color && sev >= SeverityMinLevel && sev <= SeverityMaxLevel {
+		b.WriteString(severityColor[sev])
+		b.WriteString(em.Sev)
+		b.WriteString(ansiReset)
+	} else {
+		b.WriteString(em.Sev)
+	}
+	b.WriteByte(' ')
+	b.WriteString(em.MsgId)
+	b.WriteByte(' ')
+	b.WriteString(em.Msg)
+
+	keys := make([]string, 0, len(em.Params))
+	for k := range em.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeLogfmtPair(&b, logfmtKey(k), em.Params[k])
+	}
+	return b.String(), nil
+}
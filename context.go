@@ -0,0 +1,137 @@
+// Context Logging
+// LogEventCtx logs an event with params extracted from a context.Context, so request-scoped
+// values, e.g. a trace id, flow into each event without passing them at every call site.
+// The trace id stored by ContextWithTraceID is extracted as the "trace_id" param. Other context
+// keys are mapped to params by WithContextValue.
+//
+// The trace and span ids of a tracing library, e.g. OpenTelemetry, are extracted by a
+// TraceExtractor, so this package does not depend on the library. The JSONFormatter emits
+// the "trace_id" and "span_id" params as top-level fields.
+//
+// An event logged with a context that is already cancelled, or past its deadline, is dropped.
+//
+// Example:
+//
+//	ctx = logger.ContextWithTraceID(ctx, r.Header.Get("X-Trace-Id"))
+//	rl := l.WithContextValue(userKey, "user_id")
+//	rl.LogEventCtx(ctx, logger.Info, "ORDER", "Order placed", nil)
+//	// "params":{"trace_id":"4bf92f35","user_id":"u1"}
+//
+// OpenTelemetry:
+//
+//	l.SetTraceExtractor(func(ctx context.Context) (string, string) {
+//	    sc := trace.SpanContextFromContext(ctx)
+//	    if !sc.IsValid() {
+//	        return "", ""
+//	    }
+//	    return sc.TraceID().String(), sc.SpanID().String()
+//	})
+package logger
+
+import (
+	"context"
+	"fmt"
+)
+
+// Param names of the trace and span ids.
+const (
+	TraceIDParam = "trace_id"
+	SpanIDParam  = "span_id"
+)
+
+// Type of the context keys of this package, so they do not collide with keys of other packages.
+type contextKey string
+
+// Context key of the trace id. See ContextWithTraceID.
+const TraceIDKey contextKey = "trace_id"
+
+// Returns the trace id and span id of the operation traced in the context, or empty strings
+// if there is none.
+type TraceExtractor func(ctx context.Context) (traceID, spanID string)
+
+// A context key, and the param name of its value.
+type contextValue struct {
+	key   interface{}
+	param string
+}
+
+// Returns a copy of the context that carries the trace id, which LogEventCtx logs as the
+// "trace_id" param.
+func ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, TraceIDKey, id)
+}
+
+// Set the extractor of the trace and span ids, logged as the "trace_id" and "span_id" params
+// by LogEventCtx. An extracted trace id replaces one stored by ContextWithTraceID.
+// A nil extractor disables it. Child loggers created later inherit it.
+func (l *Log) SetTraceExtractor(fn TraceExtractor) {
+	l.traceExtractor = fn
+}
+
+// Returns a child logger that logs the value of the context key, if any, as the param, in
+// events logged by LogEventCtx. A string or fmt.Stringer value is logged as is, and any other
+// value as fmt.Sprint. A later mapping of the same param wins.
+func (l *Log) WithContextValue(key interface{}, param string) *Log {
+	c := l.child()
+	// Full slice expression, so the append copies, rather than sharing the parent's array.
+	c.ctxValues = append(c.ctxValues[:len(c.ctxValues):len(c.ctxValues)], contextValue{key: key, param: param})
+	return c
+}
+
+// Write a message to the log(s), with the params extracted from the context. Params passed
+// at the call site win on a key collision. If the context is done, the event is dropped.
+// A nil context is treated as context.Background.
+func (l *Log) LogEventCtx(ctx context.Context, sev Severity, msgId string, msg string, params map[string]string) {
+	if ctx == nil {
+		l.LogEvent(sev, msgId, msg, params)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	l.LogEvent(sev, msgId, msg, l.contextParams(ctx, params))
+}
+
+// Returns the params with the values extracted from the context added, or the params
+// unchanged if the context carries none.
+func (l *Log) contextParams(ctx context.Context, params map[string]string) map[string]string {
+	var m map[string]string
+	add := func(param string, v interface{}) {
+		if v == nil {
+			return
+		}
+		if _, ok := params[param]; ok {
+			return
+		}
+		if m == nil {
+			m = copyParams(params)
+		}
+		switch s := v.(type) {
+		case string:
+			m[param] = s
+		case fmt.Stringer:
+			m[param] = s.String()
+		default:
+			m[param] = fmt.Sprint(v)
+		}
+	}
+	if id, ok := ctx.Value(TraceIDKey).(string); ok && id != "" {
+		add(TraceIDParam, id)
+	}
+	if l.traceExtractor != nil {
+		traceID, spanID := l.traceExtractor(ctx)
+		if traceID != "" {
+			add(TraceIDParam, traceID)
+		}
+		if spanID != "" {
+			add(SpanIDParam, spanID)
+		}
+	}
+	for _, cv := range l.ctxValues {
+		add(cv.param, ctx.Value(cv.key))
+	}
+	if m == nil {
+		return params
+	}
+	return m
+}
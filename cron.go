@@ -0,0 +1,130 @@
+// Cron Schedule
+// A cron timer fires on a 5-field cron schedule, for rotations that a fixed duration cannot
+// express, e.g. every 6 hours aligned to the clock ("0 */6 * * *"), or weekdays only
+// ("0 0 * * 1-5").
+//
+// The fields are minute (0-59), hour (0-23), day of month (1-31), month (1-12), and day of
+// week (0-6, Sunday is 0 or 7). Each field is "*", a value, a range "a-b", a step "*/n" or
+// "a-b/n", or a comma separated list of those. Names (e.g. "mon") are not supported.
+// As in cron, if both the day of month and day of week are restricted, either may match.
+package logger
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits the search for the next fire time, e.g. for "0 0 30 2 *", which never matches.
+const cronMaxYears = 5
+
+// A parsed cron schedule. Each field is a bit set of the allowed values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// Bounds of each field, in order.
+var cronFieldBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// Parse a 5-field cron expression. Returns ParseError if it is not valid.
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ParseError
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFieldBounds[i][0], cronFieldBounds[i][1])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	cs := &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	// Sunday is 0 or 7.
+	if cs.dow&(1<<7) != 0 {
+		cs.dow |= 1
+	}
+	return cs, nil
+}
+
+// Parse a comma separated list of values, ranges and steps, within [lo, hi].
+func parseCronField(f string, lo, hi int) (bits uint64, err error) {
+	for _, part := range strings.Split(f, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, ParseError
+			}
+		}
+		first, last := lo, hi
+		switch i := strings.Index(rng, "-"); {
+		case rng == "*":
+		case i >= 0:
+			if first, err = strconv.Atoi(rng[:i]); err != nil {
+				return 0, ParseError
+			}
+			if last, err = strconv.Atoi(rng[i+1:]); err != nil {
+				return 0, ParseError
+			}
+		default:
+			if first, err = strconv.Atoi(rng); err != nil {
+				return 0, ParseError
+			}
+			last = first
+			if step > 1 {
+				last = hi
+			}
+		}
+		if first < lo || last > hi || first > last {
+			return 0, ParseError
+		}
+		for v := first; v <= last; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Returns the first time after t that matches the schedule, in the location of t.
+// Returns the zero time if there is none within cronMaxYears.
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + cronMaxYears
+	for t.Year() <= limit {
+		switch {
+		case cs.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !cs.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case cs.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case cs.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Returns true if the day of t matches the day of month and day of week fields.
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	dom := cs.dom&(1<<uint(t.Day())) != 0
+	dow := cs.dow&(1<<uint(t.Weekday())) != 0
+	if cs.domStar || cs.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	// Friday, 2017-03-03 05:06:07
+	from := time.Date(2017, 3, 3, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2017, 3, 3, 5, 7, 0, 0, time.UTC)},
+		{"0 */6 * * *", time.Date(2017, 3, 3, 6, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2017, 3, 4, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2017, 3, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2017, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"15,45 9 1 * *", time.Date(2017, 4, 1, 9, 15, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week.
+		{"0 0 10 * 6", time.Date(2017, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cs, err := parseCron(tt.spec)
+		gotestutil.AssertNil(t, err, GetCaller()+" Error parsing "+tt.spec)
+		gotestutil.AssertEqual(t, tt.expected, cs.next(from), GetCaller()+" Next time for "+tt.spec)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := parseCron(spec)
+		gotestutil.AssertEqual(t, ParseError, err, GetCaller()+" Expected a parse error for "+spec)
+	}
+}
+
+func TestCronFile(t *testing.T) {
+	testName := "TestCronFile"
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+	_, err := CronFile(testName, "0 0 30 2 *")
+	gotestutil.AssertEqual(t, ParseError, err, GetCaller()+" Expected an error for a schedule that never matches")
+
+	lf, err := CronFile(testName, "0 */6 * * *")
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the file")
+	defer lf.Close()
+
+	tt := lf.ltimer.TriggerTime()
+	gotestutil.AssertTrue(t, tt.After(time.Now()), GetCaller()+" Expected a future trigger time")
+	gotestutil.AssertEqual(t, 0, tt.Hour()%6, GetCaller()+" Expected a trigger every 6 hours")
+	gotestutil.AssertEqual(t, 0, tt.Minute(), GetCaller()+" Expected a trigger on the hour")
+	gotestutil.AssertFalse(t, lf.LogRotateCheck(), GetCaller()+" Expected no rotation before the trigger time")
+
+	// After a rotation, the timer is re-armed for the next scheduled time.
+	lf.LogRotate()
+	gotestutil.AssertEqual(t, tt, lf.ltimer.TriggerTime(), GetCaller()+" Expected the same trigger time")
+	lf.ltimer.next = time.Now().Add(-time.Hour)
+	gotestutil.AssertTrue(t, lf.LogRotateCheck(), GetCaller()+" Expected rotation after the trigger time")
+	lf.LogRotate()
+	gotestutil.AssertEqual(t, tt, lf.ltimer.TriggerTime(), GetCaller()+" Expected the next scheduled time")
+}
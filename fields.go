@@ -0,0 +1,85 @@
+// Typed fields log params with their Go types, so the JSONFormatter emits JSON numbers,
+// booleans, and objects, rather than strings. Other formatters use the string form of each
+// value, i.e. fmt.Sprint, and an error is logged as its message.
+//
+// Fields are call site params, so they win over default params and the base params of a
+// child logger with the same key, and are prefixed with the namespace, if any.
+//
+// Example:
+//
+//	l.InfoF("UPLOAD", "Upload complete", logger.Fields{"count": 42, "ok": true})
+//	// "params":{"count":42,"ok":true}
+package logger
+
+import "fmt"
+
+// Params with typed values
+type Fields map[string]interface{}
+
+// Write a message with typed params to the log(s). See LogEvent.
+func (l *Log) LogEventF(sev Severity, msgId string, msg string, fields Fields) {
+	var params map[string]string
+	if len(fields) > 0 {
+		params = make(map[string]string, len(fields))
+		for k, v := range fields {
+			params[k] = fmt.Sprint(v)
+		}
+	}
+	l.logEvent(sev, msgId, msg, params, fields)
+}
+
+// Returns the fields with the keys prefixed with the namespace, and errors replaced by their
+// message. Returns nil if there are no fields.
+func (l *Log) keyFields(fields Fields) Fields {
+	if len(fields) == 0 {
+		return nil
+	}
+	m := make(Fields, len(fields))
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		m[l.key(k)] = v
+	}
+	return m
+}
+
+// Convenience fnction to log an EMERGENCY level message with typed params
+func (l *Log) EmergencyF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Emergency, msgId, msg, fields)
+}
+
+// Convenience fnction to log an ALERT level message with typed params
+func (l *Log) AlertF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Alert, msgId, msg, fields)
+}
+
+// Convenience fnction to log a CRITICAL level message with typed params
+func (l *Log) CriticalF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Critical, msgId, msg, fields)
+}
+
+// Convenience fnction to log an ERROR level message with typed params
+func (l *Log) ErrorF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Error, msgId, msg, fields)
+}
+
+// Convenience fnction to log a WARNING level message with typed params
+func (l *Log) WarningF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Warning, msgId, msg, fields)
+}
+
+// Convenience fnction to log a NOTICE level message with typed params
+func (l *Log) NoticeF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Notice, msgId, msg, fields)
+}
+
+// Convenience fnction to log an INFO level message with typed params
+func (l *Log) InfoF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Info, msgId, msg, fields)
+}
+
+// Convenience fnction to log a DEBUG level message with typed params
+func (l *Log) DebugF(msgId string, msg string, fields Fields) {
+	l.LogEventF(Debug, msgId, msg, fields)
+}
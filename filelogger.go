@@ -6,20 +6,22 @@
 //     File (static, non-limited file)
 //     SizeLimitedFile, which rotates once the file size limit is reached.
 //     DailyFile, which rotates each day at 00:00.00.
+//     DailyFileAt, which rotates each day at a given hour and minute.
 //     TimedFile, which rotates at a defined interface, e.g. every 2 hours.
+//     CronFile, which rotates on a cron schedule, e.g. weekdays at midnight.
 //
 package logger
 
 import (
 	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"io"
-	"log"
-	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -39,19 +41,58 @@ const (
 
 	// path/prefix"."date_and-or_volume"."log.
 	logFilenameExtension    string = "log"
-	logFilenameDailyFormat  string = "2016-01-01"
-	logFilenameTimeFormat   string = "2016-01-01T23.01.01"
+	logFilenameDailyFormat  string = "2006-01-02"              // time.Format layout
+	logFilenameTimeFormat   string = "2006-01-02T15.04.05.000" // time.Format layout
 	logFilenameVolumeFormat string = "%04.4d"
 
 	// Volumes from 1 to 9999
 	logMaxVolNumber int = 9999
 
 	// Open mode is u=rw, g=rw, o=none
-	logDefaultFileMode  os.FileMode = 0660
-	logDefaultOpenFlags int         = os.O_CREATE | os.O_APPEND
+	logDefaultFileMode os.FileMode = 0660
+	// Open flags. O_RDONLY is zero, so without O_WRONLY the file is opened read-only, and
+	// every write fails with EBADF.
+	logDefaultOpenFlags int = os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	// Mode of created parent directories is u=rwx, g=rx, o=none
+	logDefaultDirMode os.FileMode = 0750
 
 	// Indicates the low water mark to cause a file rotation.
 	logHighWaterMark = (2 * Kbyte)
+
+	// Replaces embedded newlines in a log entry.
+	logNewlineReplacement string = "; "
+
+	// The longest a free space check is reused. See SetMinFreeSpace.
+	logFreeSpaceCheckInterval = time.Second
+)
+
+var (
+	// Returned when a platform does not support synchronized data writes.
+	DataSyncNotSupportedError error = errors.New("Data Sync Not Supported Exception")
+
+	// Returned by Write when the file is not open, and cannot be reopened, e.g. after a failed rotation.
+	FileNotOpenError error = errors.New("File Not Open Exception")
+
+	// Returned when a platform does not support checking free disk space.
+	DiskSpaceNotSupportedError error = errors.New("Disk Space Not Supported Exception")
+	// Returned by Write when free disk space is below the minimum, after retention cleanup.
+	InsufficientDiskSpaceError error = errors.New("Insufficient Disk Space Exception")
+
+	// Matches the volume number of a volume file name, e.g. "prefix.0001.log".
+	volumeNoRegexp = regexp.MustCompile(`\.([0-9]+)\.` + logFilenameExtension + `$`)
+	// Matches the part of a volume file name after the prefix: a volume number, a date, or a
+	// timestamp, with an optional ".gz", e.g. ".0001.log", ".2017-03-04.log", or
+	// ".2017-03-04T05.06.07.008.log.gz".
+	volumeNameRegexp = regexp.MustCompile(`^\.([0-9]+|[0-9]{4}-[0-9]{2}-[0-9]{2}` +
+		`(T[0-9]{2}\.[0-9]{2}\.[0-9]{2}(\.[0-9]{3})?)?)\.` + logFilenameExtension +
+		`(\.` + logFilenameGzipExtension + `)?$`)
+
+	// Opens log files. Replaced in tests to observe the open flags.
+	osOpenFile = os.OpenFile
+	// Returns the free bytes on the filesystem of a path. Replaced in tests.
+	diskFree = statfsFree
+	// Returns the current time, e.g. for file names. Replaced in tests for a fixed clock.
+	now = time.Now
 )
 
 type FileWriter interface {
@@ -71,6 +112,8 @@ type LogFile struct {
 	policy        PolicyType
 	volNo         int16 // Used for static files or PolicyFileSzie
 	fileSizeLimit int64 // Use for PolicyFileSize
+	maxLines      int   // Use for PolicyLineLimit
+	lineCount     int   // Lines in the current file, for PolicyLineLimit
 	// The current io.Writer for this log.
 	f     io.WriteCloser
 	cycle time.Duration // Time rotation cycle
@@ -80,6 +123,45 @@ type LogFile struct {
 	rotateCheck func() bool
 	rotate      func() bool
 	newTimer    func() *LogTimer
+	// Set while rotation is paused. Writes continue to the current file.
+	paused bool
+	// Flags used to open the file. Zero means logDefaultOpenFlags.
+	openFlags int
+	// Mode of created parent directories. Zero means logDefaultDirMode.
+	dirMode os.FileMode
+	// Mode of created files. Zero means logDefaultFileMode.
+	fileMode os.FileMode
+	// Write gzip compressed output, flushed every flushInterval (zero flushes every write).
+	gzipped       bool
+	flushInterval time.Duration
+	lastFlush     time.Time
+	// Replaces embedded newlines. Nil means logNewlineReplacement.
+	newlineRepl []byte
+	// Write entries verbatim, e.g. binary records. See SetRawWrites.
+	rawWrites bool
+	// Gzip compress volumes after rotation. Pending compressions are tracked by compressing.
+	compressOnRotate bool
+	compressing      sync.WaitGroup
+	// Retention of rotated volumes. Zero is not limited.
+	maxBackups int
+	maxAge     time.Duration
+	// Minimum free bytes on the filesystem to write. Zero is not checked.
+	minFreeSpace uint64
+	// The free bytes at the last check, less the bytes written since, and the time of the check.
+	freeSpace   uint64
+	freeChecked time.Time
+	// Sync the file to storage before it is closed (unless noSyncOnClose), and after each write.
+	noSyncOnClose  bool
+	syncEveryWrite bool
+	// Set while writes are stopped for low free space, so the warning is logged once.
+	diskFull bool
+	// Receives the writes while diskFull, or nil. See DiskFullFallback.
+	diskFullFallback io.Writer
+	// Maintain the "prefix.current.log" link to the current file, and remove it on Close.
+	currentLink       bool
+	removeLinkOnClose bool
+	// Set by Close. Writes fail, and Close does nothing, after.
+	closed bool
 	sync.Mutex
 }
 
@@ -87,43 +169,19 @@ type LogFile struct {
 //
 
 // Creates a simple, non-rotating log file. Two File logs with the same name (prefix) point to the
-// same file. The name parameter is a full file path and filename, with no extension.
+// same file, and share one handle, so their lines are not interleaved (see openSharedFile).
+// The name parameter is a full file path and filename, with no extension.
 //
 // If an error occurs, returns nil, and an error.
 func File(name string) (lf *LogFile, err error) {
-	lf = &LogFile{
-		prefix: name,
-		policy: PolicyNone,
-		rotateCheck: func() bool {
-			return false
-		},
-		rotate: func() bool {
-			return true
-		},
-		newTimer: func() *LogTimer {
-			return nil
-		},
-	}
-	// Uses the prefix from LogFile
-	lf.filenameGen = lf.getStaticFilename
-
-	lf.Lock()
-	defer lf.Unlock()
-	err = lf.openFile(lf.filenameGen())
-	if err != nil {
-		return nil, err
-	}
-	msg := fmt.Sprintf("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"timer\":\"%s\"}",
-		"start", lf.policy.String(), lf.currentFile, "0")
-	log.Printf(msg)
-	return
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyNone})
 }
 
 // Creates a log file with a size constraint (limit).
 // When a file will exceed the size limit, a new volume is created.
 //
-// The minimum file size is 1MB, and size limits are rounded the next larger multiple.
-// The max volume size is set to 500MB.
+// The minimum file size is 1MB, and size limits are rounded up to the next multiple of 1MB.
+// The max volume size is set to 500MB. Sizes outside the range are clamped.
 //
 // Given the same prefix, the file is always the same name of "prefix".volNo."log", where volNo
 // starts with "0000", and increments. The current volNo will be reopened if it exists, or the next
@@ -132,33 +190,7 @@ func File(name string) (lf *LogFile, err error) {
 //
 // If an error occurs, returns nil, and an error.
 func SizeLimitedFile(name string, size int64) (lf *LogFile, err error) {
-	lf = &LogFile{prefix: name, policy: PolicyFileSize}
-	lf.filenameGen = lf.getStaticFilename
-	lf.rotateCheck = lf.sizeRotateCheck
-	lf.rotate = lf.timedRotate
-	lf.newTimer = func() *LogTimer {
-		return nil
-	}
-
-	size = max(size, LogMaxFileSize)
-	if rem := math.Mod(float64(size), float64(LogMinFileSize)); rem > 0.0 {
-		size = (size/LogMinFileSize)*LogMinFileSize + LogMinFileSize
-	} else {
-		size = LogMinFileSize
-	}
-
-	lf.fileSizeLimit = size
-
-	lf.Lock()
-	defer lf.Unlock()
-	err = lf.openFile(lf.filenameGen())
-	if err != nil {
-		return nil, err
-	}
-	msg := fmt.Sprintf("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"size_limit\":\"%d\", \"timer\":\"%s\"}",
-		"start", lf.policy.String(), lf.currentFile, lf.fileSizeLimit, "0")
-	log.Printf(msg)
-	return
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyFileSize, SizeLimit: size})
 }
 
 // Craate a log file using the rotation policy PolicyDaily. There is no size limit for the file.
@@ -169,65 +201,70 @@ func SizeLimitedFile(name string, size int64) (lf *LogFile, err error) {
 //
 // If an error occurs, then it returns nil, and an error.
 func DailyFile(name string) (lf *LogFile, err error) {
-	lf = &LogFile{prefix: name, policy: PolicyDaily, cycle: 24 * time.Hour}
-	lf.filenameGen = lf.getDailyFilename
-	lf.rotateCheck = lf.timedRotateCheck
-	lf.rotate = lf.timedRotate
-
-	lf.Lock()
-	defer lf.Unlock()
-	err = lf.openFile(lf.filenameGen())
-	if err != nil {
-		lf.Close()
-		lf = nil
-		return nil, err
-	}
+	return DailyFileAt(name, 0, 0)
+}
 
-	lf.newTimer = func() *LogTimer {
-		return NewDailyTimer(time.Now().Location(), func() {
-			_ = lf.LogRotate()
-		})
+// Craate a log file using the rotation policy PolicyDaily, that rotates daily at hour:minute
+// local time, e.g. 02:00 to avoid a busy midnight window. Otherwise, it is the same as DailyFile.
+//
+// If the hour or minute is out of range, returns InvalidArgumentError.
+// If an error occurs, then it returns nil, and an error.
+func DailyFileAt(name string, hour, minute int) (lf *LogFile, err error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return nil, InvalidArgumentError
 	}
-	lf.ltimer = lf.newTimer()
-
-	msg := fmt.Sprintf("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"timer\":\"%s\"}",
-		"start", lf.policy.String(), lf.currentFile, lf.ltimer.d.String())
-	log.Printf(msg)
-	return lf, nil
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyDaily,
+		RotateAt: time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute})
 }
 
 // Craate a log file using the rotation policy PolicyTimeLimit. There is no size limit for the file.
 //
-// Creates a file name of "name.YYYY-MM-DDThh_mm_ss.log".
+// Creates a file name of "name.YYYY-MM-DDThh.mm.ss.mmm.log", with milliseconds, so fast
+// rotations, e.g. a cycle of a few seconds, do not reuse a file.
 // Name represents a full path and filename prefix.
 // The timer is initialized to the current date/time, and reset at each rotation, specified by rt.
+// A cycle of a minute or more is aligned to the minute. A shorter cycle is not.
 // At each file rotation, the file name is updated with the current date and time.
 //
 // If an error occurs, then it returns nil, and an error.
 //
 func TimedFile(name string, rt time.Duration) (lf *LogFile, err error) {
-	lf = &LogFile{prefix: name, policy: PolicyTimeLimit, cycle: rt}
-	lf.filenameGen = lf.getTimedFilename // filename generator
-	lf.rotateCheck = lf.timedRotateCheck // Rotation check, true if time
-	lf.rotate = lf.timedRotate           // file rotation method
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyTimeLimit, Cycle: rt})
+}
 
-	lf.Lock()
-	defer lf.Unlock()
-	err = lf.openFile(lf.filenameGen())
-	if err != nil {
-		lf.Close()
-		lf = nil
+// Craate a log file using the rotation policy PolicyTimeLimit, that rotates on a 5-field cron
+// schedule, e.g. "0 */6 * * *" (every 6 hours, on the hour), or "0 0 * * 1-5" (weekdays at midnight).
+// The schedule is evaluated in local time. File names are the same as TimedFile.
+//
+// Returns ParseError if the spec is not valid.
+// If an error occurs, then it returns nil, and an error.
+func CronFile(name, spec string) (lf *LogFile, err error) {
+	if _, err = parseCron(spec); err != nil {
 		return nil, err
 	}
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyTimeLimit, Schedule: spec})
+}
 
-	lf.ltimer = NewLocalTimer(lf.cycle, func() {
-		_ = lf.LogRotate()
-	})
+// Creates a log file with a line (event) limit.
+// After maxLines writes, the file rotates to a new volume, using the same file names as
+// SizeLimitedFile, i.e. "prefix".volNo."log".
+//
+// The line count is recounted from the current file when it is opened, so the limit is
+// accurate across restarts. If the reopened file is already full, it is rotated immediately.
+//
+// If an error occurs, returns nil, and an error.
+func LineLimitedFile(name string, maxLines int) (lf *LogFile, err error) {
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyLineLimit, MaxLines: maxLines})
+}
 
-	msg := fmt.Sprintf("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"timer\":\"%s\"}",
-		"start", lf.policy.String(), lf.currentFile, lf.ltimer.d.String())
-	log.Printf(msg)
-	return
+// Creates a log file with an entry (record) limit, e.g. for chunking by a downstream consumer.
+// Each Write is one entry, so this is the same as LineLimitedFile, with PolicyLineLimit: the
+// count is incremented under the file lock, and the file rotates to the next volume after
+// maxEntries writes.
+//
+// If an error occurs, returns nil, and an error.
+func CountLimitedFile(name string, maxEntries int) (lf *LogFile, err error) {
+	return LineLimitedFile(name, maxEntries)
 }
 
 // Return the policy in effect
@@ -235,65 +272,272 @@ func (lf *LogFile) LogPolicy() PolicyType {
 	return lf.policy
 }
 
+// Set the text that replaces newlines embedded in a log entry, so each entry is a single line.
+// The default is "; ". For example, use " ", " | ", or `\n` (an escaped newline).
+// This is goroutine safe.
+func (lf *LogFile) SetNewlineReplacement(s string) {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.newlineRepl = append([]byte{}, s...)
+}
+
+// Write each entry verbatim, without replacing embedded newlines, or appending one, e.g. for the
+// records of a BinaryFormatter. PolicyLineLimit counts newlines, so do not combine them.
+// This is goroutine safe.
+func (lf *LogFile) SetRawWrites(b bool) {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.rawWrites = b
+}
+
 // Write a message to the log.  This implements the io.Writer interface
+// If the file is not open, e.g. after a failed rotation, it is reopened first.
+// On failure, returns the bytes of p written (at most len(p)), and an error wrapping the cause,
+// e.g. FileNotOpenError, or the I/O error.
 // This is goroutine safe using a mutex lock
 func (lf *LogFile) Write(p []byte) (n int, err error) {
 
 	defer func() {
 		lf.Unlock()
+		// Last resort, e.g. a panicking custom writer.
 		if x := recover(); x != nil {
 			m := fmt.Sprintf("%s: Error writing to file \"%s\". %s",
 				GetCaller(), lf.currentFile, x)
-			log.Printf(m)
+			internalf("%s", m)
 			n, err = 0, errors.New(m)
 			return
 		}
-		if lf.policy == PolicyFileSize && lf.LogRotateCheck() {
+		if err == nil && lf.policy.rotatesOnWrite() && lf.LogRotateCheck() {
 			lf.LogRotate()
 		}
 	}()
 	lf.Lock()
 
-	// strip newlines and add one to the end. Mitigate malformed log events.
-	p = append(bytes.Replace(p, []byte("\n"), []byte("; "), -1), '\n')
+	if lf.closed {
+		return 0, os.ErrClosed
+	}
+	// A zero value LogFile, which has no file name.
+	if lf.filenameGen == nil {
+		return 0, FileNotOpenError
+	}
+	if lf.f == nil {
+		if oErr := lf.openFile(lf.filenameGen()); oErr != nil {
+			return 0, fmt.Errorf("%w: %s", FileNotOpenError, oErr)
+		}
+	}
+
+	entry := p
+	if !lf.rawWrites {
+		// strip newlines and add one to the end. Mitigate malformed log events.
+		repl := lf.newlineRepl
+		if repl == nil {
+			repl = []byte(logNewlineReplacement)
+		}
+		entry = append(bytes.Replace(p, []byte("\n"), repl, -1), '\n')
+	}
 
-	n, err = lf.writeEntry(p)
-	return
+	if err = lf.checkFreeSpace(len(entry)); err != nil {
+		if lf.diskFullFallback == nil {
+			return 0, err
+		}
+		if _, err = lf.diskFullFallback.Write(entry); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if n, err = lf.writeEntry(entry); err != nil {
+		return int(min(int64(n), int64(len(p)))), fmt.Errorf("write \"%s\": %w", lf.currentFile, err)
+	}
+	lf.lineCount++
+	return len(p), nil
 }
 
 // Convenience function.
+// Returns the bytes written, and the error of the write, flush or sync, if any.
 func (lf *LogFile) writeEntry(p []byte) (n int, err error) {
 	n, err = lf.f.Write(p)
 	if err != nil {
-		log.Printf("%s: %s", GetCaller(), err)
-		return 0, err
+		internalf("%s: %s", GetCaller(), err)
+		return n, err
+	}
+	if gf, ok := lf.f.(*gzipFile); ok && time.Since(lf.lastFlush) >= lf.flushInterval {
+		if err = gf.Flush(); err != nil {
+			internalf("%s: %s", GetCaller(), err)
+			return n, err
+		}
+		lf.lastFlush = time.Now()
+	}
+	if lf.syncEveryWrite {
+		if err = lf.syncFile(); err != nil {
+			internalf("%s: %s", GetCaller(), err)
+			return n, err
+		}
 	}
 	return
 }
 
 // Close a log file. This implements the io.Closer interface
 // If there is a timer associated with the LogFile, Close stops the timer.
-// Writes to the log after it is closed may result in an error.
+// The file is synced to storage first, unless disabled with SyncOnClose, and the error of the
+// sync or close is returned.
+// Writes to the log after it is closed return os.ErrClosed.
+// Close is idempotent. Calling it again does nothing, and returns nil.
 // This is goroutine safe.
 func (lf *LogFile) Close() (err error) {
-	defer func() {
-		lf.Unlock()
-		if x := recover(); x != nil {
-			log.Printf("Error closing file \"%s\". %s", lf.currentFile, x)
-			return
-		}
-	}()
 	lf.Lock()
+	defer lf.Unlock()
+
+	if lf.closed {
+		return nil
+	}
+	lf.closed = true
 	if lf.ltimer != nil {
 		lf.ltimer.Stop()
 	}
-	err = lf.f.Close()
+	if lf.f != nil {
+		if !lf.noSyncOnClose {
+			err = lf.syncFile()
+		}
+		if cErr := lf.f.Close(); err == nil {
+			err = cErr
+		}
+	}
+	lf.compressing.Wait()
+	if lf.currentLink && lf.removeLinkOnClose {
+		os.Remove(lf.currentLinkName())
+	}
 	return
 }
 
-// Returns the current log file name that is being written calling the FileWriter LogFilename interface.
+// Request synchronized data writes for the log file, for high-durability (e.g. audit) logs.
+// On Linux the file is reopened with O_DSYNC, so each write returns after the data reaches
+// the storage device. Rotated volumes are opened with the same flag.
 //
+// Portability: O_DSYNC is only applied where supported. On other platforms this returns
+// DataSyncNotSupportedError, and the file is unchanged. Synchronized writes are much slower.
+func (lf *LogFile) SetDataSync() error {
+	if dataSyncFlag == 0 {
+		return DataSyncNotSupportedError
+	}
+	lf.Lock()
+	defer lf.Unlock()
+
+	if lf.openFlags == 0 {
+		lf.openFlags = logDefaultOpenFlags
+	}
+	lf.openFlags |= dataSyncFlag
+	return lf.reopenFile()
+}
+
+// Set the permissions of the log file, e.g. 0600 for compliance. The default is 0660.
+// The current file is changed, and rotated volumes are created with the same mode.
+// Returns InvalidArgumentError if mode has bits other than permissions, or the error
+// changing the current file.
+func (lf *LogFile) SetFileMode(mode os.FileMode) error {
+	if mode == 0 || mode&^os.ModePerm != 0 {
+		return InvalidArgumentError
+	}
+	lf.Lock()
+	defer lf.Unlock()
+
+	lf.fileMode = mode
+	if lf.currentFile == "" {
+		return nil
+	}
+	return os.Chmod(lf.currentFile, mode)
+}
+
+// Set the flags used to open the log file, e.g. os.O_CREATE|os.O_APPEND|os.O_WRONLY|os.O_SYNC
+// for durability. The file is reopened with the flags, and rotated volumes are opened with the
+// same flags.
+// Returns InvalidArgumentError, and the flags are unchanged, unless os.O_CREATE, os.O_APPEND
+// and os.O_WRONLY (or os.O_RDWR) are set, and os.O_TRUNC is not, so an existing file is never
+// truncated. See ForceOpenFlags to override this.
+func (lf *LogFile) SetOpenFlags(flags int) error {
+	if !validOpenFlags(flags) {
+		return InvalidArgumentError
+	}
+	return lf.ForceOpenFlags(flags)
+}
+
+// Set the flags used to open the log file, without the checks of SetOpenFlags, e.g. to
+// truncate the file when it is opened. The file is reopened with the flags.
+func (lf *LogFile) ForceOpenFlags(flags int) error {
+	lf.Lock()
+	defer lf.Unlock()
+
+	lf.openFlags = flags
+	if lf.f == nil {
+		return nil
+	}
+	return lf.reopenFile()
+}
+
+// Flush any buffered (e.g. gzip) data to the file. This implements the Flusher interface
+// This is goroutine safe.
+func (lf *LogFile) Flush() error {
+	lf.Lock()
+	defer lf.Unlock()
+
+	if gf, ok := lf.f.(*gzipFile); ok {
+		return gf.Flush()
+	}
+	return nil
+}
+
+// Flush any buffered (e.g. gzip) data, and sync the file to storage with File.Sync().
+// This gives the caller explicit control over durability points.
+// Returns an error if the file is not open, or the sync fails.
+// This is goroutine safe.
+func (lf *LogFile) Fsync() error {
+	lf.Lock()
+	defer lf.Unlock()
+	return lf.syncFile()
+}
+
+// Sync the file to storage before it is closed. The default is true, so buffered OS writes
+// are not lost on a crash after Close. Close returns the error of the sync, if any.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) SyncOnClose(b bool) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.noSyncOnClose = !b
+	return lf
+}
+
+// Sync the file to storage after each write, for high-durability needs. A gzip file is flushed
+// first. Writes are much slower; see SetDataSync for a cheaper alternative on Linux.
+// Write returns the error of the sync, if any. The default is false.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) SyncEveryWrite(b bool) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.syncEveryWrite = b
+	return lf
+}
+
+// Flush any buffered (e.g. gzip) data, and sync the file to storage.
+// Returns os.ErrInvalid if the file is not open.
+// The caller must synchronize access.
+func (lf *LogFile) syncFile() error {
+	switch f := lf.f.(type) {
+	case *gzipFile:
+		if err := f.Flush(); err != nil {
+			return err
+		}
+		return f.f.Sync()
+	case *sharedHandle:
+		return f.Sync()
+	}
+	return os.ErrInvalid
+}
+
+// Returns the current log file name that is being written calling the FileWriter LogFilename interface.
+// This is goroutine safe, e.g. while another goroutine rotates the file.
 func (lf *LogFile) LogFilename() string {
+	lf.Lock()
+	defer lf.Unlock()
 	return lf.currentFile
 }
 
@@ -307,19 +551,104 @@ func (lf *LogFile) LogRotateCheck() bool {
 			return
 		}
 	}()
+	lf.Lock()
+	paused := lf.paused
+	lf.Unlock()
+	if paused {
+		return false
+	}
 	return lf.rotateCheck()
 }
 
 // Rotates the log file calling the FileWriter LogRotate interface.
-// Returns true if rotated, false otherwise.
+// Returns true if rotated, false otherwise. No rotation occurs while rotation is paused, or
+// after Close, e.g. from a timer that fired during Close.
 func (lf *LogFile) LogRotate() bool {
 	lf.Lock()
 	defer lf.Unlock()
 
+	if lf.paused || lf.closed {
+		return false
+	}
 	rotated := lf.rotate()
 	return rotated
 }
 
+// Rotate the log file now, regardless of the policy's threshold or timer, or PauseRotation,
+// e.g. on a signal from an external tool. A file with PolicyNone does not rotate.
+// Returns the error opening the new file, if any, in which case the next Write retries the open,
+// or os.ErrClosed after Close.
+// This is goroutine safe.
+func (lf *LogFile) ForceRotate() error {
+	lf.Lock()
+	defer lf.Unlock()
+
+	if lf.closed {
+		return os.ErrClosed
+	}
+	if lf.policy.isNone() {
+		return nil
+	}
+	return lf.rotateFile()
+}
+
+// Close and open the current file, with the same name, e.g. after logrotate(8) renamed it, so
+// writes go to a new file of the name. Unlike ForceRotate, the name does not change.
+// Returns the error opening the file, if any, in which case the next Write retries the open,
+// or os.ErrClosed after Close.
+// This is goroutine safe.
+func (lf *LogFile) Reopen() error {
+	lf.Lock()
+	defer lf.Unlock()
+
+	if lf.closed {
+		return os.ErrClosed
+	}
+	if lf.f == nil {
+		return lf.openFile(lf.filenameGen())
+	}
+	return lf.reopenFile()
+}
+
+// Pause log file rotation, e.g. during a batch import.
+// While paused, LogRotateCheck returns false and any rotation timer is suspended.
+// Writes continue to the current file.
+// This is goroutine safe.
+func (lf *LogFile) PauseRotation() {
+	lf.Lock()
+	defer lf.Unlock()
+
+	if lf.paused {
+		return
+	}
+	lf.paused = true
+	if lf.ltimer != nil {
+		lf.ltimer.Stop()
+	}
+}
+
+// Resume log file rotation after PauseRotation.
+// If a rotation threshold was crossed while paused, the file is rotated immediately.
+// Otherwise the timer, if any, is re-armed for the remaining time.
+// Returns true if the file was rotated on resume, else false.
+// The check and rotation are under the lock, so a concurrent PauseRotation applies after them.
+func (lf *LogFile) ResumeRotation() bool {
+	lf.Lock()
+	defer lf.Unlock()
+
+	if !lf.paused || lf.closed {
+		return false
+	}
+	lf.paused = false
+	if lf.rotateCheck() {
+		return lf.rotate()
+	}
+	if lf.ltimer != nil {
+		lf.ltimer.resume()
+	}
+	return false
+}
+
 // Check for scheduled log file rotation, i.e. PolicyDaily
 // Returns true of the rotate time is after the current time.
 //
@@ -327,7 +656,12 @@ func (lf *LogFile) timedRotateCheck() bool {
 	if lf.ltimer == nil {
 		return false
 	}
-	return time.Now().Round(time.Minute).After(lf.ltimer.TriggerTime())
+	t := time.Now()
+	// Sub-minute cycles are not aligned to the minute.
+	if lf.cycle <= 0 || lf.cycle >= time.Minute {
+		t = t.Round(time.Minute)
+	}
+	return t.After(lf.ltimer.TriggerTime())
 }
 
 // Rotates the log file.
@@ -336,13 +670,41 @@ func (lf *LogFile) timedRotateCheck() bool {
 // Returns true if the file was changed, i.e. rotated.
 // Assumes the caller synchronizes access.
 func (lf *LogFile) timedRotate() (b bool) {
+	lf.rotateFile()
+	// Return true, indicating a file change
+	return true
+}
+
+// Rotates the log file, as timedRotate.
+// Returns the error opening the new file, if any. The next Write retries the open.
+// Returns os.ErrClosed, and no file is opened, after Close.
+// Assumes the caller synchronizes access.
+func (lf *LogFile) rotateFile() (err error) {
+	if lf.closed {
+		return os.ErrClosed
+	}
 	var dur time.Duration
-	log.Printf("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\"}",
+	internalEvent("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\"}",
 		"rotate_start", lf.policy.String(), lf.currentFile)
 
+	prev := lf.currentFile
 	lf.closeFile()
-	lf.openFile(lf.filenameGen())
-	b = true
+	err = lf.openFile(lf.filenameGen())
+
+	// Compress the previous volume, unless it was reopened, e.g. the same daily file.
+	// The mode is read here, under the lock, not by the goroutine.
+	if lf.compressOnRotate && !lf.gzipped && prev != lf.currentFile {
+		mode := lf.mode()
+		lf.compressing.Add(1)
+		go func() {
+			defer lf.compressing.Done()
+			compressVolume(prev, mode)
+		}()
+	}
+
+	if lf.maxBackups > 0 || lf.maxAge > 0 {
+		lf.removeOldVolumes()
+	}
 
 	// If there is a timer, set a new timer.
 	if lf.ltimer != nil {
@@ -350,13 +712,249 @@ func (lf *LogFile) timedRotate() (b bool) {
 		dur = lf.ltimer.Duration()
 	}
 
-	msg := fmt.Sprintf("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"timer\":\"%s\"}",
+	internalEvent("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"timer\":\"%s\"}",
 		"rotate_end", lf.policy.String(), lf.currentFile, dur)
-	log.Printf(msg)
-	// Return true, indicating a file change
 	return
 }
 
+// Set the number of rotated volumes to keep. After each rotation, the oldest volumes
+// (by ModTime) beyond n are deleted. A volume and its compressed copy count as one.
+// Zero, the default, keeps all volumes.
+// Returns the LogFile, so settings can be chained, e.g. lf.MaxBackups(7).MaxAge(24 * time.Hour)
+func (lf *LogFile) MaxBackups(n int) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.maxBackups = n
+	return lf
+}
+
+// Set the maximum age of rotated volumes. After each rotation, volumes last modified
+// more than d ago are deleted. Zero, the default, keeps all volumes.
+// If MaxBackups is also set, a volume is deleted if either limit is exceeded.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) MaxAge(d time.Duration) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.maxAge = d
+	return lf
+}
+
+// Set the mode of the parent directories of the log file, which are created if they do not
+// exist, e.g. when a rotated volume is opened after the directory was removed.
+// The directories of the first file are created by the constructor, with the default mode 0750.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) SetDirMode(mode os.FileMode) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.dirMode = mode
+	return lf
+}
+
+// Set the minimum free space, in bytes, on the log file's filesystem.
+// Before each write, if free space is below the minimum, retention cleanup (see MaxBackups
+// and MaxAge) runs. If free space is still below the minimum, Write returns
+// InsufficientDiskSpaceError, rather than filling the disk, or writes to the fallback writer
+// (see DiskFullFallback). Zero, the default, disables the check.
+// A warning is logged once when writes stop, and once when they resume, not on every write.
+// If the free space cannot be determined, e.g. statfs fails, the write proceeds.
+//
+// Cost: the check is a statfs system call, made with the file locked. So it is not made on
+// every write, a check is reused for up to a second, while the free space it found, less the
+// bytes written since, is above the minimum. Space used by other processes in that time is not
+// seen. While writes are stopped, every write checks, so writes resume once space is freed.
+//
+// Portability: free space is checked with statfs on Linux. On other platforms, it is not checked.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) SetMinFreeSpace(bytes uint64) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.minFreeSpace = bytes
+	return lf
+}
+
+// Set a writer, e.g. Stderr(), or a file on another volume, that receives the messages while
+// writes are stopped for low free space (see SetMinFreeSpace). Nil, the default, drops them,
+// and Write returns InsufficientDiskSpaceError.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) DiskFullFallback(w io.Writer) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.diskFullFallback = w
+	return lf
+}
+
+// Maintain a symbolic link, "prefix.current.log", to the current file, so external tailers can
+// follow a stable name while the file rotates. The link is re-pointed atomically (a temporary
+// link is renamed over it) each time a file is opened. If removeOnClose is true, Close removes
+// the link. Disabling it removes the link.
+//
+// Portability: if symbolic links are not supported, e.g. on some filesystems, a warning is
+// logged, and the link is not maintained.
+// Returns the LogFile, so settings can be chained.
+func (lf *LogFile) CurrentLink(enable, removeOnClose bool) *LogFile {
+	lf.Lock()
+	defer lf.Unlock()
+	if lf.currentLink && !enable {
+		os.Remove(lf.currentLinkName())
+	}
+	lf.currentLink = enable
+	lf.removeLinkOnClose = removeOnClose
+	if enable && lf.currentFile != "" {
+		lf.updateCurrentLink()
+	}
+	return lf
+}
+
+// Returns the name of the link to the current file.
+func (lf *LogFile) currentLinkName() string {
+	return genFilename(lf.prefix, "current")
+}
+
+// Point the link at the current file. The target is relative, since both are in the same directory.
+// If the link cannot be created, it is disabled.
+// The caller must synchronize access.
+func (lf *LogFile) updateCurrentLink() {
+	link := lf.currentLinkName()
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	err := os.Symlink(filepath.Base(lf.currentFile), tmp)
+	if err == nil {
+		err = os.Rename(tmp, link)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		lf.currentLink = false
+		internalf("%s: (\"%s\") %s. The current link is disabled.", GetCaller(), link, err)
+	}
+}
+
+// Check free space before a write of n bytes, and run retention cleanup if it is low.
+// The last check is reused for logFreeSpaceCheckInterval, while the free bytes, less the bytes
+// written since, are above the minimum.
+// Returns InsufficientDiskSpaceError if it is still below the minimum, else nil.
+// The caller must synchronize access.
+func (lf *LogFile) checkFreeSpace(n int) error {
+	if lf.minFreeSpace == 0 {
+		return nil
+	}
+	if lf.freeSpace >= lf.minFreeSpace && time.Since(lf.freeChecked) < logFreeSpaceCheckInterval {
+		lf.useFreeSpace(n)
+		return nil
+	}
+	lf.freeSpace = 0
+	dir := filepath.Dir(lf.currentFile)
+	free, err := diskFree(dir)
+	if err != nil || free >= lf.minFreeSpace {
+		// Unknown free space does not stop logging.
+		lf.setDiskFull(false, free)
+		lf.setFreeSpace(free, err, n)
+		return nil
+	}
+
+	lf.removeOldVolumes()
+	if free, err = diskFree(dir); err != nil || free >= lf.minFreeSpace {
+		lf.setDiskFull(false, free)
+		lf.setFreeSpace(free, err, n)
+		return nil
+	}
+	lf.setDiskFull(true, free)
+	return InsufficientDiskSpaceError
+}
+
+// Record the free bytes of a successful check, less the n bytes to write, for checkFreeSpace.
+// An unknown free space is not reused.
+// The caller must synchronize access.
+func (lf *LogFile) setFreeSpace(free uint64, err error, n int) {
+	if err != nil {
+		return
+	}
+	lf.freeSpace, lf.freeChecked = free, time.Now()
+	lf.useFreeSpace(n)
+}
+
+// Subtract n bytes written from the free bytes of the last check.
+// The caller must synchronize access.
+func (lf *LogFile) useFreeSpace(n int) {
+	if uint64(n) > lf.freeSpace {
+		lf.freeSpace = 0
+		return
+	}
+	lf.freeSpace -= uint64(n)
+}
+
+// Record whether writes are stopped for low free space, and log the change, if any.
+// The caller must synchronize access.
+func (lf *LogFile) setDiskFull(full bool, free uint64) {
+	if full == lf.diskFull {
+		return
+	}
+	lf.diskFull = full
+	action := "write_resumed"
+	if full {
+		action = "write_stopped"
+	}
+	internalEvent("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\", \"free\":\"%d\"}",
+		action, lf.policy.String(), lf.currentFile, free)
+}
+
+// Delete rotated volumes beyond maxBackups, or older than maxAge.
+// The current file is never deleted.
+// The caller must synchronize access.
+func (lf *LogFile) removeOldVolumes() {
+	matches, err := volumeNames(lf.prefix)
+	if err != nil {
+		return
+	}
+	// A volume and its ".gz", e.g. while CompressOnRotate is compressing it, count as one
+	// volume, with the newer ModTime, and are removed together.
+	type volume struct {
+		names   []string
+		modTime time.Time
+	}
+	var volumes []*volume
+	var byName = make(map[string]*volume)
+	for _, m := range matches {
+		if m == lf.currentFile {
+			continue
+		}
+		fi, sErr := os.Lstat(m)
+		if sErr != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		key := strings.TrimSuffix(m, "."+logFilenameGzipExtension)
+		v := byName[key]
+		if v == nil {
+			v = &volume{}
+			byName[key] = v
+			volumes = append(volumes, v)
+		}
+		v.names = append(v.names, m)
+		if fi.ModTime().After(v.modTime) {
+			v.modTime = fi.ModTime()
+		}
+	}
+
+	// Newest first
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].modTime.After(volumes[j].modTime)
+	})
+	for i, v := range volumes {
+		tooMany := lf.maxBackups > 0 && i >= lf.maxBackups
+		tooOld := lf.maxAge > 0 && time.Since(v.modTime) > lf.maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		for _, name := range v.names {
+			if err = os.Remove(name); err != nil {
+				internalf("%s: %s", GetCaller(), err)
+				continue
+			}
+			internalEvent("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\"}",
+				"remove", lf.policy.String(), name)
+		}
+	}
+}
+
 func (lf *LogFile) sizeRotateCheck() bool {
 	var ready bool = false
 	// Safety check
@@ -366,9 +964,8 @@ func (lf *LogFile) sizeRotateCheck() bool {
 
 	fi, err := os.Stat(lf.currentFile)
 	if err != nil {
-		log.Panicf("Error getting log file size for \"%s\". %s.\n",
-			lf.currentFile, err)
-		// Assume failure, and indicate ready to rotate.
+		internalf("%s: Error getting log file size for \"%s\". %s.", GetCaller(), lf.currentFile, err)
+		// Assume failure, e.g. the file was removed, and indicate ready to rotate.
 		return true
 	}
 	ready = ((fi.Size())+logHighWaterMark > lf.fileSizeLimit)
@@ -376,6 +973,32 @@ func (lf *LogFile) sizeRotateCheck() bool {
 	return ready
 }
 
+// Check if the line limit is reached, i.e. PolicyLineLimit
+func (lf *LogFile) lineRotateCheck() bool {
+	if lf.policy != PolicyLineLimit {
+		return false
+	}
+	return lf.lineCount >= lf.maxLines
+}
+
+// Count the lines in a file. Returns 0 if the file cannot be read.
+func countLines(filename string) (n int) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	buf := make([]byte, 32*Kbyte)
+	for {
+		c, err := f.Read(buf)
+		n += bytes.Count(buf[:c], []byte("\n"))
+		if err != nil {
+			return
+		}
+	}
+}
+
 // Log File Operations - Open/close.
 // Thew NewLogFile() and NewDailyLogFile routines call openFile
 // The Close() routine implements the io.Closer interface.
@@ -384,17 +1007,59 @@ func (lf *LogFile) sizeRotateCheck() bool {
 // If successful, returns a nil, else an error.
 // The caller must synchronize access.
 func (lf *LogFile) openFile(filename string) (err error) {
-	lf.f, err = os.OpenFile(filename, logDefaultOpenFlags, logDefaultFileMode)
+	flags := lf.openFlags
+	if flags == 0 {
+		flags = logDefaultOpenFlags
+	}
+	if strings.HasSuffix(lf.prefix, string(filepath.Separator)) {
+		// A directory, with no file name.
+		return InvalidArgumentError
+	}
+	dirMode := lf.dirMode
+	if dirMode == 0 {
+		dirMode = logDefaultDirMode
+	}
+	if dir := filepath.Dir(filename); dir != "." {
+		if err = os.MkdirAll(dir, dirMode); err != nil {
+			err = fmt.Errorf("create directory \"%s\": %w", dir, err)
+			internalf("%s: (\"%s\") %s.", GetCaller(), filename, err)
+			return
+		}
+	}
+	if lf.gzipped {
+		var f *os.File
+		if f, err = osOpenFile(filename, flags, lf.mode()); err == nil {
+			lf.f = newGzipFile(f)
+		}
+	} else {
+		var sh *sharedHandle
+		if sh, err = openSharedFile(filename, flags, lf.mode()); err == nil {
+			lf.f = sh
+		}
+	}
 	if err != nil {
-		log.Printf("filelogger.openFile failed with file name \"%s\"", filename)
-		os.Stderr.WriteString(fmt.Sprintf("%s: (\"%s\") %s.\n",
-			GetCaller(), filename, err))
+		internalf("filelogger.openFile failed with file name \"%s\"", filename)
+		internalf("%s: (\"%s\") %s.", GetCaller(), filename, err)
 		return
 	}
 	lf.currentFile = filename
+	if lf.policy == PolicyLineLimit {
+		lf.lineCount = countLines(filename)
+	}
+	if lf.currentLink {
+		lf.updateCurrentLink()
+	}
 	return
 }
 
+// Returns the mode of created files.
+func (lf *LogFile) mode() os.FileMode {
+	if lf.fileMode == 0 {
+		return logDefaultFileMode
+	}
+	return lf.fileMode
+}
+
 // Close a log file.
 // The caller must synchronize access.
 func (lf *LogFile) closeFile() (err error) {
@@ -404,17 +1069,29 @@ func (lf *LogFile) closeFile() (err error) {
 	}()
 
 	if lf.f == nil {
-		log.Panicf("Invalid writer. {%s}", lf.currentFile)
+		return FileNotOpenError
 	}
 
 	if err = lf.f.Close(); err != nil {
-		os.Stderr.WriteString(fmt.Sprintf("%s: (\"%s\") %s.\n",
-			GetCaller(), lf.currentFile, err))
+		internalf("%s: (\"%s\") %s.", GetCaller(), lf.currentFile, err)
 		return err
 	}
 	return nil
 }
 
+// Close and open the current file, e.g. to apply new open flags.
+// The caller must synchronize access.
+func (lf *LogFile) reopenFile() (err error) {
+	if lf.closed {
+		return os.ErrClosed
+	}
+	name := lf.currentFile
+	if err = lf.closeFile(); err != nil {
+		return
+	}
+	return lf.openFile(name)
+}
+
 // Log file name utilities
 //
 //
@@ -433,6 +1110,25 @@ func genFilename(prefix string, parts ...string) string {
 	return fmtStr
 }
 
+// Returns the volumes of a prefix, i.e. the files named with a volume number, date, or
+// timestamp, including compressed volumes. The files of another log whose prefix starts with
+// this one, e.g. "prefix.audit.0001.log", are not included.
+func volumeNames(prefix string) ([]string, error) {
+	matches, err := filepath.Glob(prefix + ".*")
+	if err != nil {
+		return nil, err
+	}
+	// Glob cleans the directory, so the base names are compared.
+	base := filepath.Base(prefix)
+	var names []string
+	for _, m := range matches {
+		if name := filepath.Base(m); strings.HasPrefix(name, base) && volumeNameRegexp.MatchString(name[len(base):]) {
+			names = append(names, m)
+		}
+	}
+	return names, nil
+}
+
 // Create a static log file name, i.e. PolicyNone, PolicyFileSize
 // The filename is prefix "." volume_number ".log".
 // Prefix is the path + base filename.
@@ -449,36 +1145,54 @@ func (lf *LogFile) getStaticFilename() string {
 	return s
 }
 
-// Calculate the volune number for the next log volume.
-// Determines the next number in sequence based by finding the file with the oldeset ModTime,
-// extracts the volume number, and then returns the next one in sequence.
+// Create a gzip compressed log file name, i.e. GzipFile and GzipSizeLimitedFile.
+// The file returned is: prefix "." volume ".log.gz", numbered as getStaticFilename.
+func (lf *LogFile) getGzipFilename() string {
+	if lf.volNo == 0 {
+		lf.volNo = 1
+	} else {
+		lf.volNo = calcNextGzipVolumeNo(lf.prefix)
+	}
+
+	v := int64(lf.volNo)
+	return genFilename(lf.prefix, fmt.Sprintf(logFilenameVolumeFormat, v)) + "." + logFilenameGzipExtension
+}
+
+// Calculate the volume number for the next log volume.
+// Determines the next number in sequence by finding the volume with the highest number,
+// and then returns the next one in sequence, wrapping after logMaxVolNumber.
 // Returns in the range of 1 through 9999. Zero (0) is a reserved volume number.
 func calcNextVolumeNo(prefix string) (volNo int16) {
-	// Get a list of files
-	matches, err := filepath.Glob(genFilename(prefix, "*"))
+	// Get a list of files. The pattern ends in ".log", so compressed (.log.gz) volumes,
+	// which may still be written by compressVolume, are ignored.
+	return nextVolumeNo(genFilename(prefix, "*"))
+}
+
+// Calculate the volume number for the next gzip compressed volume, i.e. of a GzipFile, whose
+// volumes all end in ".log.gz".
+func calcNextGzipVolumeNo(prefix string) (volNo int16) {
+	return nextVolumeNo(genFilename(prefix, "*") + "." + logFilenameGzipExtension)
+}
+
+// Returns the volume number after the highest of the files matching the glob pattern.
+func nextVolumeNo(pattern string) (volNo int16) {
+	matches, err := filepath.Glob(pattern)
 	if err != nil || matches == nil {
 		return 1
 	}
 
-	// Find the newest file
-	var fi os.FileInfo
-	var oldestFile string = matches[0]
-	oldestFi, _ := os.Stat(matches[0])
+	// Find the highest volume number
+	var n int64
 	for _, f := range matches {
-		if fi, _ = os.Stat(f); fi.ModTime().After(oldestFi.ModTime()) {
-			oldestFi, oldestFile = fi, f
+		list := volumeNoRegexp.FindStringSubmatch(strings.TrimSuffix(f, "."+logFilenameGzipExtension))
+		if list == nil {
 			continue
 		}
+		if v, _ := strconv.ParseInt(list[1], 10, 16); v > n {
+			n = v
+		}
 	}
-
-	// Get the volume number from the filename, and then increment.
-	list := regexp.MustCompile("\\.([0-9]+)\\.log").FindAllStringSubmatch(oldestFile, -1)
-	n, _ := strconv.ParseInt(list[0][1], 10, 16)
-	volNo = int16(math.Mod(float64(n), float64(logMaxVolNumber))) + 1
-	if volNo == 0 {
-		volNo = 1
-	}
-	return
+	return int16(n%int64(logMaxVolNumber)) + 1
 }
 
 // Craete a daily log file name, i.e. PolicyDaily
@@ -486,22 +1200,110 @@ func calcNextVolumeNo(prefix string) (volNo int16) {
 // the date part takes the form of YYYY-MM-DD.
 //
 func (lf *LogFile) getDailyFilename() string {
-	// Get just the date portion.
-	s := time.Now().Format(time.RFC3339)[:len(logFilenameDailyFormat)]
-	return genFilename(lf.prefix, s)
+	return genFilename(lf.prefix, now().Format(logFilenameDailyFormat))
 }
 
 // Craete a daily log file name, i.e. PolicyTimeLimit.
 // The filename includes a date and timestamp. The policy expects the file to be rotated based
 // on a set time schedule.
-// The file returned is: prefix "." date "T" time ".log". THe ":" in the time is replaced with an
-// alternate character. the date part takes the form of YYYY-MM-DDThh_mm_ss.
+// The file returned is: prefix "." date "T" time ".log". The time is separated with "." rather
+// than ":", which is not allowed in some file systems. It takes the form of YYYY-MM-DDThh.mm.ss.
 //
 func (lf *LogFile) getTimedFilename() string {
-	// Get just the date portion.
-	s := time.Now().Format(time.RFC3339)[:len(logFilenameTimeFormat)]
-	s = strings.Replace(s, ":", "_", -1)
-	return genFilename(lf.prefix, s)
+	return genFilename(lf.prefix, now().Format(logFilenameTimeFormat))
+}
+
+// Returns the total size, and number of log files for a prefix, including compressed (.gz)
+// volumes, e.g. to alert before a disk fills. Symbolic links are not counted.
+// The prefix is the path and base filename passed to the log file constructor.
+func LogFootprint(prefix string) (totalBytes int64, fileCount int, err error) {
+	matches, err := volumeNames(prefix)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, m := range matches {
+		fi, sErr := os.Lstat(m)
+		if sErr != nil {
+			// Removed since the glob, e.g. by a retention cleanup.
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		totalBytes += fi.Size()
+		fileCount++
+	}
+	return
+}
+
+// Merge the volumes of a prefix, in order, into a single file at outPath, e.g. to archive a
+// day's logs as one artifact. Volumes are ordered by name, i.e. volume number or date.
+// Compressed (.log.gz) volumes are decompressed. If compress is true, the output is gzip compressed.
+//
+// Volumes are only read, so the live file is not changed. Its contents up to the merge are included.
+// Returns an error if there are no volumes, or a volume cannot be read or the output written.
+func MergeVolumes(prefix, outPath string, compress bool) (err error) {
+	matches, err := volumeNames(prefix)
+	if err != nil {
+		return err
+	}
+	var volumes []string
+	for _, m := range matches {
+		if filepath.Clean(m) == filepath.Clean(outPath) {
+			continue
+		}
+		// Skip links, e.g. the current link, which would duplicate a volume.
+		if fi, sErr := os.Lstat(m); sErr != nil || fi.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		volumes = append(volumes, m)
+	}
+	if len(volumes) == 0 {
+		return os.ErrNotExist
+	}
+	sort.Strings(volumes)
+
+	f, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, logDefaultFileMode)
+	if err != nil {
+		return err
+	}
+	var w io.WriteCloser = f
+	if compress {
+		w = newGzipFile(f)
+	}
+	defer func() {
+		if cErr := w.Close(); err == nil {
+			err = cErr
+		}
+	}()
+
+	for _, v := range volumes {
+		if err = appendVolume(w, v); err != nil {
+			return fmt.Errorf("%s: %s", v, err)
+		}
+	}
+	return nil
+}
+
+// Copy a volume to w, decompressing a .gz volume.
+func appendVolume(w io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(name, "."+logFilenameGzipExtension) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	_, err = io.Copy(w, r)
+	return err
 }
 
 func max(x, y int64) (z int64) {
@@ -511,3 +1313,11 @@ func max(x, y int64) (z int64) {
 	}
 	return
 }
+
+func min(x, y int64) (z int64) {
+	z = x
+	if y < x {
+		z = y
+	}
+	return
+}
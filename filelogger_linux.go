@@ -0,0 +1,15 @@
+package logger
+
+import "syscall"
+
+// Open flag for synchronized data writes.
+const dataSyncFlag = syscall.O_DSYNC
+
+// Returns the bytes available to an unprivileged user on the filesystem containing path.
+func statfsFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestLogFile_SetDataSync(t *testing.T) {
+	testName := "TestSetDataSync"
+
+	var flags int
+	defer func() {
+		osOpenFile = os.OpenFile
+	}()
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		flags = flag
+		return os.OpenFile(name, flag, perm)
+	}
+
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer func() {
+		l.Close()
+		os.Remove(name)
+	}()
+	gotestutil.AssertEqual(t, 0, flags&syscall.O_DSYNC, "Expected O_DSYNC not set by default")
+
+	err = l.SetDataSync()
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertEqual(t, syscall.O_DSYNC, flags&syscall.O_DSYNC, "Expected O_DSYNC passed to OpenFile")
+	gotestutil.AssertEqual(t, logDefaultOpenFlags, flags&logDefaultOpenFlags, "Expected default flags kept")
+	gotestutil.AssertEqual(t, name, l.LogFilename(), "Expected the same file reopened")
+
+	_, err = l.Write([]byte("synchronized write"))
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+}
+
+func TestLog_ReopenOnSignal(t *testing.T) {
+	testName := "TestLog_ReopenOnSignal"
+	lf, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := lf.LogFilename()
+	rotated := name + ".1"
+	defer os.Remove(name)
+	defer os.Remove(rotated)
+	l := LogManger(testName, lf)
+	defer l.Close()
+	stop := l.ReopenOnSignal()
+	defer stop()
+
+	gotestutil.AssertNil(t, os.Rename(name, rotated), GetCaller()+" Error renaming")
+	gotestutil.AssertNil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP), GetCaller()+" Error signaling")
+	for i := 0; i < 500; i++ {
+		if _, err = os.Stat(name); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected the file reopened on SIGHUP")
+}
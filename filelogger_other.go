@@ -0,0 +1,11 @@
+//go:build !linux
+
+package logger
+
+// Synchronized data writes are not supported on this platform.
+const dataSyncFlag = 0
+
+// Free space is not checked on this platform.
+func statfsFree(path string) (uint64, error) {
+	return 0, DiskSpaceNotSupportedError
+}
@@ -1,11 +1,16 @@
 package logger
 
 import (
+	"compress/gzip"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/mooredwightd/gotestutil"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -120,6 +125,28 @@ func TestLimitedFile(t *testing.T) {
 	})
 }
 
+func TestSizeLimitedFile_Limit(t *testing.T) {
+	testName := "TestSizeLimitedFile_Limit"
+	tests := []struct {
+		size     int64
+		expected int64
+	}{
+		{3 * Kbyte, LogMinFileSize},
+		{LogMinFileSize, LogMinFileSize},
+		{LogMinFileSize + 1, 2 * LogMinFileSize},
+		{100 * Mbyte, 100 * Mbyte},
+		{LogMaxFileSize, LogMaxFileSize},
+		{2 * LogMaxFileSize, LogMaxFileSize},
+	}
+	for _, tt := range tests {
+		l, err := SizeLimitedFile(testName, tt.size)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+		gotestutil.AssertEqual(t, tt.expected, l.fileSizeLimit, fmt.Sprintf("Size limit for %d", tt.size))
+		l.Close()
+		os.Remove(l.LogFilename())
+	}
+}
+
 func TestLogFile_Write(t *testing.T) {
 	testName := "TestStaticWrite01"
 
@@ -140,6 +167,110 @@ func TestLogFile_Write(t *testing.T) {
 	}
 }
 
+func TestLogFile_OpenWriteOnly(t *testing.T) {
+	testName := "TestLogFile_OpenWriteOnly"
+
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File:\"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer os.Remove(name)
+
+	// The default flags open the file for writing, so the write reaches the file.
+	_, err = l.Write([]byte("Test log message."))
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s: Error on write. %s", GetCaller(), err))
+	l.Close()
+	b, err := os.ReadFile(name)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	gotestutil.AssertEqual(t, "Test log message.\n", string(b), "Expected the message in "+name)
+}
+
+// A WriteCloser that writes n bytes, and fails.
+type shortWriter struct {
+	n   int
+	err error
+}
+
+func (sw *shortWriter) Write(p []byte) (int, error) { return sw.n, sw.err }
+func (sw *shortWriter) Close() error                { return nil }
+
+func TestLogFile_WriteError(t *testing.T) {
+	testName := "TestLogFile_WriteError"
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File:\"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer func() {
+		osOpenFile = os.OpenFile
+		l.Close()
+		os.Remove(name)
+	}()
+
+	// An I/O error is returned, with the bytes written.
+	ioErr := errors.New("device full")
+	l.f = &shortWriter{n: 3, err: ioErr}
+	n, err := l.Write([]byte("message"))
+	gotestutil.AssertEqual(t, 3, n, "Expected the bytes written")
+	gotestutil.AssertTrue(t, errors.Is(err, ioErr), fmt.Sprintf("Expected the I/O error, got %v", err))
+
+	// A file that is not open, and cannot be reopened.
+	l.closeFile()
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, os.ErrPermission
+	}
+	n, err = l.Write([]byte("message"))
+	gotestutil.AssertEqual(t, 0, n, "Expected no bytes written")
+	gotestutil.AssertTrue(t, errors.Is(err, FileNotOpenError), fmt.Sprintf("Expected not open, got %v", err))
+
+	// The file is reopened, and n is the length of p, not of the entry with its newline.
+	osOpenFile = os.OpenFile
+	n, err = l.Write([]byte("message"))
+	gotestutil.AssertNil(t, err, "Expected the file reopened")
+	gotestutil.AssertEqual(t, len("message"), n, "Expected len(p)")
+}
+
+func TestLogFile_SetNewlineReplacement(t *testing.T) {
+	testName := "TestNewlineReplacement"
+	tests := []struct {
+		repl     string
+		expected string
+	}{
+		{"", "line 1; line 2; line 3\n"}, // Default
+		{" | ", "line 1 | line 2 | line 3\n"},
+		{`\n`, `line 1\nline 2\nline 3` + "\n"},
+	}
+
+	for i, tc := range tests {
+		l, err := File(fmt.Sprintf("%s%02d", testName, i))
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File:\"%s\"\n", err, testName))
+		name := l.LogFilename()
+		if tc.repl != "" {
+			l.SetNewlineReplacement(tc.repl)
+		}
+		l.Write([]byte("line 1\nline 2\nline 3"))
+		l.Close()
+
+		b, err := ioutil.ReadFile(name)
+		os.Remove(name)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File:\"%s\"\n", err, name))
+		gotestutil.AssertEqual(t, tc.expected, string(b), "Expected the newline replacement "+tc.repl)
+	}
+}
+
+func TestLogFile_Fsync(t *testing.T) {
+	testName := "TestFsync"
+
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File:\"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer os.Remove(name)
+
+	l.Write([]byte("Fsync test message."))
+	gotestutil.AssertNil(t, l.Fsync(), "Expected Fsync on an open file to succeed")
+	l.Close()
+	gotestutil.AssertNotNil(t, l.Fsync(), "Expected Fsync on a closed file to fail")
+
+	gotestutil.AssertNotNil(t, (&LogFile{}).Fsync(), "Expected Fsync on an unopened file to fail")
+}
+
 func TestTimedFile(t *testing.T) {
 	var timeSpan = 1 * time.Minute
 	var numRuns = 3
@@ -210,6 +341,24 @@ func TestDailyFile(t *testing.T) {
 	gotestutil.AssertNil(t, ok1, fmt.Sprintf("%s; File: \"%s\".", ok1, name1))
 }
 
+func TestDailyFileAt(t *testing.T) {
+	testName := "TestDailyFileAt"
+
+	_, err := DailyFileAt(testName, 24, 0)
+	gotestutil.AssertEqual(t, InvalidArgumentError, err, "Expected an invalid hour error")
+
+	l, err := DailyFileAt(testName, 2, 30)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("Error opening \"%s\"\n", testName))
+	defer os.Remove(l.LogFilename())
+	defer l.Close()
+
+	gotestutil.AssertTrue(t, l.LogPolicy().IsDaily(), "Expected Daily file policy, got "+l.LogPolicy().String())
+	tt := l.ltimer.TriggerTime()
+	gotestutil.AssertEqual(t, 2, tt.Hour(), "Expected rotation at 02:30, got "+tt.String())
+	gotestutil.AssertEqual(t, 30, tt.Minute(), "Expected rotation at 02:30, got "+tt.String())
+	gotestutil.AssertFalse(t, l.LogRotateCheck(), "Expected no rotation before the trigger time")
+}
+
 func TestDailyFile2(t *testing.T) {
 	testName := "TestDailyLog02"
 
@@ -249,3 +398,835 @@ func TestDailyFile2(t *testing.T) {
 	gotestutil.AssertNil(t, ok2, fmt.Sprintf("%s; File: \"%s\".", ok2, name2))
 
 }
+
+func TestTimedFile_SubMinute(t *testing.T) {
+	testName := "TestTimedFile_SubMinute"
+	cycle := 2 * time.Second
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+
+	l, err := TimedFile(testName, cycle)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	defer l.Close()
+	gotestutil.AssertFalse(t, l.LogRotateCheck(), GetCaller()+" Expected no rotation before the cycle")
+	gotestutil.AssertTrue(t, l.ltimer.TriggerTime().Sub(time.Now()) > time.Second,
+		GetCaller()+" Expected the trigger time not aligned to the minute")
+
+	name1 := l.LogFilename()
+	l.Write([]byte("Message 1"))
+	time.Sleep(cycle + cycle/2)
+	l.Write([]byte("Message 2"))
+	name2 := l.LogFilename()
+
+	gotestutil.AssertStringsNotEqual(t, name1, name2, fmt.Sprintf("File 1: \"%s\" File 2 \"%s\".", name1, name2))
+	gotestutil.AssertEqual(t, 1, countLines(name1), GetCaller()+" Expected a line in "+name1)
+	gotestutil.AssertEqual(t, 1, countLines(name2), GetCaller()+" Expected a line in "+name2)
+}
+
+func TestLogFile_TimeFilenames(t *testing.T) {
+	defer func() {
+		now = time.Now
+	}()
+	now = func() time.Time {
+		return time.Date(2017, 3, 4, 5, 6, 7, 8000000, time.Local)
+	}
+	lf := &LogFile{prefix: "logs/app"}
+
+	gotestutil.AssertEqual(t, "logs/app.2017-03-04.log", lf.getDailyFilename(), "Daily file name")
+	gotestutil.AssertEqual(t, "logs/app.2017-03-04T05.06.07.008.log", lf.getTimedFilename(), "Timed file name")
+}
+
+func TestCalcNextVolumeNo(t *testing.T) {
+	testName := "TestCalcNextVolumeNo"
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+	gotestutil.AssertEqual(t, int16(1), calcNextVolumeNo(testName), "Expected 1 with no volumes")
+
+	// Newest first, so ModTime does not determine the next volume.
+	now := time.Now()
+	for i, v := range []string{".0001.log", ".0010.log", ".0002.log", ".2017-03-04.log", ".0020.log.gz"} {
+		name := testName + v
+		gotestutil.AssertNil(t, ioutil.WriteFile(name, nil, 0660), "Error writing "+name)
+		mt := now.Add(-time.Duration(i) * time.Minute)
+		gotestutil.AssertNil(t, os.Chtimes(name, mt, mt), "Error setting time "+name)
+	}
+	gotestutil.AssertEqual(t, int16(11), calcNextVolumeNo(testName), "Expected the volume after 0010")
+
+	name := testName + ".9999.log"
+	gotestutil.AssertNil(t, ioutil.WriteFile(name, nil, 0660), "Error writing "+name)
+	gotestutil.AssertEqual(t, int16(1), calcNextVolumeNo(testName), "Expected to wrap after 9999")
+}
+
+func TestLogFile_PauseRotation(t *testing.T) {
+	testName := "TestPauseRotation"
+	var names = make(map[int]string, 2)
+
+	l, err := SizeLimitedFile(testName, LogMinFileSize)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertNotNil(t, l, fmt.Sprintf("*LogFile is nil: \"%s\"\n", testName))
+	// Use the minimum size so a few writes cross the limit.
+	l.fileSizeLimit = LogMinFileSize
+	defer func() {
+		l.Close()
+		for _, v := range names {
+			os.Remove(v)
+		}
+	}()
+
+	names[0] = l.LogFilename()
+	l.PauseRotation()
+	for i := 0; i < 10; i++ {
+		l.Write([]byte(strings.Repeat(strconv.Itoa(i), int(256*Kbyte))))
+	}
+	gotestutil.AssertFalse(t, l.LogRotateCheck(), "Expected no rotation check while paused")
+	gotestutil.AssertEqual(t, names[0], l.LogFilename(), "Expected no rotation while paused")
+
+	rotated := l.ResumeRotation()
+	names[1] = l.LogFilename()
+	gotestutil.AssertTrue(t, rotated, "Expected rotation on resume")
+	gotestutil.AssertStringsNotEqual(t, names[0], names[1], "Expected two different files. "+
+		names[0]+" "+names[1])
+}
+
+func TestLogFile_ResumeRotationConcurrentPause(t *testing.T) {
+	testName := "TestResumeRotationConcurrentPause"
+
+	l, err := SizeLimitedFile(testName, LogMinFileSize)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	first := l.LogFilename()
+	defer func() {
+		l.Close()
+		os.Remove(first)
+		os.Remove(l.LogFilename())
+	}()
+
+	// Pause again while the threshold is checked. The pause waits for the rotation.
+	paused := make(chan struct{})
+	l.rotateCheck = func() bool {
+		go func() {
+			l.PauseRotation()
+			close(paused)
+		}()
+		select {
+		case <-paused:
+		case <-time.After(50 * time.Millisecond):
+		}
+		return true
+	}
+	l.PauseRotation()
+	gotestutil.AssertTrue(t, l.ResumeRotation(), "Expected rotation on resume, before the pause")
+	<-paused
+	gotestutil.AssertStringsNotEqual(t, first, l.LogFilename(), "Expected a rotated volume")
+	gotestutil.AssertFalse(t, l.LogRotate(), "Expected no rotation while paused")
+}
+
+func TestLogFile_LogFilenameConcurrentRotate(t *testing.T) {
+	testName := "TestLogFile_LogFilenameConcurrentRotate"
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+	l, err := LineLimitedFile(testName, 1)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	defer l.Close()
+
+	// The name is read while writes rotate the file, e.g. for go test -race.
+	names := map[string]bool{l.LogFilename(): true}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			l.Write([]byte(testName))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		names[l.LogFilename()] = true
+	}
+	gotestutil.AssertGreaterThan(t, len(names), 1, GetCaller()+" Expected the rotated names")
+}
+
+func TestLineLimitedFile(t *testing.T) {
+	testName := "TestLineLimitedFile"
+	maxLines := 4
+	var names = make(map[string]bool)
+
+	l, err := LineLimitedFile(testName, maxLines)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertNotNil(t, l, fmt.Sprintf("*LogFile is nil: \"%s\"\n", testName))
+	defer func() {
+		for v := range names {
+			os.Remove(v)
+		}
+	}()
+
+	p := l.LogPolicy()
+	gotestutil.AssertTrue(t, p.IsLineLimited(), "Expected line limited file policy, got "+p.String())
+
+	// 2.5 times the limit
+	var order []string
+	for i := 0; i < maxLines*5/2; i++ {
+		name := l.LogFilename()
+		if !names[name] {
+			names[name] = true
+			order = append(order, name)
+		}
+		l.Write([]byte(fmt.Sprintf("%s line %d", testName, i)))
+	}
+	names[l.LogFilename()] = true
+	l.Close()
+
+	gotestutil.AssertEqual(t, 3, len(order), fmt.Sprintf("Expected 3 volumes, %v", order))
+	for i, lines := range []int{4, 4, 2} {
+		gotestutil.AssertEqual(t, lines, countLines(order[i]), "Line count of "+order[i])
+	}
+
+	// The count is recovered on reopen, and a full file rotates.
+	l, err = LineLimitedFile(testName, maxLines)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	names[l.LogFilename()] = true
+	gotestutil.AssertStringsNotEqual(t, order[0], l.LogFilename(), "Expected full volume rotated on open")
+	gotestutil.AssertEqual(t, countLines(l.LogFilename()), l.lineCount, "Expected recounted lines")
+	l.Close()
+
+	_, err = LineLimitedFile(testName, 0)
+	gotestutil.AssertEqual(t, InvalidArgumentError, err, "Expected an invalid argument error")
+}
+
+func TestLogFile_ForceRotate(t *testing.T) {
+	testName := "TestLogFile_ForceRotate"
+	lf, err := LineLimitedFile(testName, 100)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	names := []string{lf.LogFilename()}
+	defer func() {
+		for _, name := range names {
+			os.Remove(name)
+		}
+	}()
+	l := LogManger(testName, lf)
+	l.AddLogger(&testWriter{})
+	l.Info(testName, "first", nil)
+
+	// Rotated by the Log, before the limit.
+	gotestutil.AssertNil(t, l.Rotate(), GetCaller()+" Error rotating")
+	names = append(names, lf.LogFilename())
+	gotestutil.AssertStringsNotEqual(t, names[0], names[1], GetCaller()+" Expected a new volume")
+
+	// The open error is returned, and the next write retries.
+	ioErr := errors.New("open failed")
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, ioErr
+	}
+	err = lf.ForceRotate()
+	osOpenFile = os.OpenFile
+	gotestutil.AssertTrue(t, errors.Is(err, ioErr), GetCaller()+" Expected the open error")
+	_, err = lf.Write([]byte(testName))
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected the file reopened")
+	names = append(names, lf.LogFilename())
+	l.Close()
+
+	// A file without a policy does not rotate.
+	sf, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := sf.LogFilename()
+	names = append(names, name)
+	gotestutil.AssertNil(t, sf.ForceRotate(), GetCaller()+" Expected no error")
+	gotestutil.AssertEqual(t, name, sf.LogFilename(), GetCaller()+" Expected the same file")
+	sf.Close()
+}
+
+func TestLogFile_Reopen(t *testing.T) {
+	testName := "TestLogFile_Reopen"
+	lf, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	other, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := lf.LogFilename()
+	rotated := name + ".1"
+	defer os.Remove(name)
+	defer os.Remove(rotated)
+	l := LogManger(testName, lf)
+	l.SetFormatter(&spyFormatter{})
+	l.Info(testName, "before", nil)
+
+	// After an external rename, writes go to a new file of the same name.
+	gotestutil.AssertNil(t, os.Rename(name, rotated), GetCaller()+" Error renaming")
+	gotestutil.AssertNil(t, l.ReopenAll(), GetCaller()+" Error reopening")
+	l.Info(testName, "after", nil)
+	gotestutil.AssertEqual(t, name, lf.LogFilename(), GetCaller()+" Expected the same name")
+	gotestutil.AssertEqual(t, 1, countLines(rotated), GetCaller()+" Line count of "+rotated)
+	gotestutil.AssertEqual(t, 1, countLines(name), GetCaller()+" Line count of "+name)
+
+	// A file sharing the renamed file reopens the new file, too.
+	gotestutil.AssertNil(t, other.Reopen(), GetCaller()+" Error reopening")
+	other.Write([]byte(testName))
+	gotestutil.AssertEqual(t, 2, countLines(name), GetCaller()+" Line count of "+name)
+	other.Close()
+	l.Close()
+}
+
+func TestCountLimitedFile(t *testing.T) {
+	testName := "TestCountLimitedFile"
+	_, err := CountLimitedFile(testName, 0)
+	gotestutil.AssertEqual(t, InvalidArgumentError, err, GetCaller()+" Expected an invalid limit")
+
+	l, err := CountLimitedFile(testName, 2)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	first := l.LogFilename()
+	defer os.Remove(first)
+	for i := 0; i < 3; i++ {
+		l.Write([]byte(testName))
+	}
+	second := l.LogFilename()
+	defer os.Remove(second)
+	l.Close()
+
+	gotestutil.AssertTrue(t, l.LogPolicy().IsLineLimited(), GetCaller()+" Expected the line limit policy")
+	gotestutil.AssertEqual(t, 2, countLines(first), GetCaller()+" Line count of "+first)
+	gotestutil.AssertEqual(t, 1, countLines(second), GetCaller()+" Line count of "+second)
+}
+
+func TestFile_MkdirAll(t *testing.T) {
+	testName := "TestFile_MkdirAll"
+	root := testName + ".d"
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "a", "b")
+
+	l, err := File(filepath.Join(dir, testName))
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected the directories created")
+	_, err = l.Write([]byte(testName))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error writing")
+	gotestutil.AssertEqual(t, 1, countLines(l.LogFilename()), GetCaller()+" Line count of "+l.LogFilename())
+	fi, err := os.Stat(dir)
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected "+dir)
+	gotestutil.AssertEqual(t, os.FileMode(0750), fi.Mode().Perm(), GetCaller()+" Expected the default mode")
+
+	// Recreated with the set mode, if removed, when the file is reopened.
+	l.Lock()
+	l.closeFile()
+	l.Unlock()
+	os.RemoveAll(root)
+	_, err = l.SetDirMode(0700).Write([]byte(testName))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error writing")
+	fi, err = os.Stat(dir)
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected "+dir)
+	gotestutil.AssertEqual(t, os.FileMode(0700), fi.Mode().Perm(), GetCaller()+" Expected the set mode")
+	l.Close()
+
+	// A file in place of a directory.
+	gotestutil.AssertNil(t, ioutil.WriteFile(filepath.Join(root, "f"), nil, 0660), GetCaller()+" Error writing")
+	_, err = File(filepath.Join(root, "f", testName))
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected a create directory error")
+}
+
+func TestLogFile_SetFileMode(t *testing.T) {
+	testName := "TestLogFile_SetFileMode"
+	l, err := LineLimitedFile(testName, 1)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	first := l.LogFilename()
+	defer os.Remove(first)
+
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.SetFileMode(os.ModeDir|0600), GetCaller()+" Expected an invalid mode")
+	gotestutil.AssertNil(t, l.SetFileMode(0600), GetCaller()+" Error setting the mode")
+	fi, _ := os.Stat(first)
+	gotestutil.AssertEqual(t, os.FileMode(0600), fi.Mode().Perm(), GetCaller()+" Expected the current file changed")
+
+	// The rotated volume is created with the mode.
+	l.Write([]byte(testName))
+	second := l.LogFilename()
+	defer os.Remove(second)
+	l.Close()
+	gotestutil.AssertStringsNotEqual(t, first, second, GetCaller()+" Expected a rotation")
+	fi, _ = os.Stat(second)
+	gotestutil.AssertEqual(t, os.FileMode(0600), fi.Mode().Perm(), GetCaller()+" Expected the new volume mode")
+}
+
+func TestLogFile_SetOpenFlags(t *testing.T) {
+	testName := "TestLogFile_SetOpenFlags"
+	var flags int
+	defer func() {
+		osOpenFile = os.OpenFile
+	}()
+	osOpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		flags = flag
+		return os.OpenFile(name, flag, perm)
+	}
+
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer func() {
+		l.Close()
+		os.Remove(name)
+	}()
+	l.Write([]byte(testName))
+
+	for _, bad := range []int{os.O_WRONLY | os.O_APPEND, os.O_CREATE | os.O_WRONLY,
+		os.O_CREATE | os.O_APPEND, logDefaultOpenFlags | os.O_TRUNC} {
+		gotestutil.AssertEqual(t, InvalidArgumentError, l.SetOpenFlags(bad), GetCaller()+" Expected invalid flags")
+	}
+	gotestutil.AssertEqual(t, logDefaultOpenFlags, flags, GetCaller()+" Expected the flags unchanged")
+
+	gotestutil.AssertNil(t, l.SetOpenFlags(logDefaultOpenFlags|os.O_SYNC), GetCaller()+" Error setting the flags")
+	gotestutil.AssertEqual(t, logDefaultOpenFlags|os.O_SYNC, flags, GetCaller()+" Expected the file reopened with the flags")
+	gotestutil.AssertEqual(t, 1, countLines(name), GetCaller()+" Expected the file kept")
+
+	// Forced flags may truncate.
+	gotestutil.AssertNil(t, l.ForceOpenFlags(logDefaultOpenFlags|os.O_TRUNC), GetCaller()+" Error forcing the flags")
+	gotestutil.AssertEqual(t, 0, countLines(name), GetCaller()+" Expected the file truncated")
+}
+
+func TestLogFile_SyncOnClose(t *testing.T) {
+	testName := "TestLogFile_SyncOnClose"
+	for _, syncOnClose := range []bool{true, false} {
+		l, err := NewLogFile(LogFileOptions{Prefix: testName, SyncEveryWrite: true})
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+		name := l.LogFilename()
+		_, err = l.Write([]byte(testName))
+		gotestutil.AssertNil(t, err, GetCaller()+" Error writing with a sync")
+
+		// The file is closed behind the LogFile, so the sync or close fails.
+		l.SyncOnClose(syncOnClose)
+		l.f.(*sharedHandle).File.Close()
+		err = l.Close()
+		var pe *os.PathError
+		gotestutil.AssertTrue(t, errors.As(err, &pe), GetCaller()+" Expected the error returned")
+		op := "close"
+		if syncOnClose {
+			op = "sync"
+		}
+		gotestutil.AssertEqual(t, op, pe.Op, GetCaller()+" Expected the error of the "+op)
+		os.Remove(name)
+	}
+}
+
+func TestLogFile_CloseTwice(t *testing.T) {
+	testName := "TestLogFile_CloseTwice"
+	l, err := TimedFile(testName, time.Hour)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	defer os.Remove(l.LogFilename())
+
+	gotestutil.AssertNil(t, l.Close(), GetCaller()+" Error closing")
+	gotestutil.AssertNil(t, l.Close(), GetCaller()+" Expected nil closing again")
+	_, err = l.Write([]byte(testName))
+	gotestutil.AssertEqual(t, os.ErrClosed, err, GetCaller()+" Expected a write after Close to fail")
+
+	// The error of the first Close is not returned again.
+	l, err = File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	l.f.(*sharedHandle).File.Close()
+	gotestutil.AssertNotNil(t, l.Close(), GetCaller()+" Expected the close error")
+	gotestutil.AssertNil(t, l.Close(), GetCaller()+" Expected nil closing again")
+
+	gotestutil.AssertNil(t, (&LogFile{}).Close(), GetCaller()+" Expected nil closing an unopened file")
+}
+
+func TestLogFile_RotateAfterClose(t *testing.T) {
+	testName := "TestLogFile_RotateAfterClose"
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+	l, err := SizeLimitedFile(testName, LogMinFileSize)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertNil(t, l.Close(), GetCaller()+" Error closing")
+
+	// No file is opened after Close.
+	gotestutil.AssertEqual(t, os.ErrClosed, l.ForceRotate(), GetCaller()+" Expected ForceRotate to fail")
+	gotestutil.AssertEqual(t, os.ErrClosed, l.Reopen(), GetCaller()+" Expected Reopen to fail")
+	gotestutil.AssertFalse(t, l.LogRotate(), GetCaller()+" Expected no rotation")
+	matches, _ := filepath.Glob(testName + ".*")
+	gotestutil.AssertEqual(t, 1, len(matches), fmt.Sprintf("%s Expected only the first file: %v", GetCaller(), matches))
+}
+
+func TestLogFile_CurrentLink(t *testing.T) {
+	testName := "TestLogFile_CurrentLink"
+	link := testName + ".current.log"
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+
+	l, err := LineLimitedFile(testName, 2)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	l.CurrentLink(true, true)
+	target, err := os.Readlink(link)
+	gotestutil.AssertNil(t, err, "Expected the current link")
+	gotestutil.AssertEqual(t, l.LogFilename(), target, "Expected the link to the current file")
+
+	// The link follows a rotation.
+	for i := 1; i <= 3; i++ {
+		l.Write([]byte(fmt.Sprintf("line %d", i)))
+	}
+	target, _ = os.Readlink(link)
+	gotestutil.AssertEqual(t, l.LogFilename(), target, "Expected the link to the rotated file")
+	b, err := ioutil.ReadFile(link)
+	gotestutil.AssertNil(t, err, "Error reading through the link")
+	gotestutil.AssertEqual(t, "line 3\n", string(b), "Expected the current file contents")
+
+	// The link is not a volume.
+	_, count, _ := LogFootprint(testName)
+	gotestutil.AssertEqual(t, 2, count, "Expected the link excluded from the footprint")
+
+	l.Close()
+	_, err = os.Lstat(link)
+	gotestutil.AssertTrue(t, os.IsNotExist(err), "Expected the link removed on Close")
+}
+
+func TestLogFile_MaxBackups(t *testing.T) {
+	testName := "TestLogFile_MaxBackups"
+	now := time.Now()
+	backups := map[string]time.Duration{
+		testName + ".0010.log":    3 * time.Hour,
+		testName + ".0011.log":    30 * time.Minute,
+		testName + ".0012.log.gz": 20 * time.Minute,
+		testName + ".0013.log":    10 * time.Minute,
+		// Compressed, but the original is not yet removed
+		testName + ".0013.log.gz": 9 * time.Minute,
+		// Another log that shares the prefix
+		testName + ".other.0001.log": 5 * time.Hour,
+	}
+
+	tests := []struct {
+		name       string
+		maxBackups int
+		maxAge     time.Duration
+		removed    []string
+	}{
+		{"count", 2, 0, []string{".0010.log", ".0011.log", ".0012.log.gz"}},
+		{"age", 0, time.Hour, []string{".0010.log"}},
+		{"either", 3, 15 * time.Minute, []string{".0010.log", ".0011.log", ".0012.log.gz"}},
+		{"compressed", 1, 0, []string{".0010.log", ".0011.log", ".0012.log.gz", ".0013.log", ".0013.log.gz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := LineLimitedFile(testName, 1)
+			gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+			defer func() {
+				matches, _ := filepath.Glob(testName + ".*")
+				for _, m := range matches {
+					os.Remove(m)
+				}
+			}()
+			for name, age := range backups {
+				gotestutil.AssertNil(t, ioutil.WriteFile(name, []byte("x\n"), 0660), "Error writing "+name)
+				gotestutil.AssertNil(t, os.Chtimes(name, now.Add(-age), now.Add(-age)), "Error setting time "+name)
+			}
+			first := l.LogFilename()
+			l.MaxBackups(tt.maxBackups).MaxAge(tt.maxAge)
+
+			// Rotates after one line
+			l.Write([]byte(testName))
+			gotestutil.AssertStringsNotEqual(t, first, l.LogFilename(), "Expected a rotated volume")
+			l.Close()
+
+			removed := make(map[string]bool)
+			for _, r := range tt.removed {
+				removed[testName+r] = true
+			}
+			for _, name := range append([]string{first}, testName+".0010.log", testName+".0011.log",
+				testName+".0012.log.gz", testName+".0013.log", testName+".0013.log.gz", testName+".other.0001.log") {
+				_, err := os.Stat(name)
+				gotestutil.AssertEqual(t, removed[name], os.IsNotExist(err), "Unexpected retention of "+name)
+			}
+		})
+	}
+}
+
+func TestLogFile_SetMinFreeSpace(t *testing.T) {
+	testName := "TestLogFile_SetMinFreeSpace"
+	backup := testName + ".0010.log"
+	minFree := uint64(100 * Mbyte)
+
+	defer func() {
+		diskFree = statfsFree
+	}()
+
+	tests := []struct {
+		name    string
+		free    func() uint64
+		removed bool
+		err     error
+	}{
+		{"above", func() uint64 { return minFree }, false, nil},
+		{"cleanup", func() uint64 {
+			// Deleting the backup frees enough space.
+			if _, err := os.Stat(backup); os.IsNotExist(err) {
+				return minFree
+			}
+			return minFree - 1
+		}, true, nil},
+		{"full", func() uint64 { return 0 }, true, InsufficientDiskSpaceError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			diskFree = func(path string) (uint64, error) {
+				calls++
+				return tt.free(), nil
+			}
+			l, err := File(testName)
+			gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+			name := l.LogFilename()
+			defer os.Remove(name)
+			defer os.Remove(backup)
+			old := time.Now().Add(-time.Hour)
+			gotestutil.AssertNil(t, ioutil.WriteFile(backup, []byte("x\n"), 0660), "Error writing "+backup)
+			gotestutil.AssertNil(t, os.Chtimes(backup, old, old), "Error setting time "+backup)
+
+			l.MaxBackups(0).MaxAge(time.Minute).SetMinFreeSpace(minFree)
+			_, err = l.Write([]byte(testName))
+			l.Close()
+
+			gotestutil.AssertEqual(t, tt.err, err, "Unexpected Write error")
+			gotestutil.AssertGreaterThan(t, calls, 0, "Expected free space checked")
+			_, sErr := os.Stat(backup)
+			gotestutil.AssertEqual(t, tt.removed, os.IsNotExist(sErr), "Unexpected cleanup of "+backup)
+			lines := 1
+			if tt.err != nil {
+				lines = 0
+			}
+			gotestutil.AssertEqual(t, lines, countLines(name), "Line count of "+name)
+		})
+	}
+}
+
+func TestLogFile_MinFreeSpaceCached(t *testing.T) {
+	testName := "TestLogFile_MinFreeSpaceCached"
+	minFree := uint64(100 * Mbyte)
+	var calls int
+	defer func() {
+		diskFree = statfsFree
+	}()
+	diskFree = func(path string) (uint64, error) {
+		calls++
+		return minFree + uint64(3*(len(testName)+1)), nil
+	}
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	defer os.Remove(l.LogFilename())
+	defer l.Close()
+	l.SetMinFreeSpace(minFree)
+
+	// The check is reused until the bytes written reach the minimum.
+	for i := 0; i < 5; i++ {
+		_, err = l.Write([]byte(testName))
+		gotestutil.AssertNil(t, err, GetCaller()+" Unexpected Write error")
+	}
+	gotestutil.AssertEqual(t, 2, calls, GetCaller()+" Expected the free space checked again")
+
+	// And for at most the interval.
+	l.Lock()
+	l.freeChecked = l.freeChecked.Add(-logFreeSpaceCheckInterval)
+	l.Unlock()
+	l.Write([]byte(testName))
+	gotestutil.AssertEqual(t, 3, calls, GetCaller()+" Expected the free space checked after the interval")
+}
+
+func TestSetInternalLogger(t *testing.T) {
+	testName := "TestSetInternalLogger"
+	defer func() {
+		SetInternalLogger(os.Stderr)
+		SetInternalEvents(true)
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+	var diag strings.Builder
+	SetInternalLogger(&diag)
+
+	l, err := SizeLimitedFile(testName, LogMinFileSize)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertNil(t, l.ForceRotate(), GetCaller()+" Error rotating")
+	gotestutil.AssertTrue(t, strings.Contains(diag.String(), `"action":"rotate_start"`),
+		GetCaller()+" Expected the rotation events: "+diag.String())
+
+	// Events are suppressed, and errors still logged, e.g. a directory that is a file.
+	diag.Reset()
+	SetInternalEvents(false)
+	gotestutil.AssertNil(t, l.ForceRotate(), GetCaller()+" Error rotating")
+	name := l.LogFilename()
+	l.Close()
+	gotestutil.AssertEqual(t, "", diag.String(), GetCaller()+" Expected no events")
+	_, err = File(filepath.Join(name, testName))
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected an error creating the directory")
+	gotestutil.AssertTrue(t, strings.Contains(diag.String(), "create directory"), GetCaller()+" Expected the error: "+diag.String())
+
+	// A nil writer silences the diagnostics.
+	diag.Reset()
+	SetInternalEvents(true)
+	SetInternalLogger(nil)
+	_, err = File(filepath.Join(name, testName))
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected an error creating the directory")
+	gotestutil.AssertEqual(t, "", diag.String(), GetCaller()+" Expected nothing logged")
+}
+
+func TestSizeLimitedFile_Removed(t *testing.T) {
+	testName := "TestSizeLimitedFile_Removed"
+	defer func() {
+		SetInternalLogger(os.Stderr)
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+	var diag strings.Builder
+	SetInternalLogger(&diag)
+
+	l, err := SizeLimitedFile(testName, LogMinFileSize)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	defer l.Close()
+	name := l.LogFilename()
+	gotestutil.AssertNil(t, os.Remove(name), GetCaller()+" Error removing "+name)
+
+	// The size check fails, so the file is rotated, rather than a panic.
+	_, err = l.Write([]byte("removed"))
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s Error writing: %s", GetCaller(), err))
+	gotestutil.AssertTrue(t, strings.Contains(diag.String(), "Error getting log file size"),
+		GetCaller()+" Expected the error: "+diag.String())
+	// The removed volume number is reused.
+	_, err = os.Stat(l.LogFilename())
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s Expected the new file: %s", GetCaller(), err))
+}
+
+func TestLogFile_DiskFullFallback(t *testing.T) {
+	testName := "TestLogFile_DiskFullFallback"
+	var free uint64
+	defer func() {
+		diskFree = statfsFree
+		SetInternalLogger(os.Stderr)
+	}()
+	diskFree = func(path string) (uint64, error) {
+		return free, nil
+	}
+	var warnings strings.Builder
+	SetInternalLogger(&warnings)
+
+	l, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer os.Remove(name)
+	fallback := &testWriter{}
+	l.SetMinFreeSpace(uint64(Mbyte)).DiskFullFallback(fallback)
+
+	// While the disk is full, messages go to the fallback, and the warning is logged once.
+	for i := 0; i < 3; i++ {
+		n, err := l.Write([]byte(testName))
+		gotestutil.AssertNil(t, err, GetCaller()+" Expected the fallback write to succeed")
+		gotestutil.AssertEqual(t, len(testName), n, GetCaller()+" Expected the length written")
+	}
+	gotestutil.AssertEqual(t, 3, len(fallback.Lines()), GetCaller()+" Expected the fallback lines")
+	gotestutil.AssertEqual(t, 1, strings.Count(warnings.String(), "write_stopped"), GetCaller()+" Expected one warning")
+
+	// Writes resume to the file, once space is freed.
+	free = uint64(Mbyte)
+	l.Write([]byte(testName))
+	l.Write([]byte(testName))
+	l.Close()
+	gotestutil.AssertEqual(t, 1, strings.Count(warnings.String(), "write_resumed"), GetCaller()+" Expected one resume")
+	gotestutil.AssertEqual(t, 2, countLines(name), "Line count of "+name)
+}
+
+func TestLogFootprint(t *testing.T) {
+	testName := "TestLogFootprint"
+	files := map[string]int{
+		testName + ".0001.log":       100,
+		testName + ".0002.log":       200,
+		testName + ".0003.log.gz":    50,
+		testName + ".txt":            1000, // Not a log file
+		testName + "Other.0001.log":  1000, // Different prefix
+		testName + ".other.0001.log": 1000, // Another log that shares the prefix
+	}
+	for name, size := range files {
+		err := ioutil.WriteFile(name, []byte(strings.Repeat("x", size)), 0660)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File: \"%s\"\n", err, name))
+		defer os.Remove(name)
+	}
+
+	total, count, err := LogFootprint(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, int64(350), total, "Expected the total size of the log files")
+	gotestutil.AssertEqual(t, 3, count, "Expected the number of log files")
+
+	total, count, err = LogFootprint(testName + "None")
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, 0, count, "Expected no log files")
+}
+
+func TestMergeVolumes(t *testing.T) {
+	testName := "TestMergeVolumes"
+	volumes := []string{".0001.log", ".0002.log.gz", ".0003.log"}
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+
+	var expected string
+	for i, v := range volumes {
+		content := fmt.Sprintf("volume %d line 1\nvolume %d line 2\n", i+1, i+1)
+		expected += content
+		name := testName + v
+		if strings.HasSuffix(name, ".gz") {
+			f, err := os.Create(name)
+			gotestutil.AssertNil(t, err, "Error creating "+name)
+			zw := gzip.NewWriter(f)
+			zw.Write([]byte(content))
+			zw.Close()
+			f.Close()
+			continue
+		}
+		gotestutil.AssertNil(t, ioutil.WriteFile(name, []byte(content), 0660), "Error writing "+name)
+	}
+	// Written out of order, so ModTime does not determine the order.
+	os.Chtimes(testName+volumes[0], time.Now(), time.Now())
+	// Another log that shares the prefix, which is not merged.
+	other := testName + ".other.0001.log"
+	gotestutil.AssertNil(t, ioutil.WriteFile(other, []byte("other line 1\n"), 0660), "Error writing "+other)
+
+	for _, compress := range []bool{false, true} {
+		out := testName + ".merged"
+		err := MergeVolumes(testName, out, compress)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, out))
+
+		f, err := os.Open(out)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, out))
+		var r io.Reader = f
+		if compress {
+			r, err = gzip.NewReader(f)
+			gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, out))
+		}
+		b, err := ioutil.ReadAll(r)
+		f.Close()
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, out))
+		gotestutil.AssertEqual(t, expected, string(b), fmt.Sprintf("Merged content, compress %t", compress))
+	}
+
+	for _, v := range volumes {
+		_, err := os.Stat(testName + v)
+		gotestutil.AssertNil(t, err, "Expected the volume kept: "+testName+v)
+	}
+	err := MergeVolumes(testName+"None", testName+".merged", false)
+	gotestutil.AssertTrue(t, os.IsNotExist(err), "Expected no volumes error")
+}
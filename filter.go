@@ -0,0 +1,105 @@
+// Filter rules set the severity threshold for selected events, e.g. "WARN+ for msg_id=PAYMENT,
+// INFO+ otherwise". Rules are evaluated in order, and the first matching rule sets the
+// threshold. If no rule matches, the module filter (see AddLoggerWithFilter) or the Log filter
+// (see SetFilter) is the default.
+package logger
+
+// A rule that sets the severity threshold for matching events.
+// An empty match field matches any value. ParamValue is only compared if ParamKey is set,
+// and an empty ParamValue matches any event that has the param.
+type FilterRule struct {
+	Appname    string
+	MsgId      string
+	ParamKey   string
+	ParamValue string
+	// Events with a Severity greater than the Threshold are not written.
+	Threshold Severity
+}
+
+// Returns true if the rule matches the event
+func (fr FilterRule) matches(appname string, msgId string, params map[string]string) bool {
+	if fr.Appname != "" && fr.Appname != appname {
+		return false
+	}
+	if fr.MsgId != "" && fr.MsgId != msgId {
+		return false
+	}
+	if fr.ParamKey != "" {
+		v, ok := params[fr.ParamKey]
+		if !ok || (fr.ParamValue != "" && fr.ParamValue != v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Set the filter rules, replacing any existing rules. A nil or empty slice removes all rules.
+// If a rule Threshold is invalid, an error is returned, and the rules are unchanged.
+// This is goroutine safe.
+func (l *Log) SetFilterRules(rules []FilterRule) error {
+	for _, r := range rules {
+		if !r.Threshold.isValid() {
+			return InvalidArgumentError
+		}
+	}
+	l.filterRules.Store(append([]FilterRule(nil), rules...))
+	return nil
+}
+
+// Returns the filter rules
+func (l *Log) GetFilterRules() []FilterRule {
+	return append([]FilterRule(nil), l.rules()...)
+}
+
+// Returns the current filter rules. The slice is not changed after it is stored.
+func (l *Log) rules() []FilterRule {
+	rules, _ := l.filterRules.Load().([]FilterRule)
+	return rules
+}
+
+// Returns the severity threshold for an event from the first matching rule,
+// or InvalidSeverity if no rule matches.
+func (l *Log) ruleThreshold(msgId string, params map[string]string) Severity {
+	for _, r := range l.rules() {
+		if r.matches(l.appname, msgId, params) {
+			return r.Threshold
+		}
+	}
+	return InvalidSeverity
+}
+
+// Returns the severity threshold of a module, given the matching rule threshold, if any.
+// A rule wins over the module filter, and the module filter wins over the Log filter.
+func (m logModule) threshold(rule Severity, global Severity) Severity {
+	if rule != InvalidSeverity {
+		return rule
+	}
+	if m.filter != InvalidSeverity {
+		return m.filter
+	}
+	return global
+}
+
+// Returns true if any module writes an event of the severity. False if there are no modules,
+// e.g. after Close, so the formatting work is skipped.
+func (l *Log) accepts(sev Severity, rule Severity) bool {
+	global := l.GetFilter()
+	for _, mod := range l.modules() {
+		if sev <= mod.threshold(rule, global) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a snapshot of the global filter, and the effective filter of each module, in the
+// order the modules were added. A module without its own filter uses the global filter.
+func (l *Log) Filters() (global Severity, perModule []Severity) {
+	global = l.GetFilter()
+	mods := l.modules()
+	perModule = make([]Severity, len(mods))
+	for i, mod := range mods {
+		perModule[i] = mod.threshold(InvalidSeverity, global)
+	}
+	return
+}
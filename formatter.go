@@ -8,19 +8,41 @@
 package logger
 
 import (
+	"io"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
+)
+
+const (
+	// The default timestamp layout of the JSON and plain text formatters, RFC 3339, as the
+	// timestamp helper, e.g. "2017-03-04T05:06:07-05:00". See SetTimeFormat.
+	DefaultTimeFormat = time.RFC3339
+	// SetTimeFormat sentinels for Unix epoch seconds, and milliseconds, e.g. 1488621967123.
+	// The JSONFormatter emits these as numbers.
+	TimeFormatUnix      = "unix"
+	TimeFormatUnixMilli = "unix_ms"
 )
 
 type EventFormatter interface {
 	Format(em EventMsg) (string, error)
 }
 
+// An EventFormatter that writes the formatted event directly to a writer, e.g. the JSONFormatter
+// and PlainTextFormatter. The Log detects it, and uses FormatTo rather than Format, so the event
+// is not formatted to an intermediate string. The output is the same as Format.
+type FormatterTo interface {
+	EventFormatter
+	FormatTo(w io.Writer, em EventMsg) error
+}
+
 // Set default values, and validate severity, hostname pid, and trim text.
+// A zero timestamp is set to the current time. Other timestamps, e.g. of replayed events, are kept.
 func validateEventMsg(em *EventMsg) *EventMsg {
-	if em.Timestamp.IsZero() || em.Timestamp.Year() != time.Now().Year() {
+	if em.Timestamp.IsZero() {
 		em.Timestamp = time.Now().Round(time.Millisecond)
 	}
 	if !IsValidSeverity(em.Sev) {
@@ -46,6 +68,28 @@ func validateEventMsg(em *EventMsg) *EventMsg {
 	return em
 }
 
+// Replace invalid UTF-8 in the text fields and params of the event with U+FFFD, so strict
+// parsers can ingest the formatted output. The params map is copied if it is changed.
+func repairEventMsgUTF8(em *EventMsg) *EventMsg {
+	for _, s := range []*string{&em.Sev, &em.Hostname, &em.Appname, &em.MsgId, &em.Msg} {
+		*s = strings.ToValidUTF8(*s, string(utf8.RuneError))
+	}
+
+	valid := true
+	for k, v := range em.Params {
+		valid = valid && utf8.ValidString(k) && utf8.ValidString(v)
+	}
+	if valid {
+		return em
+	}
+	params := make(map[string]string, len(em.Params))
+	for k, v := range em.Params {
+		params[strings.ToValidUTF8(k, string(utf8.RuneError))] = strings.ToValidUTF8(v, string(utf8.RuneError))
+	}
+	em.Params = params
+	return em
+}
+
 // Create a timestamp that is compliant with RFC 5424
 // Examples:
 //   1985-04-12T23:20:50.52Z => 20 minutes and 50.52 seconds after the 23rd hour of
@@ -56,3 +100,27 @@ func validateEventMsg(em *EventMsg) *EventMsg {
 func timestamp(t time.Time) string {
 	return t.Format(time.RFC3339)
 }
+
+// Returns t formatted with the time.Format layout, or as Unix epoch seconds or milliseconds
+// for the TimeFormatUnix and TimeFormatUnixMilli sentinels. An empty layout uses DefaultTimeFormat.
+func formatTimestamp(t time.Time, layout string) string {
+	return string(appendTimestamp(nil, t, layout))
+}
+
+// Appends t formatted as in formatTimestamp to b, and returns the extended buffer.
+func appendTimestamp(b []byte, t time.Time, layout string) []byte {
+	switch layout {
+	case "":
+		return t.AppendFormat(b, DefaultTimeFormat)
+	case TimeFormatUnix:
+		return strconv.AppendInt(b, t.Unix(), 10)
+	case TimeFormatUnixMilli:
+		return strconv.AppendInt(b, t.UnixNano()/int64(time.Millisecond), 10)
+	}
+	return t.AppendFormat(b, layout)
+}
+
+// Returns true if the layout formats the timestamp as a number.
+func isEpochTimeFormat(layout string) bool {
+	return layout == TimeFormatUnix || layout == TimeFormatUnixMilli
+}
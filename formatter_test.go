@@ -1,8 +1,13 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -131,7 +136,7 @@ func TestJsonFormat2(t *testing.T) {
 		fmt.Printf("%s\n", m)
 	})
 	t.Run("B=2", func(t *testing.T) {
-		// Invalid year for timestamp
+		// Timestamp from another year
 		em = emBase
 		n := emBase.Timestamp
 		em.Timestamp = time.Date(1970, n.Month(), n.Day(), n.Hour(), n.Minute(),
@@ -144,12 +149,604 @@ func TestJsonFormat2(t *testing.T) {
 	fmt.Println()
 }
 
-func BenchmarkJsonFormat(b *testing.B) {
+func TestValidateEventMsg_Timestamp(t *testing.T) {
+	em := emBase
+	lastYear := time.Now().AddDate(-1, 0, 0)
+	em.Timestamp = lastYear
+	gotestutil.AssertTrue(t, validateEventMsg(&em).Timestamp.Equal(lastYear), "Expected last year's timestamp preserved")
+
+	em.Timestamp = time.Time{}
+	before := time.Now().Add(-time.Second)
+	gotestutil.AssertTrue(t, validateEventMsg(&em).Timestamp.After(before), "Expected a zero timestamp set to now")
+}
+
+func TestJSONFormatter_Schema(t *testing.T) {
+	testName := "TestJSONFormatter_Schema"
+
+	t.Run(testName+"=1", func(t *testing.T) {
+		// Default is the package version
+		m, err := Json().Format(emBase)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.Contains(m, `"schema":"`+Version+`"`),
+			"Expected default schema field: "+m)
+	})
+	t.Run(testName+"=2", func(t *testing.T) {
+		m, err := Json().Schema("acme-2").Format(emBase)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.Contains(m, `"schema":"acme-2"`),
+			"Expected configured schema field: "+m)
+	})
+	t.Run(testName+"=3", func(t *testing.T) {
+		m, err := Json().Schema("").Format(emBase)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertFalse(t, strings.Contains(m, `"schema"`), "Expected no schema field: "+m)
+	})
+}
+
+func TestJSONFormatter_SeverityBoth(t *testing.T) {
+	testName := "TestJSONFormatter_SeverityBoth"
+	em := emBase
+	em.Sev = Severity(Warning).String()
+
+	t.Run(testName+"=1", func(t *testing.T) {
+		m, err := Json().Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertFalse(t, strings.Contains(m, `"severity_num"`), "Expected no severity_num: "+m)
+	})
+	t.Run(testName+"=2", func(t *testing.T) {
+		m, err := Json().SeverityBoth(true).Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.Contains(m, `"severity":"WARN"`), "Expected severity: "+m)
+		gotestutil.AssertTrue(t, strings.Contains(m, fmt.Sprintf(`"severity_num":%d`, Warning)),
+			"Expected package severity_num: "+m)
+	})
+	t.Run(testName+"=3", func(t *testing.T) {
+		m, err := Json().SeverityBoth(true).SyslogSeverityNum(true).Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.Contains(m, `"severity":"WARN"`), "Expected severity: "+m)
+		gotestutil.AssertTrue(t, strings.Contains(m, `"severity_num":4`), "Expected syslog severity_num: "+m)
+	})
+}
+
+func TestJSONFormatter_InferParamTypes(t *testing.T) {
+	testName := "TestJSONFormatter_InferParamTypes"
+	em := emBase
+	em.Params = map[string]string{
+		"int": "42", "neg": "-1.5e3", "bool": "true", "false": "false", "null": "null",
+		"zeros": "007", "text": "abc", "True": "True", "space": " 42", "hex": "0x1F",
+	}
+
+	t.Run(testName+"=1", func(t *testing.T) {
+		m, err := Json().InferParamTypes(true).Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		var rec struct {
+			Params map[string]interface{} `json:"params"`
+		}
+		gotestutil.AssertNil(t, json.Unmarshal([]byte(m), &rec), "Expected valid JSON: "+m)
+		expected := map[string]interface{}{
+			"int": 42.0, "neg": -1500.0, "bool": true, "false": false, "null": nil,
+			"zeros": "007", "text": "abc", "True": "True", "space": " 42", "hex": "0x1F",
+		}
+		gotestutil.AssertEqual(t, expected, rec.Params, "Expected inferred types: "+m)
+		gotestutil.AssertTrue(t, strings.Contains(m, `"neg":-1.5e3`), "Expected number copied verbatim: "+m)
+	})
+	t.Run(testName+"=2", func(t *testing.T) {
+		// Disabled by default
+		m, err := Json().Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.Contains(m, `"int":"42"`), "Expected quoted values: "+m)
+		gotestutil.AssertTrue(t, strings.Contains(m, `"bool":"true"`), "Expected quoted values: "+m)
+	})
+	t.Run(testName+"=3", func(t *testing.T) {
+		em := emBase
+		em.Params = nil
+		m, err := Json().InferParamTypes(true).Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.Contains(m, `"params":null`), "Expected null params: "+m)
+	})
+}
+
+func TestJSONFormatter_RawParams(t *testing.T) {
+	em := emBase
+	em.Params = map[string]string{"doc": `{"id":1,"tags":["a","b"]}`, "bad": `{"id":`, "text": "plain"}
+
+	m, err := Json().RawParams("doc", "bad").Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertTrue(t, strings.Contains(m, `"doc":{"id":1,"tags":["a","b"]}`), "Expected a nested object: "+m)
+	gotestutil.AssertTrue(t, strings.Contains(m, `"bad":"{\"id\":"`), "Expected invalid JSON quoted: "+m)
+	gotestutil.AssertTrue(t, strings.Contains(m, `"text":"plain"`), "Expected other params quoted: "+m)
+
+	m, err = Json().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertTrue(t, strings.Contains(m, `"doc":"{\"id\":1`), "Expected an escaped string by default: "+m)
+}
+
+// Compare two EventMsgs, allowing for the documented lossy Timestamp.
+func assertEventMsgEqual(t *testing.T, expected, actual EventMsg, msg string) {
+	gotestutil.AssertTrue(t, expected.Timestamp.Equal(actual.Timestamp), msg+" Timestamp")
+	expected.Timestamp, actual.Timestamp = time.Time{}, time.Time{}
+	gotestutil.AssertEqual(t, expected, actual, msg)
+}
+
+func TestParseJSON(t *testing.T) {
+	em := emBase
+	// The DefaultTimeFormat has whole seconds.
+	em.Timestamp = em.Timestamp.Truncate(time.Second)
+	m, err := Json().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+
+	pem, err := ParseJSON(m)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	assertEventMsgEqual(t, em, pem, "TestParseJSON: round trip")
+
+	_, err = ParseJSON("not json")
+	gotestutil.AssertNotNil(t, err, "TestParseJSON: expected an error")
+}
+
+func TestJSONFormatter_Encode(t *testing.T) {
+	special := "q\"b\\ <a>&\x00\x1f\x7f\b\f\n\r\t \u2028\u2029 \xff\xfe é 日本"
+	ems := []EventMsg{emBase, emBase, emBase, emBase, emBase}
+	ems[1].Msg, ems[1].MsgId, ems[1].Params = special, special, map[string]string{special: special, "": ""}
+	ems[2].Params = nil
+	ems[3].Params = map[string]string{}
+	ems[4].Params = map[string]string{TraceIDParam: "t1", SpanIDParam: "s1"}
+
+	formatters := []*JSONFormatter{
+		Json(),
+		Json().Schema("").SeverityBoth(true).SyslogSeverityNum(true),
+		Json().SetTimeFormat(TimeFormatUnixMilli),
+		Json().SetTimeFormat(`"Mon" <2006>`),
+	}
+	for i, jf := range formatters {
+		for j, em := range ems {
+			m, err := jf.Format(em)
+			gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+			want, _ := jf.marshal(jf.record(em))
+			// Normalize the U+FFFD of invalid UTF-8, which json.Marshal escapes before Go 1.22.
+			want = bytes.ReplaceAll(want, []byte("\ufffd"), []byte(`\ufffd`))
+			gotestutil.AssertEqual(t, string(want), m, fmt.Sprintf("Expected the json.Marshal output, formatter %d, event %d", i, j))
+		}
+	}
+}
+
+func TestJSONFormatter_TraceFields(t *testing.T) {
+	em := emBase
+	em.Timestamp = em.Timestamp.Truncate(time.Second)
+	em.Params = map[string]string{"p1": "param1", TraceIDParam: "t1", SpanIDParam: "s1"}
+	m, err := Json().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+
+	var rec map[string]interface{}
+	gotestutil.AssertNil(t, json.Unmarshal([]byte(m), &rec), "Expected valid JSON: "+m)
+	gotestutil.AssertEqual(t, "t1", rec["trace_id"], "Expected a top-level trace_id: "+m)
+	gotestutil.AssertEqual(t, "s1", rec["span_id"], "Expected a top-level span_id: "+m)
+	gotestutil.AssertEqual(t, map[string]interface{}{"p1": "param1"}, rec["params"], "Expected the ids moved: "+m)
+
+	pem, err := ParseJSON(m)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	assertEventMsgEqual(t, em, pem, "TestJSONFormatter_TraceFields: round trip")
+
+	m, _ = Json().Format(emBase)
+	gotestutil.AssertFalse(t, strings.Contains(m, "trace_id"), "Expected no trace_id without the param: "+m)
+}
+
+func TestParseLogfmt(t *testing.T) {
+	line := `timestamp=2017-03-04T05:06:07.000008-05:00 severity=INFO hostname=host1 ` +
+		`appname=app pid=42 msg_id=MsgId_1 message="Test \"quoted\" message, a=b" p1=param1 p2= p3`
+
+	em, err := ParseLogfmt(line)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	ts := time.Date(2017, 3, 4, 5, 6, 7, 8000, time.FixedZone("", -5*60*60))
+	assertEventMsgEqual(t, EventMsg{
+		Timestamp: ts,
+		Sev:       "INFO",
+		Hostname:  "host1",
+		Appname:   "app",
+		Pid:       42,
+		MsgId:     "MsgId_1",
+		Msg:       `Test "quoted" message, a=b`,
+		Params:    map[string]string{"p1": "param1", "p2": "", "p3": ""},
+	}, em, "TestParseLogfmt")
+
+	_, err = ParseLogfmt(`message="unterminated`)
+	gotestutil.AssertNotNil(t, err, "TestParseLogfmt: expected an error")
+	_, err = ParseLogfmt(`pid=abc`)
+	gotestutil.AssertNotNil(t, err, "TestParseLogfmt: expected an error")
+}
+
+func TestPlainTextFormatter_SetDelimeter(t *testing.T) {
+	em := emBase
+	em.Params = map[string]string{"p1": "param1"}
+	fields := []string{em.Sev, em.Hostname, em.Appname, strconv.Itoa(em.Pid), em.MsgId, em.Msg}
+
+	ptf := PlainText()
+	m, err := ptf.Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertTrue(t, strings.HasSuffix(m, "|"+strings.Join(fields, "|")+"|[p1=param1]"),
+		"Expected default separator: "+m)
+
+	ptf.SetDelimeter("\t")
+	em.Params["p2"] = "param2"
+	m, err = ptf.Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertTrue(t, strings.Contains(m, "\t"+strings.Join(fields, "\t")+"\t["),
+		"Expected tab separated fields: "+m)
+	gotestutil.AssertFalse(t, strings.Contains(m, "|"), "Expected no default separator: "+m)
+	params := strings.TrimSuffix(m[strings.Index(m, "[")+1:], "]")
+	gotestutil.AssertEqual(t, 2, len(strings.Split(params, "\t")), "Expected tab separated params: "+params)
+}
+
+func TestPlainTextFormatter_SortedParams(t *testing.T) {
+	em := emBase
+	em.Params = map[string]string{"zeta": "6", "alpha": "1", "mu": "3", "beta": "2", "omega": "7", "nu": "4"}
+
+	want := "[alpha=1,beta=2,mu=3,nu=4,omega=7,zeta=6]"
+	for i := 0; i < 20; i++ {
+		m, err := PlainText().Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.HasSuffix(m, "|"+want), "Expected sorted params: "+m)
+	}
+}
+
+func TestFormatter_SetTimeFormat(t *testing.T) {
+	em := emBase
+	em.Timestamp = time.Date(2017, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	tests := []struct {
+		layout    string
+		jsonValue string
+		text      string
+	}{
+		{"", `"2017-03-04T05:06:07Z"`, "2017-03-04T05:06:07Z"},
+		{time.RFC3339Nano, `"2017-03-04T05:06:07.123456789Z"`, "2017-03-04T05:06:07.123456789Z"},
+		{"2006-01-02 15:04:05.000", `"2017-03-04 05:06:07.123"`, "2017-03-04 05:06:07.123"},
+		{TimeFormatUnix, `1488603967`, "1488603967"},
+		{TimeFormatUnixMilli, `1488603967123`, "1488603967123"},
+	}
+	for _, tt := range tests {
+		m, err := Json().SetTimeFormat(tt.layout).Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.HasPrefix(m, `{"timestamp":`+tt.jsonValue+`,`), "Expected JSON timestamp: "+m)
+
+		ptf := PlainText()
+		ptf.SetTimeFormat(tt.layout)
+		m, err = ptf.Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertTrue(t, strings.HasPrefix(m, tt.text+"|"), "Expected text timestamp: "+m)
+	}
+
+	// The default round trips to the second, and RFC3339Nano exactly.
+	m, _ := Json().Format(em)
+	parsed, err := ParseJSON(m)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertTrue(t, em.Timestamp.Truncate(time.Second).Equal(parsed.Timestamp), "Expected the timestamp to round trip")
+	m, _ = Json().SetTimeFormat(time.RFC3339Nano).Format(em)
+	parsed, err = ParseJSON(m)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertTrue(t, em.Timestamp.Equal(parsed.Timestamp), "Expected the timestamp to round trip")
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2017, 3, 4, 5, 6, 7, 8000, time.FixedZone("", -5*60*60)),
+		Sev:       "INFO",
+		Hostname:  "host1",
+		Appname:   "app",
+		Pid:       42,
+		MsgId:     "MsgId_1",
+		Msg:       `Test "quoted" message, a=b`,
+		Params:    map[string]string{"p2": "two words", "p1": "param1", "p3": "", "p 4": "line\nbreak"},
+	}
+
+	m, err := Logfmt().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, `timestamp=2017-03-04T05:06:07.000008-05:00 severity=INFO hostname=host1 `+
+		`appname=app pid=42 msg_id=MsgId_1 message="Test \"quoted\" message, a=b" `+
+		`p_4="line\nbreak" p1=param1 p2="two words" p3=`, m, "TestLogfmtFormat")
+
+	// Round trip
+	parsed, err := ParseLogfmt(m)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	em.Params["p_4"] = em.Params["p 4"]
+	delete(em.Params, "p 4")
+	assertEventMsgEqual(t, em, parsed, "TestLogfmtFormat")
+}
+
+func TestConsoleFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2017, 3, 4, 5, 6, 7, 8000, time.UTC),
+		Sev:       "ERROR",
+		MsgId:     "DB_CONN",
+		Msg:       "connection refused",
+		Params:    map[string]string{"retry": "3", "host": "db 1"},
+	}
+
+	// Not a terminal, so no colors.
+	defer func() {
+		isTerminal = func(f *os.File) bool {
+			fi, err := f.Stat()
+			return err == nil && fi.Mode()&os.ModeCharDevice != 0
+		}
+	}()
+	isTerminal = func(*os.File) bool { return false }
+	m, err := Console().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, `05:06:07 ERROR DB_CONN connection refused host="db 1" retry=3`, m, "TestConsoleFormat")
+
+	m, _ = Console().ForceColor().Format(em)
+	gotestutil.AssertEqual(t, "05:06:07 \x1b[31mERROR\x1b[0m DB_CONN connection refused host=\"db 1\" retry=3", m,
+		"TestConsoleFormat forced color")
+
+	isTerminal = func(*os.File) bool { return true }
+	em.Sev = Severity(Warning).String()
+	if _, noColor := os.LookupEnv("NO_COLOR"); !noColor {
+		m, _ = Console().Format(em)
+		gotestutil.AssertTrue(t, strings.Contains(m, ansiYellow+"WARN"+ansiReset), "Expected a yellow severity, got "+m)
+	}
+	m, _ = Console().DisableColor().Format(em)
+	gotestutil.AssertFalse(t, strings.Contains(m, "\x1b["), "Expected no colors, got "+m)
+}
+
+func TestTemplateFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2017, 3, 4, 5, 6, 7, 8000, time.UTC),
+		Sev:       "ERROR",
+		MsgId:     "DB_CONN",
+		Msg:       "connection refused",
+		Params:    map[string]string{"retry": "3", "host": "db 1"},
+	}
+
+	ef, err := Template(`{{time .Timestamp "15:04:05"}} [{{lower .Sev}}] {{.Msg}} user={{.Params.user}}` +
+		`{{range $k, $v := .Params}} {{$k}}={{quote $v}}{{end}}`)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, "template", formatterName(ef), "Expected the formatter name")
+	m, err := ef.Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, `05:06:07 [error] connection refused user= host="db 1" retry=3`, m, "TestTemplateFormat")
+
+	_, err = Template("{{.Msg")
+	gotestutil.AssertNotNil(t, err, "Expected a parse error")
+
+	ef, err = Template("{{.Nope}}")
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	_, err = ef.Format(em)
+	gotestutil.AssertNotNil(t, err, "Expected an execution error")
+}
+
+func TestGELFFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2017, 3, 4, 5, 6, 7, 8000000, time.UTC),
+		Sev:       "ERROR",
+		Hostname:  "web1",
+		Appname:   "shop",
+		Pid:       42,
+		MsgId:     "DB_CONN",
+		Msg:       "connection refused",
+		Params: map[string]string{"host name": "db1", "msg_id": "dup", "id": "7",
+			"full_message": "stack trace"},
+	}
+	m, err := GELF().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, `{"__id":"7","_appname":"shop","_host_name":"db1","_msg_id":"DB_CONN","_pid":42,`+
+		`"full_message":"stack trace","host":"web1","level":3,"short_message":"connection refused",`+
+		`"timestamp":1488603967.008,"version":"1.1"}`, m, "TestGELFFormat")
+
+	em.Sev = "BOGUS"
+	m, _ = GELF().Format(em)
+	gotestutil.AssertFalse(t, strings.Contains(m, `"level"`), "Expected no level, got "+m)
+}
+
+func TestXMLFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2017, 3, 4, 5, 6, 7, 8000000, time.UTC),
+		Sev:       "ERROR",
+		Hostname:  "web1",
+		Appname:   "shop",
+		Pid:       42,
+		MsgId:     "DB_CONN",
+		Msg:       "<refused> & \"closed\"\nretrying",
+		Params:    map[string]string{"host": "db1", "a\"b": "x<y\x00"},
+	}
+	m, err := XML().Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, `<event><timestamp>2017-03-04T05:06:07.008Z</timestamp><severity>ERROR</severity>`+
+		`<hostname>web1</hostname><appname>shop</appname><pid>42</pid><msg_id>DB_CONN</msg_id>`+
+		`<message>&lt;refused&gt; &amp; &#34;closed&#34;&#xA;retrying</message>`+
+		`<params><param name="a&#34;b">x&lt;y`+"\uFFFD"+`</param><param name="host">db1</param></params></event>`,
+		m, "TestXMLFormat")
+
+	// Well-formed, and the text round trips.
+	var rec xmlEvent
+	gotestutil.AssertNil(t, xml.Unmarshal([]byte(m), &rec), "Expected well-formed XML: "+m)
+	gotestutil.AssertEqual(t, em.Msg, rec.Msg, "Expected the message to round trip")
+	gotestutil.AssertEqual(t, xmlParam{Name: `a"b`, Value: "x<y\uFFFD"}, rec.Params.Param[0], "Expected the param")
+
+	em.Params = nil
+	m, _ = XML().Format(em)
+	gotestutil.AssertFalse(t, strings.Contains(m, "<params"), "Expected no params, got "+m)
+}
+
+func TestApacheFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2000, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		Sev:       "INFO",
+		MsgId:     httpRequestMsgId,
+		Params: map[string]string{
+			"remote_addr": "127.0.0.1:53124",
+			"user":        "frank",
+			"method":      "GET",
+			"path":        "/apache_pb.gif",
+			"proto":       "HTTP/1.0",
+			"status":      "200",
+			"bytes":       "2326",
+			"referer":     "http://www.example.com/start.html",
+			"user_agent":  `Mozilla/4.08 [en] (Win98; I ;Nav) "quoted"`,
+		},
+	}
+
+	tests := []struct {
+		combined bool
+		expected string
+	}{
+		{false, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`},
+		{true, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 ` +
+			`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav) \"quoted\""`},
+	}
+	for _, tt := range tests {
+		m, err := Apache(tt.combined).Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+		gotestutil.AssertEqual(t, tt.expected, m, fmt.Sprintf("TestApacheFormat combined %t", tt.combined))
+	}
+
+	// Missing values
+	em.Params = map[string]string{"method": "GET", "path": "/", "status": "404"}
+	m, err := Apache(true).Format(em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, `- - - [10/Oct/2000:13:55:36 -0700] "GET / -" 404 - "-" "-"`, m, "TestApacheFormat missing")
+}
+
+func TestFormatterTo(t *testing.T) {
+	em := emBase
+	em.Params = map[string]string{"p1": "param1", "p2": "42"}
+	tabs := PlainText()
+	tabs.SetDelimeter("\t")
+	for _, ft := range []FormatterTo{Json(), Json().InferParamTypes(true), PlainText(), tabs} {
+		m, err := ft.Format(em)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+
+		var buf bytes.Buffer
+		gotestutil.AssertNil(t, ft.FormatTo(&buf, em), "Expected no error")
+		gotestutil.AssertEqual(t, m, buf.String(), "Expected the output of Format")
+		var sb strings.Builder
+		gotestutil.AssertNil(t, ft.FormatTo(&sb, em), "Expected no error")
+		gotestutil.AssertEqual(t, m, sb.String(), "Expected the output of Format")
+	}
+
+	tw := &testWriter{}
+	l := LogManger("TestFormatterTo", tw)
+	l.Info("MsgId_1", "first", nil)
+	l.SetFormatter(PlainText())
+	l.Info("MsgId_1", "second", nil)
+	gotestutil.AssertTrue(t, strings.Contains(tw.Lines()[0], `"message":"first"`), "Expected JSON, got "+tw.Lines()[0])
+	gotestutil.AssertTrue(t, strings.Contains(tw.Lines()[1], "|second|[]"), "Expected plain text, got "+tw.Lines()[1])
+}
+
+func TestMsgPackFormat(t *testing.T) {
+	em := EventMsg{
+		Timestamp: time.Date(2017, 3, 4, 5, 6, 7, 8000, time.UTC),
+		Sev:       "ERROR",
+		Hostname:  "web1",
+		Appname:   "shop",
+		Pid:       123456,
+		MsgId:     "DB_CONN",
+		Msg:       strings.Repeat("connection refused\n", 20),
+		Params:    map[string]string{"long": strings.Repeat("x", 70000)},
+	}
+	for i := 0; i < 20; i++ {
+		em.Params["p"+strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	mf := MsgPack()
+	b, err := mf.FormatBinary(nil, em)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	m, _ := mf.Format(em)
+	gotestutil.AssertEqual(t, string(b), m, "Expected Format to return the binary record")
+	parsed, err := ParseMsgPack(b)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	assertEventMsgEqual(t, em, parsed, "TestMsgPackFormat: round trip")
+
+	// Timestamps outside the 64-bit format, and small values.
+	em = EventMsg{Timestamp: time.Date(1960, 1, 2, 3, 4, 5, 6, time.UTC), Pid: -1}
+	b, _ = mf.FormatBinary(nil, em)
+	parsed, err = ParseMsgPack(b)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	assertEventMsgEqual(t, em, parsed, "TestMsgPackFormat: 96-bit timestamp")
+
+	// A stream of records, with a key the decoder skips.
+	var stream []byte
+	stream, _ = mf.FormatBinary(stream, emBase)
+	stream = appendMsgPackMapLen(stream, 2)
+	stream = appendMsgPackString(stream, "extra")
+	stream = append(stream, 0x92, mpTrue, 0x81, 0xa1, 'k', mpFloat64, 0, 0, 0, 0, 0, 0, 0, 0)
+	stream = appendMsgPackString(stream, "msg_id")
+	stream = appendMsgPackString(stream, "SKIPPED")
+	d := NewMsgPackDecoder(bytes.NewReader(stream))
+	parsed, err = d.Decode()
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	assertEventMsgEqual(t, emBase, parsed, "TestMsgPackFormat: first record")
+	parsed, err = d.Decode()
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, "SKIPPED", parsed.MsgId, "Expected the unknown key skipped")
+	_, err = d.Decode()
+	gotestutil.AssertEqual(t, io.EOF, err, "Expected the end of the stream")
+
+	// Truncated and invalid records.
+	b, _ = mf.FormatBinary(nil, emBase)
+	_, err = ParseMsgPack(b[:len(b)-3])
+	gotestutil.AssertEqual(t, io.ErrUnexpectedEOF, err, "Expected a truncated record")
+	_, err = ParseMsgPack([]byte(`{"msg_id":"json"}`))
+	gotestutil.AssertEqual(t, ParseError, err, "Expected a parse error")
+}
+
+func TestMsgPackFormat_LogFile(t *testing.T) {
+	testName := "TestMsgPackFormat_LogFile"
+	lf, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	defer os.Remove(lf.LogFilename())
+	lf.SetRawWrites(true)
+
+	l := LogManger(testName, lf)
+	l.SetFormatter(MsgPack())
+	l.Info(testName, "first\nline", map[string]string{"n": "\n"})
+	l.Info(testName, "second", nil)
+	l.Close()
+
+	f, err := os.Open(lf.LogFilename())
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	defer f.Close()
+	d := NewMsgPackDecoder(f)
+	em, err := d.Decode()
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, "first\nline", em.Msg, "Expected the newline kept")
+	gotestutil.AssertEqual(t, map[string]string{"n": "\n"}, em.Params, "Expected the params")
+	em, err = d.Decode()
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	gotestutil.AssertEqual(t, "second", em.Msg, "Expected the second record")
+	_, err = d.Decode()
+	gotestutil.AssertEqual(t, io.EOF, err, "Expected the end of the file")
+}
+
+// The reflection based encoding, for comparison with BenchmarkJsonFormat.
+func BenchmarkJsonMarshal(b *testing.B) {
 	em := emBase
 	jf := Json()
 
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		m, err := jf.Format(em)
+		m, err := jf.marshal(jf.record(em))
 		_, _ = m, err
 	}
 }
+
+func BenchmarkJsonFormat(b *testing.B) {
+	em := emBase
+	jf := Json()
+
+	b.ReportAllocs()
+	var m string
+	for i := 0; i < b.N; i++ {
+		m, _ = jf.Format(em)
+	}
+	b.ReportMetric(float64(len(m)), "bytes/record")
+}
+
+// The binary encoding, for comparison with BenchmarkJsonFormat.
+func BenchmarkMsgPackFormat(b *testing.B) {
+	em := emBase
+	mf := MsgPack()
+
+	b.ReportAllocs()
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf, _ = mf.FormatBinary(buf[:0], em)
+	}
+	b.ReportMetric(float64(len(buf)), "bytes/record")
+}
@@ -0,0 +1,88 @@
+// GELF Formatter
+// A GELF formatter formats events as GELF 1.1 JSON, for Graylog. The fields are mapped as:
+//
+//	version        "1.1"
+//	host           Hostname
+//	short_message  Msg
+//	full_message   the "full_message" param, e.g. a stack trace, if any
+//	timestamp      Timestamp, as Unix seconds with milliseconds, e.g. 1488603967.008
+//	level          the syslog severity (Emergency=0 ... Debug=7). See Severity.SyslogPriority.
+//	_msg_id        MsgId
+//	_appname       Appname
+//	_pid           Pid
+//
+// Each other param is an additional field, with the key prefixed with "_", and characters other
+// than letters, digits, "_", "-" and "." replaced with "_". A param does not replace a field
+// above, and "_id", which GELF reserves, is emitted as "__id".
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GELFFormatter formats events as GELF 1.1 JSON. See GELF.
+type GELFFormatter struct {
+	name string
+}
+
+// Create a new GELF event message formatter.
+// Returns an EventFormatter interface.
+func GELF() EventFormatter {
+	return &GELFFormatter{name: "gelf"}
+}
+
+// Returns the name of the formatter
+func (gf *GELFFormatter) Name() string {
+	return gf.name
+}
+
+// Implements EventFormatter interface.
+func (gf *GELFFormatter) Format(em EventMsg) (msg string, err error) {
+	rec := map[string]interface{}{
+		"version":       "1.1",
+		"host":          em.Hostname,
+		"short_message": em.Msg,
+		"timestamp": json.Number(fmt.Sprintf("%d.%03d", em.Timestamp.Unix(),
+			em.Timestamp.Nanosecond()/1e6)),
+		"_msg_id":  em.MsgId,
+		"_appname": em.Appname,
+		"_pid":     em.Pid,
+	}
+	if level := StringToSeverity(em.Sev).SyslogPriority(); level >= 0 {
+		rec["level"] = level
+	}
+	for k, v := range em.Params {
+		if k == "full_message" {
+			rec[k] = v
+			continue
+		}
+		key := gelfKey(k)
+		if _, reserved := rec[key]; !reserved {
+			rec[key] = v
+		}
+	}
+
+	b, jErr := json.Marshal(rec)
+	if jErr != nil {
+		internalf("GELF error: %s (%+v)\n", jErr, em)
+		return "", jErr
+	}
+	return string(b), nil
+}
+
+// Returns the additional field name of a param key.
+func gelfKey(k string) string {
+	k = "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, k)
+	if k == "_id" {
+		return "__id"
+	}
+	return k
+}
@@ -0,0 +1,112 @@
+// Gzip File
+// A gzip file logger writes compressed output directly to the log file, for space-constrained
+// devices. The gzip stream is flushed after each write, or at a configurable interval, so the
+// file can be read while it is open. Closing or rotating the file ends the gzip stream cleanly.
+// Reopening an existing file appends a new gzip member, which gzip readers read as one stream.
+//
+// The file size on disk is the compressed size, so the size limit of a GzipSizeLimitedFile counts
+// compressed bytes. Data buffered by a flush interval is counted after it is flushed. Each
+// rotation ends the gzip stream of the volume, so every volume is a complete gzip file.
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	logFilenameGzipExtension string = "gz"
+)
+
+// Wraps a file with a gzip writer. Close ends the gzip stream, and then closes the file.
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func newGzipFile(f *os.File) *gzipFile {
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}
+}
+
+// Close the gzip stream and the file. This implements the io.Closer interface
+func (gf *gzipFile) Close() error {
+	err := gf.Writer.Close()
+	if fErr := gf.f.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+// Creates a simple, non-rotating, gzip compressed log file.
+// The file name is prefix "." volume_number ".log.gz". The name parameter is a full file path
+// and filename, with no extension.
+//
+// If an error occurs, returns nil, and an error.
+func GzipFile(name string) (lf *LogFile, err error) {
+	return NewLogFile(LogFileOptions{Prefix: name, Gzip: true})
+}
+
+// Creates a gzip compressed log file with a size constraint (limit), as SizeLimitedFile.
+// The limit is of the compressed size, i.e. the file on disk.
+// The file name is prefix "." volume_number ".log.gz".
+//
+// If an error occurs, returns nil, and an error.
+func GzipSizeLimitedFile(name string, size int64) (lf *LogFile, err error) {
+	return NewLogFile(LogFileOptions{Prefix: name, Policy: PolicyFileSize, SizeLimit: size, Gzip: true})
+}
+
+// Set the interval between flushes of a gzip compressed log file.
+// Zero, the default, flushes after every write. A longer interval compresses better, but
+// buffered data is not in the file until the next flush, or Close.
+func (lf *LogFile) SetFlushInterval(d time.Duration) {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.flushInterval = d
+}
+
+// Gzip compress each volume after it is rotated, renaming it to prefix "." volume ".log.gz".
+// Compression runs in the background, and does not block writes to the new volume. A failed
+// compression is logged, and the uncompressed volume is kept. Close waits for pending compressions.
+// This has no effect on a GzipFile, which is already compressed.
+func (lf *LogFile) CompressOnRotate(b bool) {
+	lf.Lock()
+	defer lf.Unlock()
+	lf.compressOnRotate = b
+}
+
+// Compress a closed log volume to name ".gz", with the file mode, and remove the original.
+// The output is written to a temporary file, and renamed, so a partial file is never visible.
+func compressVolume(name string, mode os.FileMode) {
+	gzName := name + "." + logFilenameGzipExtension
+	tmpName := gzName + ".tmp"
+	err := func() (err error) {
+		src, err := os.Open(name)
+		if err != nil {
+			return
+		}
+		defer src.Close()
+
+		dst, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return
+		}
+		gf := newGzipFile(dst)
+		if _, err = io.Copy(gf, src); err != nil {
+			gf.Close()
+			return
+		}
+		if err = gf.Close(); err != nil {
+			return
+		}
+		return os.Rename(tmpName, gzName)
+	}()
+	if err != nil {
+		os.Remove(tmpName)
+		internalf("{\"action\":\"%s\", \"file\":\"%s\", \"error\":\"%s\"}", "compress_failed", name, err)
+		return
+	}
+	os.Remove(name)
+	internalEvent("{\"action\":\"%s\", \"file\":\"%s\"}", "compress_end", gzName)
+}
@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestGzipFile(t *testing.T) {
+	testName := "TestGzipFile"
+	lines := []string{"Message, Line 1", "Message, Line 2", "Message, Line 3"}
+
+	l, err := GzipFile(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertNotNil(t, l, fmt.Sprintf("*LogFile is nil: \"%s\"\n", testName))
+	name := l.LogFilename()
+	defer os.Remove(name)
+	gotestutil.AssertTrue(t, strings.HasSuffix(name, ".log.gz"), "Expected a .log.gz file: "+name)
+
+	for _, s := range lines {
+		_, err = l.Write([]byte(s))
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	}
+
+	gotestutil.AssertNil(t, l.Fsync(), "Expected Fsync to succeed")
+
+	// Flushed on each write, so the file is readable while open
+	fi, err := os.Stat(name)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	gotestutil.AssertGreaterThan(t, int(fi.Size()), 0, "Expected compressed data in "+name)
+	l.Close()
+
+	f, err := os.Open(name)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	b, err := ioutil.ReadAll(zr)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	gotestutil.AssertEqual(t, strings.Join(lines, "\n")+"\n", string(b), "Expected decompressed lines")
+}
+
+func TestLogFile_CompressOnRotate(t *testing.T) {
+	testName := "TestLogFile_CompressOnRotate"
+	maxLines := 2
+
+	l, err := LineLimitedFile(testName, maxLines)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	l.CompressOnRotate(true)
+	first := l.LogFilename()
+	defer os.Remove(first)
+	defer os.Remove(first + ".gz")
+
+	for i := 0; i < maxLines+1; i++ {
+		_, err = l.Write([]byte(fmt.Sprintf("%s line %d", testName, i)))
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	}
+	second := l.LogFilename()
+	defer os.Remove(second)
+	gotestutil.AssertStringsNotEqual(t, first, second, "Expected a rotated volume")
+	// The mode changes while the volume may be compressing, e.g. for go test -race.
+	gotestutil.AssertNil(t, l.SetFileMode(0600), "Error setting the file mode")
+	l.Close()
+
+	_, err = os.Stat(first)
+	gotestutil.AssertTrue(t, os.IsNotExist(err), "Expected the uncompressed volume removed: "+first)
+	gotestutil.AssertEqual(t, 1, countLines(second), "Line count of "+second)
+
+	f, err := os.Open(first + ".gz")
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, first))
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, first))
+	b, err := ioutil.ReadAll(zr)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, first))
+	gotestutil.AssertEqual(t, maxLines, strings.Count(string(b), "\n"), "Expected compressed lines")
+
+	// Compressed volumes are not counted as the newest volume.
+	gotestutil.AssertEqual(t, int16(3), calcNextVolumeNo(testName), "Expected the next volume after "+second)
+}
+
+func TestGzipSizeLimitedFile(t *testing.T) {
+	testName := "TestGzipSizeLimitedFile"
+	defer func() {
+		matches, _ := filepath.Glob(testName + ".*")
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}()
+
+	l, err := GzipSizeLimitedFile(testName, LogMinFileSize)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertNotNil(t, l, fmt.Sprintf("*LogFile is nil: \"%s\"\n", testName))
+	// A small limit, so a few writes cross it.
+	l.fileSizeLimit = 8 * Kbyte
+	first := l.LogFilename()
+	gotestutil.AssertEqual(t, testName+".0001.log.gz", first, "Expected the first volume")
+
+	// Compressed bytes count toward the limit, so compressible lines larger than it do not rotate.
+	var expected string
+	for i := 0; i < 10; i++ {
+		s := strings.Repeat("x", int(Kbyte))
+		_, err = l.Write([]byte(s))
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, first))
+		expected += s + "\n"
+	}
+	gotestutil.AssertEqual(t, first, l.LogFilename(), "Expected no rotation of compressible lines")
+
+	// Random lines do not compress, and rotate the file.
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 32 && l.LogFilename() == first; i++ {
+		b := make([]byte, Kbyte/2)
+		rnd.Read(b)
+		s := hex.EncodeToString(b)
+		_, err = l.Write([]byte(s))
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, first))
+		expected += s + "\n"
+	}
+	second := l.LogFilename()
+	gotestutil.AssertEqual(t, testName+".0002.log.gz", second, "Expected a rotated volume")
+	_, err = l.Write([]byte("second volume"))
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, second))
+	l.Close()
+
+	// Each volume is a complete gzip stream, i.e. it ends cleanly, with no unexpected EOF.
+	for name, content := range map[string]string{first: expected, second: "second volume\n"} {
+		fi, err := os.Stat(name)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+		gotestutil.AssertTrue(t, fi.Size() <= l.fileSizeLimit, fmt.Sprintf("Expected the compressed size within the limit: %d", fi.Size()))
+		f, err := os.Open(name)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+		zr, err := gzip.NewReader(f)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+		b, err := ioutil.ReadAll(zr)
+		f.Close()
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+		gotestutil.AssertEqual(t, content, string(b), "Expected decompressed lines of "+name)
+	}
+}
+
+func TestLogFile_SetFlushInterval(t *testing.T) {
+	testName := "TestLogFile_SetFlushInterval"
+
+	l, err := GzipFile(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := l.LogFilename()
+	defer os.Remove(name)
+	defer l.Close()
+	// Flushed by the first write, then buffered until the interval elapses.
+	l.SetFlushInterval(time.Hour)
+
+	decompressed := func() string {
+		f, err := os.Open(name)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			// Only the gzip header, or nothing, is in the file.
+			return ""
+		}
+		// The stream is not ended while the file is open, so an unexpected EOF is returned.
+		b, _ := ioutil.ReadAll(zr)
+		return string(b)
+	}
+
+	lines := []string{"Message, Line 1", "Message, Line 2", "Message, Line 3"}
+	for _, s := range lines {
+		_, err = l.Write([]byte(s))
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	}
+	gotestutil.AssertEqual(t, lines[0]+"\n", decompressed(), "Expected the lines after the first buffered")
+
+	gotestutil.AssertNil(t, l.Flush(), "Expected Flush to succeed")
+	gotestutil.AssertEqual(t, strings.Join(lines, "\n")+"\n", decompressed(), "Expected all lines after Flush")
+
+	// Zero flushes after every write.
+	l.SetFlushInterval(0)
+	_, err = l.Write([]byte("Message, Line 4"))
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, name))
+	gotestutil.AssertEqual(t, strings.Join(lines, "\n")+"\nMessage, Line 4\n", decompressed(),
+		"Expected the line flushed")
+}
@@ -0,0 +1,389 @@
+// HTTP Writer
+// An HTTP writer buffers formatted messages, and POSTs them in batches to an ingestion endpoint,
+// e.g. a Loki or Elastic proxy. A batch is sent when it reaches the batch size in messages, or in
+// bytes, or when its first message is the flush interval old, whichever comes first. So a quiet
+// service still ships promptly, and a burst does not create a huge request: a request never has
+// more than a batch of messages, however many are buffered while a send is in flight. At most
+// HTTPMaxPending batches are buffered, e.g. while the endpoint is down, and later messages are
+// dropped, counted, and reported with the next batch sent. The body is a JSON
+// array of the messages, or, optionally, newline delimited messages. The body may be gzip
+// compressed, for bandwidth-limited links.
+//
+// A batch that fails with a 5xx status, or a network error, is retried with a backoff that
+// doubles after each attempt. A batch that fails with another status, or after the retries, is
+// dropped, and the error logged. Close sends the remaining messages.
+//
+// Example:
+//
+//	w, err := logger.HTTPWriter("https://logs.example.com/ingest",
+//	    logger.HTTPHeader("Authorization", "Bearer "+token), logger.HTTPBatchSize(500))
+//	l := logger.LogManger("MyApp", w)
+//	l.SetFormatter(logger.Json())
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	httpDefaultBatchSize     = 100
+	httpDefaultBatchBytes    = 1024 * 1024
+	httpDefaultMaxPending    = 10
+	httpDefaultFlushInterval = 5 * time.Second
+	httpDefaultMaxRetries    = 3
+	httpDefaultBackoff       = 500 * time.Millisecond
+)
+
+// Configures an HTTPWriter
+type HTTPOption func(hw *httpWriter)
+
+// Set a header of each request, e.g. an auth token.
+func HTTPHeader(key, value string) HTTPOption {
+	return func(hw *httpWriter) {
+		hw.header.Set(key, value)
+	}
+}
+
+// Set the number of messages that triggers a batch. The default is 100.
+func HTTPBatchSize(n int) HTTPOption {
+	return func(hw *httpWriter) {
+		if n > 0 {
+			hw.batchSize = n
+		}
+	}
+}
+
+// Set the bytes of the messages that triggers a batch. The default is 1MB.
+func HTTPBatchBytes(n int) HTTPOption {
+	return func(hw *httpWriter) {
+		if n > 0 {
+			hw.batchBytes = n
+		}
+	}
+}
+
+// Set the number of batches that may be buffered, i.e. n times the batch size, in messages and
+// bytes. Messages written when it is full are dropped. The default is 10.
+func HTTPMaxPending(n int) HTTPOption {
+	return func(hw *httpWriter) {
+		if n > 0 {
+			hw.maxPending = n
+		}
+	}
+}
+
+// Set the longest time a message is buffered, i.e. a batch is sent the interval after its first
+// message, if it is not full before. The default is 5 seconds.
+func HTTPFlushInterval(d time.Duration) HTTPOption {
+	return func(hw *httpWriter) {
+		if d > 0 {
+			hw.interval = d
+		}
+	}
+}
+
+// Send newline delimited messages (application/x-ndjson), rather than a JSON array.
+func HTTPNewlineDelimited() HTTPOption {
+	return func(hw *httpWriter) {
+		hw.ndjson = true
+	}
+}
+
+// Gzip compress the request body, and set the Content-Encoding header.
+func HTTPGzip() HTTPOption {
+	return func(hw *httpWriter) {
+		hw.gzip = true
+	}
+}
+
+// Set the retries of a failed batch, and the backoff before the first retry.
+// The defaults are 3 retries, and 500ms.
+func HTTPRetry(maxRetries int, backoff time.Duration) HTTPOption {
+	return func(hw *httpWriter) {
+		hw.maxRetries = maxRetries
+		hw.backoff = backoff
+	}
+}
+
+// Set the HTTP client. The default is http.DefaultClient.
+func HTTPClient(c *http.Client) HTTPOption {
+	return func(hw *httpWriter) {
+		hw.client = c
+	}
+}
+
+// Implements a LogWriter that POSTs batches of messages to a URL.
+type httpWriter struct {
+	url        string
+	header     http.Header
+	client     *http.Client
+	batchSize  int
+	batchBytes int
+	maxPending int
+	interval   time.Duration
+	ndjson     bool
+	gzip       bool
+	maxRetries int
+	backoff    time.Duration
+	buffered   [][]byte
+	size       int    // The bytes of the buffered messages
+	dropped    uint64 // Messages dropped since the last report, as the buffer was full
+	closed     bool
+	kick       chan struct{} // Signals a full batch
+	first      chan struct{} // Signals the first message of a batch, which starts its age
+	stop       chan struct{}
+	done       chan struct{}
+	sync.Mutex
+	// Serializes sending, so batches are sent in order.
+	sendMu sync.Mutex
+	// The compressed body, and its compressor, reused for each batch. Guarded by sendMu.
+	zbuf bytes.Buffer
+	zw   *gzip.Writer
+}
+
+// Create a writer that POSTs batches of messages to the http or https url.
+// Returns InvalidArgumentError if the url is not valid.
+func HTTPWriter(rawurl string, opts ...HTTPOption) (LogWriter, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, InvalidArgumentError
+	}
+	hw := &httpWriter{
+		url:        rawurl,
+		header:     make(http.Header),
+		client:     http.DefaultClient,
+		batchSize:  httpDefaultBatchSize,
+		batchBytes: httpDefaultBatchBytes,
+		maxPending: httpDefaultMaxPending,
+		interval:   httpDefaultFlushInterval,
+		maxRetries: httpDefaultMaxRetries,
+		backoff:    httpDefaultBackoff,
+		kick:       make(chan struct{}, 1),
+		first:      make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(hw)
+	}
+	// A Content-Type set with HTTPHeader wins.
+	if hw.header.Get("Content-Type") == "" {
+		ct := "application/json"
+		if hw.ndjson {
+			ct = "application/x-ndjson"
+		}
+		hw.header.Set("Content-Type", ct)
+	}
+	if hw.gzip {
+		hw.header.Set("Content-Encoding", "gzip")
+	}
+	go hw.run()
+	return hw, nil
+}
+
+// Buffer a message. This implements the io.Writer interface
+// If HTTPMaxPending batches are buffered, the message is dropped, and counted.
+// This is goroutine safe.
+func (hw *httpWriter) Write(p []byte) (n int, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.closed {
+		return 0, os.ErrClosed
+	}
+	if len(hw.buffered) >= hw.maxPending*hw.batchSize || hw.size+len(p) > hw.maxPending*hw.batchBytes {
+		hw.dropped++
+		return len(p), nil
+	}
+	if len(hw.buffered) == 0 {
+		notify(hw.first)
+	}
+	hw.buffered = append(hw.buffered, append([]byte(nil), p...))
+	hw.size += len(p)
+	if len(hw.buffered) >= hw.batchSize || hw.size >= hw.batchBytes {
+		notify(hw.kick)
+	}
+	return len(p), nil
+}
+
+// Send the buffered messages, in batches of at most the batch size, in messages and bytes.
+// A message larger than the batch bytes is sent alone. This implements the Flusher interface
+// Returns the error of the last attempt of the first batch that was dropped, if any.
+func (hw *httpWriter) Flush() (err error) {
+	hw.sendMu.Lock()
+	defer hw.sendMu.Unlock()
+
+	hw.Lock()
+	buffered, dropped := hw.buffered, hw.dropped
+	hw.buffered, hw.size, hw.dropped = nil, 0, 0
+	hw.Unlock()
+	if dropped > 0 {
+		internalf("%s: (\"%s\") %d messages dropped. The buffer is full.", GetCaller(), hw.url, dropped)
+	}
+
+	for len(buffered) > 0 {
+		n, size := 1, len(buffered[0])
+		for n < len(buffered) && n < hw.batchSize && size+len(buffered[n]) <= hw.batchBytes {
+			size += len(buffered[n])
+			n++
+		}
+		if bErr := hw.send(buffered[:n]); err == nil {
+			err = bErr
+		}
+		buffered = buffered[n:]
+	}
+	return err
+}
+
+// Send a batch, retrying as configured. Returns the error of the last attempt, if the batch
+// was dropped.
+// The caller must hold sendMu.
+func (hw *httpWriter) send(batch [][]byte) error {
+	body := hw.body(batch)
+	err := hw.post(body)
+	for i, d := 0, hw.backoff; err != nil && isRetryable(err) && i < hw.maxRetries; i, d = i+1, d*2 {
+		time.Sleep(d)
+		err = hw.post(body)
+	}
+	if err != nil {
+		internalf("%s: (\"%s\") %d messages dropped. %s", GetCaller(), hw.url, len(batch), err)
+	}
+	return err
+}
+
+// Stop the background sender, and send the remaining messages. This implements the io.Closer interface
+func (hw *httpWriter) Close() error {
+	hw.Lock()
+	if hw.closed {
+		hw.Unlock()
+		return nil
+	}
+	hw.closed = true
+	hw.Unlock()
+
+	close(hw.stop)
+	<-hw.done
+	return hw.Flush()
+}
+
+// Send batches when full, or the flush interval after their first message, until stopped.
+func (hw *httpWriter) run() {
+	defer close(hw.done)
+	age := time.NewTimer(hw.interval)
+	age.Stop()
+	defer age.Stop()
+	for {
+		select {
+		case <-hw.stop:
+			return
+		case <-hw.first:
+			stopTimer(age)
+			age.Reset(hw.interval)
+			continue
+		case <-hw.kick:
+			stopTimer(age)
+		case <-age.C:
+		}
+		hw.Flush()
+	}
+}
+
+// Send a signal on a channel with a buffer of one, unless one is already pending.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// Stop a timer, and drain its channel, so it can be reset.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// An error status from the endpoint.
+type httpStatusError struct {
+	status int
+}
+
+func (e httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP status %d", e.status)
+}
+
+// Returns true for a 5xx status, or a network error.
+func isRetryable(err error) bool {
+	if se, ok := err.(httpStatusError); ok {
+		return se.status >= 500
+	}
+	return true
+}
+
+// POST the body of a batch once.
+func (hw *httpWriter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hw.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range hw.header {
+		req.Header[k] = v
+	}
+	resp, err := hw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return httpStatusError{status: resp.StatusCode}
+	}
+	return nil
+}
+
+// Returns the request body of a batch, compressed if HTTPGzip is set. In a JSON array, a message
+// that is valid JSON, e.g. from the JSONFormatter, is embedded as is, and any other message as a
+// string. A compressed body is valid until the next call.
+// The caller must hold sendMu.
+func (hw *httpWriter) body(batch [][]byte) []byte {
+	var b []byte
+	if hw.ndjson {
+		b = append(bytes.Join(batch, []byte("\n")), '\n')
+	} else {
+		msgs := make([]interface{}, len(batch))
+		for i, m := range batch {
+			if json.Valid(m) {
+				msgs[i] = json.RawMessage(m)
+			} else {
+				msgs[i] = string(m)
+			}
+		}
+		b, _ = json.Marshal(msgs)
+	}
+	if !hw.gzip {
+		return b
+	}
+	hw.zbuf.Reset()
+	if hw.zw == nil {
+		hw.zw = gzip.NewWriter(&hw.zbuf)
+	} else {
+		hw.zw.Reset(&hw.zbuf)
+	}
+	// Writes to a bytes.Buffer do not fail.
+	hw.zw.Write(b)
+	hw.zw.Close()
+	return hw.zbuf.Bytes()
+}
@@ -0,0 +1,238 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+// An endpoint that records request bodies, and fails the first failures requests with a 503.
+type httpSink struct {
+	sync.Mutex
+	failures int
+	requests int
+	bodies   []string
+	headers  []http.Header
+}
+
+func (hs *httpSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hs.Lock()
+	defer hs.Unlock()
+	b, _ := ioutil.ReadAll(r.Body)
+	hs.requests++
+	if hs.requests <= hs.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	hs.bodies = append(hs.bodies, string(b))
+	hs.headers = append(hs.headers, r.Header)
+}
+
+func (hs *httpSink) Bodies() []string {
+	hs.Lock()
+	defer hs.Unlock()
+	return append([]string(nil), hs.bodies...)
+}
+
+func TestHTTPWriter(t *testing.T) {
+	testName := "TestHTTPWriter"
+	sink := &httpSink{failures: 2}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	w, err := HTTPWriter(srv.URL, HTTPBatchSize(2), HTTPFlushInterval(time.Hour),
+		HTTPHeader("Authorization", "Bearer token"), HTTPRetry(3, time.Millisecond))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+	l := LogManger(testName, w)
+	l.SetFormatter(&spyFormatter{})
+
+	// A full batch is sent, after retrying the 503s.
+	l.Info(testName, "msg 1", nil)
+	l.Info(testName, "msg 2", nil)
+	for i := 0; i < 500 && len(sink.Bodies()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	gotestutil.AssertEqual(t, []string{`["msg 1","msg 2"]`}, sink.Bodies(), GetCaller()+" Expected a batch")
+	gotestutil.AssertEqual(t, "application/json", sink.headers[0].Get("Content-Type"), GetCaller()+" Expected a content type")
+	gotestutil.AssertEqual(t, "Bearer token", sink.headers[0].Get("Authorization"), GetCaller()+" Expected a custom header")
+
+	// Close sends the partial batch.
+	l.Info(testName, "msg 3", nil)
+	l.Close()
+	gotestutil.AssertEqual(t, `["msg 3"]`, sink.Bodies()[1], GetCaller()+" Expected the buffer drained by Close")
+	_, err = w.Write([]byte("after close"))
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected an error after Close")
+
+	_, err = HTTPWriter("ftp://example.com")
+	gotestutil.AssertEqual(t, InvalidArgumentError, err, GetCaller()+" Expected an invalid url error")
+}
+
+func TestHTTPWriter_Format(t *testing.T) {
+	testName := "TestHTTPWriter_Format"
+	sink := &httpSink{}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	// JSON messages are embedded in the array.
+	w, err := HTTPWriter(srv.URL)
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+	l := LogManger(testName, w)
+	l.SetFormatter(Json())
+	l.Info(testName, "json", nil)
+	l.Flush()
+	var msgs []EventMsg
+	gotestutil.AssertNil(t, json.Unmarshal([]byte(sink.Bodies()[0]), &msgs), GetCaller()+" Expected a JSON array")
+	gotestutil.AssertEqual(t, "json", msgs[0].Msg, GetCaller()+" Expected the message")
+	l.Close()
+
+	// Newline delimited messages, sent at the interval.
+	w, err = HTTPWriter(srv.URL, HTTPNewlineDelimited(), HTTPFlushInterval(10*time.Millisecond))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+	l = LogManger(testName, w)
+	l.SetFormatter(&spyFormatter{})
+	defer l.Close()
+	l.Info(testName, "line 1", nil)
+	l.Info(testName, "line 2", nil)
+	for i := 0; i < 500 && len(sink.Bodies()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	gotestutil.AssertEqual(t, "line 1\nline 2\n", sink.Bodies()[1], GetCaller()+" Expected NDJSON")
+	gotestutil.AssertTrue(t, strings.HasSuffix(sink.headers[1].Get("Content-Type"), "ndjson"), GetCaller()+" Expected a content type")
+
+	// A custom content type is kept.
+	w, err = HTTPWriter(srv.URL, HTTPNewlineDelimited(), HTTPHeader("Content-Type", "text/plain"))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+	w.Write([]byte("line 3"))
+	w.Close()
+	gotestutil.AssertEqual(t, "text/plain", sink.headers[2].Get("Content-Type"), GetCaller()+" Expected the custom content type")
+}
+
+func TestHTTPWriter_BatchTriggers(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []HTTPOption
+		msgs []string
+	}{
+		{"count", []HTTPOption{HTTPBatchSize(3), HTTPFlushInterval(time.Hour)}, []string{"msg 1", "msg 2", "msg 3"}},
+		{"bytes", []HTTPOption{HTTPBatchBytes(20), HTTPFlushInterval(time.Hour)}, []string{"0123456789", "0123456789"}},
+		{"age", []HTTPOption{HTTPFlushInterval(50 * time.Millisecond)}, []string{"msg 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &httpSink{}
+			srv := httptest.NewServer(sink)
+			defer srv.Close()
+			w, err := HTTPWriter(srv.URL, append(tt.opts, HTTPNewlineDelimited())...)
+			gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+			defer w.Close()
+
+			// One message short of the trigger is not sent.
+			for _, m := range tt.msgs[:len(tt.msgs)-1] {
+				w.Write([]byte(m))
+			}
+			time.Sleep(20 * time.Millisecond)
+			gotestutil.AssertEqual(t, 0, len(sink.Bodies()), GetCaller()+" Expected no batch before the trigger")
+
+			start := time.Now()
+			w.Write([]byte(tt.msgs[len(tt.msgs)-1]))
+			for i := 0; i < 500 && len(sink.Bodies()) == 0; i++ {
+				time.Sleep(5 * time.Millisecond)
+			}
+			gotestutil.AssertEqual(t, []string{strings.Join(tt.msgs, "\n") + "\n"}, sink.Bodies(),
+				GetCaller()+" Expected a batch on the trigger")
+			if tt.name == "age" {
+				gotestutil.AssertTrue(t, time.Since(start) >= 50*time.Millisecond, GetCaller()+" Expected the batch after its age")
+			}
+		})
+	}
+}
+
+func TestHTTPWriter_Gzip(t *testing.T) {
+	testName := "TestHTTPWriter_Gzip"
+	sink := &httpSink{failures: 1}
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	w, err := HTTPWriter(srv.URL, HTTPGzip(), HTTPFlushInterval(time.Hour), HTTPRetry(1, time.Millisecond))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+	l := LogManger(testName, w)
+	l.SetFormatter(Json())
+	defer l.Close()
+
+	// The retried body, and the next batch, reuse the buffer.
+	for _, batch := range [][]string{{"msg 1", "msg 2"}, {"msg 3"}} {
+		for _, m := range batch {
+			l.Info(testName, m, map[string]string{"p1": "param1"})
+		}
+		gotestutil.AssertNil(t, l.Flush(), GetCaller()+" Expected the batch sent")
+	}
+
+	bodies := sink.Bodies()
+	gotestutil.AssertEqual(t, 2, len(bodies), GetCaller()+" Expected 2 batches")
+	for i, expected := range [][]string{{"msg 1", "msg 2"}, {"msg 3"}} {
+		gotestutil.AssertEqual(t, "gzip", sink.headers[i].Get("Content-Encoding"), GetCaller()+" Expected the gzip header")
+		gotestutil.AssertEqual(t, "application/json", sink.headers[i].Get("Content-Type"), GetCaller()+" Expected a content type")
+		zr, err := gzip.NewReader(strings.NewReader(bodies[i]))
+		gotestutil.AssertNil(t, err, GetCaller()+" Expected a gzip body")
+		b, err := ioutil.ReadAll(zr)
+		gotestutil.AssertNil(t, err, GetCaller()+" Error decompressing the body")
+		var msgs []EventMsg
+		gotestutil.AssertNil(t, json.Unmarshal(b, &msgs), GetCaller()+" Expected a JSON array: "+string(b))
+		gotestutil.AssertEqual(t, len(expected), len(msgs), GetCaller()+" Expected the events")
+		for j, m := range msgs {
+			gotestutil.AssertEqual(t, expected[j], m.Msg, GetCaller()+" Expected the original event")
+			gotestutil.AssertEqual(t, "param1", m.Params["p1"], GetCaller()+" Expected the original params")
+		}
+	}
+}
+
+func TestHTTPWriter_Burst(t *testing.T) {
+	sink := &httpSink{}
+	started, stalled := make(chan struct{}, 100), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-stalled
+		sink.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	var diag strings.Builder
+	SetInternalLogger(&diag)
+	defer SetInternalLogger(os.Stderr)
+
+	// 3 messages of 10 bytes to a batch, and up to 4 batches buffered, i.e. 12 messages.
+	const batchSize, batchBytes = 5, 32
+	w, err := HTTPWriter(srv.URL, HTTPNewlineDelimited(), HTTPBatchSize(batchSize), HTTPBatchBytes(batchBytes),
+		HTTPMaxPending(4), HTTPFlushInterval(time.Hour))
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+
+	// The first batch is full at 4 messages, and its send stalls.
+	for i := 0; i < 4; i++ {
+		w.Write([]byte(fmt.Sprintf("message %02d", i)))
+	}
+	<-started
+	for i := 4; i < 4+10*batchSize; i++ {
+		w.Write([]byte(fmt.Sprintf("message %02d", i)))
+	}
+	close(stalled)
+	gotestutil.AssertNil(t, w.Close(), GetCaller()+" Expected the buffer sent")
+
+	var lines int
+	for _, b := range sink.Bodies() {
+		msgs := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+		gotestutil.AssertTrue(t, len(msgs) <= batchSize && len(b)-len(msgs) <= batchBytes,
+			GetCaller()+" Expected at most a batch in a request: "+b)
+		lines += len(msgs)
+	}
+	gotestutil.AssertEqual(t, 4+12, lines, GetCaller()+" Expected the first batch, and the buffered messages")
+	gotestutil.AssertTrue(t, strings.Contains(diag.String(), "38 messages dropped"), GetCaller()+" Expected the drops reported: "+diag.String())
+}
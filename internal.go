@@ -0,0 +1,58 @@
+// Internal Diagnostics
+// The package reports its own errors, e.g. a file that failed to open, and the lifecycle events
+// of log files, e.g. {"action":"rotate_start", ...}, to an internal logger, rather than the
+// standard logger of the application. The internal logger writes to stderr by default.
+//
+// SetInternalLogger redirects or silences it, e.g. when the package is embedded in a library,
+// and SetInternalEvents suppresses the lifecycle events only.
+//
+// Example:
+//
+//	logger.SetInternalLogger(io.Discard)
+package logger
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+var (
+	// Writes the internal diagnostics. See SetInternalLogger.
+	internalLog = log.New(os.Stderr, "", log.LstdFlags)
+	// Non-zero if the lifecycle events are logged. Accessed atomically. See SetInternalEvents.
+	internalEvents int32 = 1
+)
+
+// Set the writer of the internal diagnostics of the package. A nil writer silences them.
+// This is goroutine safe.
+func SetInternalLogger(w io.Writer) {
+	if w == nil {
+		w = io.Discard
+	}
+	internalLog.SetOutput(w)
+}
+
+// Enable or disable the JSON lifecycle events of log files, e.g. "rotate_start", "rotate_end"
+// and "compress_end", in the internal diagnostics. Errors are still logged. Enabled by default.
+// This is goroutine safe.
+func SetInternalEvents(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&internalEvents, v)
+}
+
+// Log an internal error or warning, formatted as fmt.Sprintf.
+func internalf(format string, args ...interface{}) {
+	internalLog.Printf(format, args...)
+}
+
+// Log a lifecycle event, formatted as fmt.Sprintf, unless the events are disabled.
+func internalEvent(format string, args ...interface{}) {
+	if atomic.LoadInt32(&internalEvents) != 0 {
+		internalLog.Printf(format, args...)
+	}
+}
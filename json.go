@@ -1,26 +1,407 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
-	"log"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 // JSONFormatter for logger
 type JSONFormatter struct {
-	name string
+	name   string
+	schema string // Schema tag added to each record. Empty disables the tag.
+	// Emit "severity_num" in addition to "severity", using syslog numbering if sevSyslog is set.
+	sevBoth   bool
+	sevSyslog bool
+	// Emit param values that represent a number, boolean, or null unquoted.
+	inferTypes bool
+	// Param keys whose values are pre-serialized JSON, embedded without escaping.
+	rawParams map[string]bool
+	// Timestamp layout. Empty is DefaultTimeFormat.
+	timeFormat string
+}
+
+// The record marshalled by the JSONFormatter. Adds optional fields to the EventMsg.
+type jsonRecord struct {
+	Timestamp interface{} `json:"timestamp"` // Replaces EventMsg.Timestamp, and is first
+	EventMsg
+	Params interface{} `json:"params"` // Replaces EventMsg.Params
+	SevNum *int        `json:"severity_num,omitempty"`
+	Schema string      `json:"schema,omitempty"`
+	// The "trace_id" and "span_id" params, moved to the top level. See LogEventCtx.
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
 }
 
 // JSONFormatter creates a new formatter for logger
+// Each record includes a "schema" field set to the package Version.
 func Json() *JSONFormatter {
-	return &JSONFormatter{name: "json"}
+	return &JSONFormatter{name: "json", schema: Version}
+}
+
+// Set the value of the "schema" field, so consumers can branch on format changes.
+// An empty string disables the field.
+// Returns the formatter to allow chaining, e.g. Json().Schema("2").
+func (jf *JSONFormatter) Schema(v string) *JSONFormatter {
+	jf.schema = v
+	return jf
+}
+
+// Emit the severity both as text ("severity":"WARN") and as a number ("severity_num":5),
+// for numeric-filtering backends. By default the number is the package Severity value.
+// Returns the formatter to allow chaining.
+func (jf *JSONFormatter) SeverityBoth(b bool) *JSONFormatter {
+	jf.sevBoth = b
+	return jf
+}
+
+// Use syslog numbering (Emergency=0 ... Debug=7) for "severity_num", instead of the
+// package Severity value. See SeverityBoth.
+// Returns the formatter to allow chaining.
+func (jf *JSONFormatter) SyslogSeverityNum(b bool) *JSONFormatter {
+	jf.sevSyslog = b
+	return jf
+}
+
+// Emit param values unquoted when the string clearly represents a JSON number, boolean, or
+// null, e.g. "42" as 42, "true" as true. Other values are quoted, as usual.
+//
+// Heuristics: a number must match the JSON number grammar exactly, so "007", "+1", "0x1F",
+// "1,000" and " 42" stay quoted. Numbers are copied verbatim, without float conversion, so
+// precision is not lost. Only the lowercase "true", "false" and "null" are converted.
+//
+// Risks: the type of a param may differ between events, e.g. an id of "123" versus "A123",
+// which some backends reject when a field's type changes. Use it for params with stable types.
+// Returns the formatter to allow chaining.
+func (jf *JSONFormatter) InferParamTypes(b bool) *JSONFormatter {
+	jf.inferTypes = b
+	return jf
+}
+
+// Embed the values of the given param keys as JSON, rather than as an escaped string, when
+// the value is already valid JSON, e.g. a serialized sub-document. An invalid JSON value
+// is emitted as a string. Each call replaces the previous keys.
+//
+// Example:
+//      f := logger.Json().RawParams("request")
+//      l.Info("REQ", "Received", map[string]string{"request": `{"id":1}`})
+//      // "params":{"request":{"id":1}} rather than "params":{"request":"{\"id\":1}"}
+//
+// Returns the formatter to allow chaining.
+func (jf *JSONFormatter) RawParams(keys ...string) *JSONFormatter {
+	jf.rawParams = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		jf.rawParams[k] = true
+	}
+	return jf
+}
+
+// Set the layout of the "timestamp" field, e.g. time.RFC3339, or a custom time.Format layout.
+// The TimeFormatUnix and TimeFormatUnixMilli sentinels emit Unix epoch seconds or milliseconds
+// as a number. An empty layout restores DefaultTimeFormat. ParseJSON only reads the default.
+// Returns the formatter to allow chaining.
+func (jf *JSONFormatter) SetTimeFormat(layout string) *JSONFormatter {
+	jf.timeFormat = layout
+	return jf
+}
+
+// Returns the name of the formatter
+func (jf *JSONFormatter) Name() string {
+	return jf.name
 }
 
 // Format implements the EventFormatter interface
+// Records with string params are encoded directly into a pooled buffer, without reflection.
+// Records with typed params, i.e. from InferParamTypes, RawParams or Fields, use json.Marshal.
+// The output is the same, apart from invalid UTF-8, which json.Marshal writes differently across
+// Go versions. See writeJSONString.
 func (jf *JSONFormatter) Format(em EventMsg) (msg string, err error) {
-	bMsg, jErr := json.Marshal(em)
+	rec := jf.record(em)
+	if params, ok := rec.Params.(map[string]string); ok {
+		buf := jsonBufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer jsonBufPool.Put(buf)
+		jf.encode(buf, &rec, params)
+		return buf.String(), nil
+	}
+	bMsg, jErr := jf.marshal(rec)
 	if jErr != nil {
-		log.Printf("Json error: %s (%+v)\n", jErr, em)
+		internalf("Json error: %s (%+v)\n", jErr, em)
 		return "", jErr
 	}
 	return string(bMsg), nil
 }
+
+// FormatTo implements the FormatterTo interface
+// A bytes.Buffer is encoded into directly. Other writers receive the record in one Write.
+func (jf *JSONFormatter) FormatTo(w io.Writer, em EventMsg) error {
+	rec := jf.record(em)
+	if params, ok := rec.Params.(map[string]string); ok {
+		if buf, ok := w.(*bytes.Buffer); ok {
+			jf.encode(buf, &rec, params)
+			return nil
+		}
+		buf := jsonBufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer jsonBufPool.Put(buf)
+		jf.encode(buf, &rec, params)
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	bMsg, jErr := jf.marshal(rec)
+	if jErr != nil {
+		internalf("Json error: %s (%+v)\n", jErr, em)
+		return jErr
+	}
+	_, err := w.Write(bMsg)
+	return err
+}
+
+// Returns the record of the event, with the options applied. The timestamp is formatted by
+// marshal or encode.
+func (jf *JSONFormatter) record(em EventMsg) jsonRecord {
+	rec := jsonRecord{EventMsg: em, Schema: jf.schema}
+	params := em.Params
+	rec.TraceID, rec.SpanID, params = splitTraceParams(params)
+	rec.Params = jf.params(params, em.Fields)
+	if !jf.sevBoth {
+		return rec
+	}
+	if sev := StringToSeverity(em.Sev); sev != InvalidSeverity {
+		n := int(sev)
+		if jf.sevSyslog {
+			n -= Emergency
+		}
+		rec.SevNum = &n
+	}
+	return rec
+}
+
+// Returns the record marshalled with json.Marshal.
+func (jf *JSONFormatter) marshal(rec jsonRecord) ([]byte, error) {
+	if ts := formatTimestamp(rec.EventMsg.Timestamp, jf.timeFormat); isEpochTimeFormat(jf.timeFormat) {
+		rec.Timestamp = json.Number(ts)
+	} else {
+		rec.Timestamp = ts
+	}
+	return json.Marshal(rec)
+}
+
+// Buffers of the encoder.
+var jsonBufPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// Write the record encoded as json.Marshal would, with its params. The fields are written in
+// the order of jsonRecord, and the params sorted by key.
+func (jf *JSONFormatter) encode(buf *bytes.Buffer, rec *jsonRecord, params map[string]string) {
+	buf.WriteString(`{"timestamp":`)
+	jf.writeTimestamp(buf, rec.EventMsg.Timestamp)
+	buf.WriteString(`,"severity":`)
+	writeJSONString(buf, rec.Sev)
+	buf.WriteString(`,"hostname":`)
+	writeJSONString(buf, rec.Hostname)
+	buf.WriteString(`,"appname":`)
+	writeJSONString(buf, rec.Appname)
+	buf.WriteString(`,"pid":`)
+	var num [20]byte
+	buf.Write(strconv.AppendInt(num[:0], int64(rec.Pid), 10))
+	buf.WriteString(`,"msg_id":`)
+	writeJSONString(buf, rec.MsgId)
+	buf.WriteString(`,"message":`)
+	writeJSONString(buf, rec.Msg)
+	buf.WriteString(`,"params":`)
+	writeJSONParams(buf, params)
+	if rec.SevNum != nil {
+		buf.WriteString(`,"severity_num":`)
+		buf.Write(strconv.AppendInt(num[:0], int64(*rec.SevNum), 10))
+	}
+	if rec.Schema != "" {
+		buf.WriteString(`,"schema":`)
+		writeJSONString(buf, rec.Schema)
+	}
+	if rec.TraceID != "" {
+		buf.WriteString(`,"trace_id":`)
+		writeJSONString(buf, rec.TraceID)
+	}
+	if rec.SpanID != "" {
+		buf.WriteString(`,"span_id":`)
+		writeJSONString(buf, rec.SpanID)
+	}
+	buf.WriteByte('}')
+}
+
+// Write the timestamp, formatted with the layout of the formatter, as a JSON string, or a
+// number for an epoch layout. It is formatted in a local array, and only copied if it needs
+// escaping, e.g. for a custom layout.
+func (jf *JSONFormatter) writeTimestamp(buf *bytes.Buffer, t time.Time) {
+	var arr [64]byte
+	ts := appendTimestamp(arr[:0], t, jf.timeFormat)
+	if isEpochTimeFormat(jf.timeFormat) {
+		buf.Write(ts)
+		return
+	}
+	for _, b := range ts {
+		if b >= utf8.RuneSelf || !jsonSafe(b) {
+			writeJSONString(buf, string(ts))
+			return
+		}
+	}
+	buf.WriteByte('"')
+	buf.Write(ts)
+	buf.WriteByte('"')
+}
+
+// Write the params as a JSON object, sorted by key, or null if the params are nil.
+func writeJSONParams(buf *bytes.Buffer, params map[string]string) {
+	if params == nil {
+		buf.WriteString("null")
+		return
+	}
+	// Sorted in place, so a few keys do not allocate.
+	var arr [16]string
+	keys := arr[:0]
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeJSONString(buf, k)
+		buf.WriteByte(':')
+		writeJSONString(buf, params[k])
+	}
+	buf.WriteByte('}')
+}
+
+// Returns true if the ASCII byte is written as is in a JSON string, as by json.Marshal, which
+// escapes control characters, the quote and backslash, and the HTML characters <, > and &.
+func jsonSafe(b byte) bool {
+	return b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&'
+}
+
+// Write s as a JSON string, escaped as by json.Marshal, including U+2028 and U+2029.
+// Each invalid UTF-8 byte is written as the \ufffd escape, as by json.Marshal before Go 1.22,
+// which writes the U+FFFD rune unescaped. Both decode to the same string.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if jsonSafe(b) {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch b {
+			case '\\', '"':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case '\b':
+				buf.WriteString(`\b`)
+			case '\f':
+				buf.WriteString(`\f`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == utf8.RuneError && size == 1:
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\ufffd`)
+		case c == '\u2028' || c == '\u2029':
+			buf.WriteString(s[start:i])
+			buf.WriteString(`\u202`)
+			buf.WriteByte(hex[c&0xF])
+		default:
+			i += size
+			continue
+		}
+		i += size
+		start = i
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
+
+// Returns the "trace_id" and "span_id" params, and the params without them.
+// The params are returned unchanged if they have neither.
+func splitTraceParams(params map[string]string) (traceID, spanID string, rest map[string]string) {
+	traceID, hasTrace := params[TraceIDParam]
+	spanID, hasSpan := params[SpanIDParam]
+	if !hasTrace && !hasSpan {
+		return "", "", params
+	}
+	rest = make(map[string]string, len(params))
+	for k, v := range params {
+		if k != TraceIDParam && k != SpanIDParam {
+			rest[k] = v
+		}
+	}
+	return traceID, spanID, rest
+}
+
+// Matches the JSON number grammar
+var jsonNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// Returns the params to marshal, converted by the param options. Typed fields replace the
+// params with the same key.
+func (jf *JSONFormatter) params(params map[string]string, fields Fields) interface{} {
+	if params == nil || (!jf.inferTypes && len(jf.rawParams) == 0 && len(fields) == 0) {
+		return params
+	}
+	m := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		switch {
+		case jf.rawParams[k] && json.Valid([]byte(v)):
+			m[k] = json.RawMessage(v)
+		case jf.inferTypes:
+			m[k] = inferParamType(v)
+		default:
+			m[k] = v
+		}
+	}
+	for k, v := range fields {
+		m[k] = v
+	}
+	return m
+}
+
+// Returns the value as a number, boolean, or nil if it represents one, or else the string.
+func inferParamType(v string) interface{} {
+	switch {
+	case v == "true":
+		return true
+	case v == "false":
+		return false
+	case v == "null":
+		return nil
+	case jsonNumberRegexp.MatchString(v):
+		return json.Number(v)
+	}
+	return v
+}
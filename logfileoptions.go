@@ -0,0 +1,194 @@
+// Log File Options
+// NewLogFile creates a LogFile of any policy from one set of options, rather than a constructor
+// for each combination. File, SizeLimitedFile, DailyFile, TimedFile, CronFile, LineLimitedFile
+// GzipFile and GzipSizeLimitedFile are shorthands for it.
+//
+// Example:
+//
+//	lf, err := logger.NewLogFile(logger.LogFileOptions{
+//	    Prefix:     "/var/log/myapp/app",
+//	    Policy:     logger.PolicyDaily,
+//	    RotateAt:   2 * time.Hour,
+//	    Compress:   true,
+//	    MaxBackups: 14,
+//	    FileMode:   0600,
+//	})
+package logger
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Options of a LogFile. See NewLogFile.
+type LogFileOptions struct {
+	// Full path and file name prefix, with no extension. Required.
+	Prefix string
+	// Rotation policy. Zero is PolicyNone.
+	Policy PolicyType
+	// PolicyFileSize: the size limit, clamped and rounded as in SizeLimitedFile.
+	SizeLimit int64
+	// PolicyLineLimit: the number of lines of a volume, at least 1.
+	MaxLines int
+	// PolicyTimeLimit: the rotation interval. Ignored if Schedule is set.
+	Cycle time.Duration
+	// PolicyTimeLimit: a 5-field cron schedule of the rotations, e.g. "0 */6 * * *".
+	Schedule string
+	// PolicyDaily: the local time of the rotation, as an offset from midnight, e.g. 2*time.Hour.
+	// Zero is midnight.
+	RotateAt time.Duration
+	// PolicyNone and PolicyFileSize: write gzip compressed output. See GzipFile and
+	// GzipSizeLimitedFile.
+	Gzip bool
+	// Gzip compress each volume after it is rotated. See CompressOnRotate.
+	Compress bool
+	// Retention of rotated volumes. Zero is not limited. See MaxBackups and MaxAge.
+	MaxBackups int
+	MaxAge     time.Duration
+	// Minimum free bytes on the filesystem to write. Zero is not checked. See SetMinFreeSpace.
+	MinFreeSpace uint64
+	// Permissions of the files and parent directories. Zero is 0660 and 0750.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	// Flags used to open the file. Zero is os.O_CREATE|os.O_APPEND|os.O_WRONLY. See SetOpenFlags.
+	OpenFlags int
+	// Maintain the "prefix.current.log" link to the current file. See CurrentLink.
+	CurrentLink bool
+	// Sync the file to storage after each write. See SyncEveryWrite.
+	SyncEveryWrite bool
+}
+
+// Creates a log file with the options. The file is opened, and for PolicyDaily and
+// PolicyTimeLimit, the rotation timer is started.
+//
+// Returns InvalidArgumentError if an option is not valid for the policy, e.g. a MaxLines less
+// than 1 for PolicyLineLimit, or Gzip with a policy other than PolicyNone or PolicyFileSize, and ParseError if the Schedule
+// is not valid. If an error occurs, returns nil, and an error.
+func NewLogFile(opts LogFileOptions) (lf *LogFile, err error) {
+	if opts.Policy == invalidPolicy {
+		opts.Policy = PolicyNone
+	}
+	if opts.Prefix == "" || opts.MaxBackups < 0 || opts.MaxAge < 0 ||
+		opts.FileMode&^os.ModePerm != 0 || opts.DirMode&^os.ModePerm != 0 ||
+		(opts.OpenFlags != 0 && !validOpenFlags(opts.OpenFlags)) ||
+		(opts.Gzip && opts.Policy != PolicyNone && opts.Policy != PolicyFileSize) {
+		return nil, InvalidArgumentError
+	}
+	lf = &LogFile{
+		prefix:           opts.Prefix,
+		policy:           opts.Policy,
+		gzipped:          opts.Gzip,
+		compressOnRotate: opts.Compress,
+		maxBackups:       opts.MaxBackups,
+		maxAge:           opts.MaxAge,
+		minFreeSpace:     opts.MinFreeSpace,
+		fileMode:         opts.FileMode,
+		dirMode:          opts.DirMode,
+		openFlags:        opts.OpenFlags,
+		currentLink:      opts.CurrentLink,
+		syncEveryWrite:   opts.SyncEveryWrite,
+		newTimer: func() *LogTimer {
+			return nil
+		},
+	}
+	lf.filenameGen = lf.getStaticFilename
+	lf.rotate = lf.timedRotate
+
+	// Extra fields of the start message.
+	var detail string
+	switch opts.Policy {
+	case PolicyNone:
+		lf.rotateCheck = func() bool {
+			return false
+		}
+		lf.rotate = func() bool {
+			return true
+		}
+	case PolicyFileSize:
+		size := min(max(opts.SizeLimit, LogMinFileSize), LogMaxFileSize)
+		if rem := size % LogMinFileSize; rem > 0 {
+			size = (size/LogMinFileSize)*LogMinFileSize + LogMinFileSize
+		}
+		lf.fileSizeLimit = size
+		lf.rotateCheck = lf.sizeRotateCheck
+		detail = fmt.Sprintf(", \"size_limit\":\"%d\"", lf.fileSizeLimit)
+	case PolicyLineLimit:
+		if opts.MaxLines < 1 {
+			return nil, InvalidArgumentError
+		}
+		lf.maxLines = opts.MaxLines
+		lf.rotateCheck = lf.lineRotateCheck
+		detail = fmt.Sprintf(", \"line_limit\":\"%d\"", lf.maxLines)
+	case PolicyDaily:
+		if opts.RotateAt < 0 || opts.RotateAt >= 24*time.Hour {
+			return nil, InvalidArgumentError
+		}
+		hour, minute := int(opts.RotateAt/time.Hour), int(opts.RotateAt%time.Hour/time.Minute)
+		lf.cycle = 24 * time.Hour
+		lf.filenameGen = lf.getDailyFilename
+		lf.rotateCheck = lf.timedRotateCheck
+		lf.newTimer = func() *LogTimer {
+			return NewDailyTimerAt(time.Now().Location(), hour, minute, func() {
+				_ = lf.LogRotate()
+			})
+		}
+	case PolicyTimeLimit:
+		lf.filenameGen = lf.getTimedFilename
+		lf.rotateCheck = lf.timedRotateCheck
+		if opts.Schedule != "" {
+			if _, err = parseCron(opts.Schedule); err != nil {
+				return nil, err
+			}
+			lf.newTimer = func() *LogTimer {
+				lt, _ := NewCronTimer(opts.Schedule, time.Now().Location(), func() {
+					_ = lf.LogRotate()
+				})
+				return lt
+			}
+			detail = fmt.Sprintf(", \"schedule\":\"%s\"", opts.Schedule)
+			break
+		}
+		if opts.Cycle <= 0 {
+			return nil, InvalidArgumentError
+		}
+		lf.cycle = opts.Cycle
+		lf.newTimer = func() *LogTimer {
+			return NewLocalTimer(lf.cycle, func() {
+				_ = lf.LogRotate()
+			})
+		}
+	default:
+		return nil, InvalidArgumentError
+	}
+	if opts.Gzip {
+		lf.filenameGen = lf.getGzipFilename
+	}
+
+	lf.Lock()
+	defer lf.Unlock()
+	if err = lf.openFile(lf.filenameGen()); err != nil {
+		return nil, err
+	}
+	if lf.policy == PolicyLineLimit && lf.lineRotateCheck() {
+		lf.rotate()
+	}
+	timer := "0"
+	if lf.policy.IsDaily() || lf.policy.IsTimed() {
+		if lf.ltimer = lf.newTimer(); lf.ltimer == nil {
+			lf.closeFile()
+			return nil, ParseError
+		}
+		timer = lf.ltimer.Duration().String()
+	}
+
+	internalEvent("{\"action\":\"%s\", \"policy\":\"%s\", \"file\":\"%s\"%s, \"timer\":\"%s\"}",
+		"start", lf.policy.String(), lf.currentFile, detail, timer)
+	return lf, nil
+}
+
+// Returns true if the open flags create, append and write, and do not truncate.
+func validOpenFlags(flags int) bool {
+	return flags&(os.O_CREATE|os.O_APPEND) == os.O_CREATE|os.O_APPEND && flags&os.O_TRUNC == 0 &&
+		flags&(os.O_WRONLY|os.O_RDWR) != 0
+}
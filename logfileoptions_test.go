@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestNewLogFile(t *testing.T) {
+	testName := "TestNewLogFile"
+
+	lf, err := NewLogFile(LogFileOptions{
+		Prefix:      testName,
+		Policy:      PolicyLineLimit,
+		MaxLines:    1,
+		FileMode:    0600,
+		MaxBackups:  1,
+		CurrentLink: true,
+	})
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	link := lf.currentLinkName()
+	defer os.Remove(link)
+	var names []string
+	for i := 0; i < 3; i++ {
+		names = append(names, lf.LogFilename())
+		lf.Write([]byte(testName))
+	}
+	names = append(names, lf.LogFilename())
+	lf.Close()
+	defer func() {
+		for _, name := range names {
+			os.Remove(name)
+		}
+	}()
+
+	gotestutil.AssertTrue(t, lf.LogPolicy().IsLineLimited(), GetCaller()+" Expected the line limit policy")
+	fi, err := os.Stat(names[3])
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected "+names[3])
+	gotestutil.AssertEqual(t, os.FileMode(0600), fi.Mode().Perm(), GetCaller()+" Expected the file mode")
+	_, err = os.Stat(names[0])
+	gotestutil.AssertTrue(t, os.IsNotExist(err), GetCaller()+" Expected the oldest volume removed")
+	target, _ := os.Readlink(link)
+	gotestutil.AssertEqual(t, names[3], target, GetCaller()+" Expected the current link")
+
+	// The zero policy is PolicyNone.
+	lf, err = NewLogFile(LogFileOptions{Prefix: testName + "None"})
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	gotestutil.AssertTrue(t, lf.LogPolicy().isNone(), GetCaller()+" Expected no policy")
+	lf.Close()
+	os.Remove(lf.LogFilename())
+}
+
+func TestNewLogFile_Invalid(t *testing.T) {
+	testName := "TestNewLogFile_Invalid"
+	for _, tt := range []struct {
+		name string
+		opts LogFileOptions
+		err  error
+	}{
+		{"prefix", LogFileOptions{}, InvalidArgumentError},
+		{"policy", LogFileOptions{Prefix: testName, Policy: PolicyCustom1}, InvalidArgumentError},
+		{"lines", LogFileOptions{Prefix: testName, Policy: PolicyLineLimit}, InvalidArgumentError},
+		{"cycle", LogFileOptions{Prefix: testName, Policy: PolicyTimeLimit}, InvalidArgumentError},
+		{"schedule", LogFileOptions{Prefix: testName, Policy: PolicyTimeLimit, Schedule: "* *"}, ParseError},
+		{"rotateAt", LogFileOptions{Prefix: testName, Policy: PolicyDaily, RotateAt: 24 * time.Hour}, InvalidArgumentError},
+		{"gzip", LogFileOptions{Prefix: testName, Policy: PolicyDaily, Gzip: true}, InvalidArgumentError},
+		{"mode", LogFileOptions{Prefix: testName, FileMode: os.ModeDir | 0600}, InvalidArgumentError},
+		{"flags", LogFileOptions{Prefix: testName, OpenFlags: os.O_WRONLY | os.O_TRUNC}, InvalidArgumentError},
+		{"backups", LogFileOptions{Prefix: testName, MaxBackups: -1}, InvalidArgumentError},
+	} {
+		lf, err := NewLogFile(tt.opts)
+		gotestutil.AssertEqual(t, tt.err, err, GetCaller()+" Unexpected error for "+tt.name)
+		gotestutil.AssertTrue(t, lf == nil, GetCaller()+" Expected no LogFile for "+tt.name)
+	}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogfmtFormatter formats events as logfmt key=value pairs, e.g. for Loki or Heroku.
+// The fields are followed by the params, sorted by key. Output can be read with ParseLogfmt.
+type LogfmtFormatter struct {
+	name string
+}
+
+// Create a new logfmt event message formatter.
+// Returns an EventFormatter interface.
+func Logfmt() EventFormatter {
+	return &LogfmtFormatter{name: "logfmt"}
+}
+
+// Returns the name of the formatter
+func (lf *LogfmtFormatter) Name() string {
+	return lf.name
+}
+
+// Implements EventFormatter interface.
+// Values containing a space, quote, equals sign, or control character are double-quoted
+// and escaped. Characters in keys that would break the pair are replaced with "_".
+func (lf *LogfmtFormatter) Format(em EventMsg) (msg string, err error) {
+	var b strings.Builder
+	writeLogfmtPair(&b, "timestamp", em.Timestamp.Format(time.RFC3339Nano))
+	writeLogfmtPair(&b, "severity", em.Sev)
+	writeLogfmtPair(&b, "hostname", em.Hostname)
+	writeLogfmtPair(&b, "appname", em.Appname)
+	writeLogfmtPair(&b, "pid", strconv.Itoa(em.Pid))
+	writeLogfmtPair(&b, "msg_id", em.MsgId)
+	writeLogfmtPair(&b, "message", em.Msg)
+
+	keys := make([]string, 0, len(em.Params))
+	for k := range em.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeLogfmtPair(&b, logfmtKey(k), em.Params[k])
+	}
+	return b.String(), nil
+}
+
+// Append " key=value", quoting the value if needed. The first pair has no leading space.
+func writeLogfmtPair(b *strings.Builder, k, v string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(k)
+	b.WriteByte('=')
+	if logfmtNeedsQuote(v) {
+		v = strconv.Quote(v)
+	}
+	b.WriteString(v)
+}
+
+func logfmtNeedsQuote(v string) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for _, r := range v {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace characters that are not allowed in a key.
+func logfmtKey(k string) string {
+	if len(k) == 0 {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, k)
+}
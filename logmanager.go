@@ -28,37 +28,123 @@
 package logger
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// Public constants
+const (
+	// Package version. Used as the default schema tag for formatted records.
+	Version = "1.0.0"
+)
+
 // Private constants
-const ()
+const (
+	// Message ID of events logged by HTTPRequest.
+	httpRequestMsgId = "HTTP_REQUEST"
+)
 
+// A writer of formatted messages, e.g. a LogFile.
+// LogWriters of this package must be created by the provided functions, e.g. File, NewLogFile
+// or Stderr. A zero value, e.g. &LogFile{}, is not usable, and is rejected by the Log.
 type LogWriter interface {
 	io.WriteCloser
 }
 
+// A LogWriter registered with the Log, and its severity filter and formatter.
+type logModule struct {
+	LogWriter
+	filter    Severity       // InvalidSeverity uses the Log filter
+	formatter EventFormatter // Nil uses the Log formatter
+}
+
+// Implemented by a LogWriter that buffers output.
+type Flusher interface {
+	Flush() error
+}
+
+// Implemented by a LogWriter that keeps the severity of each message, e.g. the RingWriter.
+// The Log detects it, and calls WriteSeverity rather than Write.
+type SeverityWriter interface {
+	WriteSeverity(sev Severity, p []byte) (n int, err error)
+}
+
 type Logger interface {
 	New(app string, lwc LogWriter) *Log
-	Close()
+	Close() error
 	AddLogger(lwc LogWriter)
 	LogEvent(sev Severity, msgId string, msg string, params map[string]string)
 }
 
 type Log struct {
-	version    string
-	hostname   string
-	appname    string
-	filter     Severity
-	logModules []LogWriter
-	formatter  EventFormatter
+	// The writers, filter and formatter, shared with child loggers.
+	*logState
+	version  string
+	hostname string
+	appname  string
+	// Set on a child logger, whose Close does nothing. See child.
+	isChild bool
+	// Base params added to each event, e.g. by a child logger.
+	fields map[string]string
+	// Prefix of the param keys. See WithNamespace.
+	namespace string
+	// Context keys logged as params by LogEventCtx. See WithContextValue.
+	ctxValues []contextValue
+	// Extracts the trace and span ids in LogEventCtx. See SetTraceExtractor.
+	traceExtractor TraceExtractor
+	// Message ids logged by Once. Shared with child loggers.
+	onceSeen *sync.Map
+	// Replace invalid UTF-8 in events. See SetRepairUTF8.
+	repairUTF8 bool
+	// Detail level of the caller param. See SetCallerFormat.
+	callerFormat CallerFormat
+	// Include the goroutine id in each event. For debugging only.
+	reportGoroutineID bool
+	// Trace sampling. See SetTraceSampling.
+	sampleKey  string
+	sampleRate uint32
+	// Limits the events of a msgId. See SetSampler.
+	sampler Sampler
+	// Params merged into each event, a map[string]string. Shared with child loggers.
+	defaultParams *atomic.Value
+	// Construction time, with a monotonic clock reading. See SetReportUptime.
+	start        time.Time
+	reportUptime bool
+	// Called when a module's Write fails. See SetErrorHandler.
+	errorHandler func(w LogWriter, err error)
+}
+
+// The state of a Log that its child loggers share, so a change by either, e.g. SetFilter,
+// RemoveLogger or Close, applies to both.
+type logState struct {
+	// A Severity. Accessed atomically, as it may be changed while logging. See SetFilter.
+	filter     int32
+	logModules []logModule // Copy on write. See modules.
+	// The Log formatter, a formatterValue, replaced while logging, e.g. by WatchConfig.
+	formatter atomic.Value
+	// Rules that override the filter for matching events, a []FilterRule. Replaced as a whole,
+	// so LogEvent loads them once, without a lock. See SetFilterRules.
+	filterRules atomic.Value
+	// Queue of the background writer in async mode, an *asyncQueue, or nil. Set under modulesMu,
+	// and loaded by LogEvent without a lock. See AsyncBuffer.
+	async atomic.Value
+	// Guards logModules. Read locked by LogEvent.
+	modulesMu sync.RWMutex
+	// Set by Close. Guarded by modulesMu.
+	closed bool
 }
 
 type EventMsg struct {
@@ -70,6 +156,7 @@ type EventMsg struct {
 	MsgId     string            `json:"msg_id"`
 	Msg       string            `json:"message"`
 	Params    map[string]string `json:"params"`
+	Fields    Fields            `json:"-"` // Typed values of Params, see LogEventF
 }
 
 var (
@@ -77,17 +164,45 @@ var (
 	InvalidArgumentError error = errors.New("Invalid Argument Exception")
 )
 
+// The error passed to the error handler when a module's Write fails. See SetErrorHandler.
+type WriteError struct {
+	Filename string // The LogFilename of the writer, if it is a FileWriter, else empty.
+	Length   int    // The length of the formatted message.
+	Err      error  // The error returned by Write.
+}
+
+func (e *WriteError) Error() string {
+	if e.Filename == "" {
+		return fmt.Sprintf("write of %d bytes failed: %s", e.Length, e.Err)
+	}
+	return fmt.Sprintf("write of %d bytes to \"%s\" failed: %s", e.Length, e.Filename, e.Err)
+}
+
+// Returns the error returned by Write, for errors.Is and errors.As.
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
 func init() {
 }
 
 // Create a new LogManager.
 // app is a string distinguishing the application in the logs
-// lwc is a LogWriterClose which receives the logged messages.
+// lwc is a LogWriterClose which receives the logged messages. If lwc is nil, or not usable,
+// e.g. a LogFile that was not created by a constructor, a Stderr() writer is installed, and a
+// warning is logged.
 func LogManger(app string, lwc LogWriter) *Log {
+	if lwc == nil {
+		internalf("logger.LogManger WARN: No LogWriter specified. Logging to stderr.")
+		lwc = Stderr()
+	} else if validateWriter(lwc) != nil {
+		internalf("logger.LogManger WARN: Invalid LogWriter (%T). Logging to stderr.", lwc)
+		lwc = Stderr()
+	}
 	h, _ := os.Hostname()
-	l := &Log{hostname: h, appname: app}
-	l.logModules = make([]LogWriter, 1)
-	l.logModules[0] = lwc
+	l := &Log{version: Version, hostname: h, appname: app, onceSeen: &sync.Map{},
+		defaultParams: &atomic.Value{}, start: time.Now(), logState: &logState{}}
+	l.logModules = []logModule{{LogWriter: lwc, filter: InvalidSeverity}}
 	l.SetFormatter(Json())
 	l.filter = Debug
 	return l
@@ -95,56 +210,545 @@ func LogManger(app string, lwc LogWriter) *Log {
 
 // Set the event formatter for the log record
 // Parameter ef must implement the logger.EventFormatter interface.
+// This is goroutine safe.
 func (l *Log) SetFormatter(ef EventFormatter) {
-	l.formatter = ef
+	l.formatter.Store(formatterValue{ef})
+}
+
+// Wraps the formatter, so formatters of different types can be stored in an atomic.Value.
+type formatterValue struct {
+	EventFormatter
+}
+
+// Returns the Log formatter.
+func (l *Log) getFormatter() EventFormatter {
+	fv, _ := l.formatter.Load().(formatterValue)
+	return fv.EventFormatter
 }
 
 // Set the event message filter level.
 // The filter only writes for at a Severity level >= the current filter.
 // If the Severity value is invalid, and error is returned.
+// This is goroutine safe, e.g. to raise the level to Debug from an admin endpoint while logging.
 func (l *Log) SetFilter(sev Severity) (err error) {
-	if l.filter < SeverityMinLevel || l.filter > SeverityMaxLevel {
+	if !sev.isValid() {
 		return InvalidArgumentError
 	}
-	l.filter = sev
+	atomic.StoreInt32(&l.filter, int32(sev))
 	return err
 }
 
 // Returns the current filter level
 func (l *Log) GetFilter() Severity {
-	return l.filter
+	return Severity(atomic.LoadInt32(&l.filter))
+}
+
+// Include the id of the logging goroutine as the "goroutine_id" param of each event.
+// This is intended for debugging, e.g. deadlocks, and has a cost on every event: the id is not
+// cached, since Go has no goroutine-local storage, so each event parses it from the
+// runtime.Stack header, which takes microseconds.
+func (l *Log) SetReportGoroutineID(b bool) {
+	l.reportGoroutineID = b
+}
+
+// Set params that are merged into the params of every event, e.g. a static "env" or "region".
+// Params passed at the call site, and base params of a child logger, win on a key collision.
+// The map is copied, so later changes to it have no effect. A nil map clears the defaults.
+// The defaults are shared with child loggers. This is goroutine safe.
+func (l *Log) SetDefaultParams(params map[string]string) {
+	l.defaultParams.Store(copyParams(params))
+}
+
+// Include the milliseconds since the LogManger was created as the "uptime_ms" param of each
+// event. It uses the monotonic clock, so it is not affected by wall-clock changes, and can
+// correlate events with the process lifetime. Child loggers share the start time.
+func (l *Log) SetReportUptime(b bool) {
+	l.reportUptime = b
+}
+
+// Validate the encoding of each event, replacing invalid UTF-8 bytes in the message,
+// msgId, and params with U+FFFD, so no invalid UTF-8 reaches the formatters.
+// Output is written as UTF-8 without a byte order mark (BOM).
+func (l *Log) SetRepairUTF8(b bool) {
+	l.repairUTF8 = b
+}
+
+// Set a function called when a module's Write returns an error, e.g. to alert, or remove a
+// failing writer. The error is a *WriteError, with the file name of the writer, if any, and the
+// length of the formatted message. In async mode, it is called from the background goroutine.
+// A nil handler, the default, ignores write errors.
+func (l *Log) SetErrorHandler(h func(w LogWriter, err error)) {
+	l.errorHandler = h
 }
 
 // Add another logger to the manager
-// lwc is a LogWriterCloser
+// lwc is a LogWriterCloser. If it is not usable, e.g. nil, a warning is logged, and it is not added.
+// This is goroutine safe.
 func (l *Log) AddLogger(lwc LogWriter) {
-	l.logModules = append(l.logModules, lwc)
+	l.addModule(logModule{LogWriter: lwc, filter: InvalidSeverity})
+}
+
+// Add a log writer with its own formatter, e.g. a JSON file alongside a plain text stderr writer.
+// A nil formatter uses the Log formatter (see SetFormatter). A writer that is not usable is not
+// added, as in AddLogger.
+// This is goroutine safe.
+func (l *Log) AddLoggerWithFormatter(lwc LogWriter, ef EventFormatter) {
+	l.addModule(logModule{LogWriter: lwc, filter: InvalidSeverity, formatter: ef})
+}
+
+// Add a log writer with its own severity filter, e.g. an errors-only file alongside a debug file.
+// The module only writes events at a Severity level >= the filter, instead of the Log filter.
+// Filter rules (see SetFilterRules) still take precedence over the module filter.
+// If the Severity value is invalid, or the writer is not usable, an error is returned, and the
+// writer is not added.
+// This is goroutine safe.
+func (l *Log) AddLoggerWithFilter(lwc LogWriter, filter Severity) error {
+	if !filter.isValid() {
+		return InvalidArgumentError
+	}
+	return l.addModule(logModule{LogWriter: lwc, filter: filter})
+}
+
+// Add a log writer with its own severity filter and formatter, as AddLoggerWithFilter and
+// AddLoggerWithFormatter, e.g. a console summary of the warnings alongside a JSON file.
+// This is goroutine safe.
+func (l *Log) AddLoggerWithFilterAndFormatter(lwc LogWriter, filter Severity, ef EventFormatter) error {
+	if !filter.isValid() {
+		return InvalidArgumentError
+	}
+	return l.addModule(logModule{LogWriter: lwc, filter: filter, formatter: ef})
+}
+
+// Add a file with full detail, and a console with summaries, a common development and production
+// hybrid, e.g. l.AddFileAndConsole(lf, Stderr()). The file gets each event that passes the Log
+// filter as JSON, and the console gets WARN and above as a one-line summary (see Console).
+// If either writer is not usable, InvalidArgumentError is returned, and neither is added.
+// This is goroutine safe.
+func (l *Log) AddFileAndConsole(file, console LogWriter) error {
+	if validateWriter(file) != nil || validateWriter(console) != nil {
+		internalf("logger.AddFileAndConsole WARN: Invalid LogWriter (%T, %T). Not added.", file, console)
+		return InvalidArgumentError
+	}
+	l.AddLoggerWithFormatter(file, Json())
+	return l.AddLoggerWithFilterAndFormatter(console, Warning, Console())
+}
+
+// Remove a log writer, e.g. a temporary debug file, without closing it, or changing the
+// other writers. Returns false if lwc is not a writer of the Log.
+// In async mode, messages already queued for lwc are still written to it.
+// This is goroutine safe.
+func (l *Log) RemoveLogger(lwc LogWriter) bool {
+	l.modulesMu.Lock()
+	defer l.modulesMu.Unlock()
+
+	i := l.moduleIndex(lwc)
+	if i < 0 {
+		return false
+	}
+	mods := make([]logModule, 0, len(l.logModules)-1)
+	mods = append(mods, l.logModules[:i]...)
+	l.logModules = append(mods, l.logModules[i+1:]...)
+	return true
+}
+
+// Remove a log writer, and close it. In async mode, the queued messages are written first.
+// Returns InvalidArgumentError if lwc is not a writer of the Log, else the error of Close.
+// This is goroutine safe.
+func (l *Log) CloseLogger(lwc LogWriter) error {
+	if !l.RemoveLogger(lwc) {
+		return InvalidArgumentError
+	}
+	if aq := l.getAsync(); aq != nil {
+		aq.flush()
+	}
+	return lwc.Close()
+}
+
+// Replace the log writer old with lwc, keeping its filter and formatter, e.g. to swap a file
+// after moving it. The old writer is not closed. Returns false if old is not a writer of the Log,
+// or lwc is not usable.
+// This is goroutine safe.
+func (l *Log) ReplaceLogger(old, lwc LogWriter) bool {
+	if validateWriter(lwc) != nil {
+		return false
+	}
+	l.modulesMu.Lock()
+	defer l.modulesMu.Unlock()
+
+	i := l.moduleIndex(old)
+	if i < 0 {
+		return false
+	}
+	mods := append([]logModule(nil), l.logModules...)
+	mods[i].LogWriter = lwc
+	l.logModules = mods
+	return true
+}
+
+// Returns the modules. The slice is not changed after it is published, so it may be iterated
+// without holding the lock.
+func (l *Log) modules() []logModule {
+	l.modulesMu.RLock()
+	defer l.modulesMu.RUnlock()
+	return l.logModules
+}
+
+// Add a module. The slice is copied, so a snapshot of the modules is not changed.
+// If the writer is not usable, a warning is logged, and InvalidArgumentError returned.
+func (l *Log) addModule(mod logModule) error {
+	if err := validateWriter(mod.LogWriter); err != nil {
+		internalf("logger.AddLogger WARN: Invalid LogWriter (%T). Not added.", mod.LogWriter)
+		return err
+	}
+	l.modulesMu.Lock()
+	defer l.modulesMu.Unlock()
+	mods := make([]logModule, len(l.logModules), len(l.logModules)+1)
+	copy(mods, l.logModules)
+	l.logModules = append(mods, mod)
+	return nil
+}
+
+// Returns InvalidArgumentError if the writer is clearly not usable, i.e. nil, a nil pointer,
+// a LogFile that was not created by a constructor, e.g. &LogFile{}, or another FileWriter with
+// no file name.
+func validateWriter(lwc LogWriter) error {
+	if lwc != nil {
+		if v := reflect.ValueOf(lwc); v.Kind() == reflect.Ptr && v.IsNil() {
+			return InvalidArgumentError
+		}
+	}
+	switch w := lwc.(type) {
+	case nil:
+		return InvalidArgumentError
+	case *LogFile:
+		if w.filenameGen == nil {
+			return InvalidArgumentError
+		}
+	case FileWriter:
+		if w.LogFilename() == "" {
+			return InvalidArgumentError
+		}
+	}
+	return nil
+}
+
+// Returns the index of the module of lwc, or -1.
+// The caller must hold modulesMu.
+func (l *Log) moduleIndex(lwc LogWriter) int {
+	if lwc == nil || !reflect.TypeOf(lwc).Comparable() {
+		return -1
+	}
+	for i, mod := range l.logModules {
+		if reflect.TypeOf(mod.LogWriter).Comparable() && mod.LogWriter == lwc {
+			return i
+		}
+	}
+	return -1
+}
+
+// Flush all modules that implement the Flusher interface.
+// In async mode, first waits until the queued messages are written, unless called from a
+// module's Write, which would wait for itself. See Barrier.
+// Every module is flushed, and the first error is returned.
+func (l *Log) Flush() (err error) {
+	if aq := l.getAsync(); aq != nil {
+		aq.flush()
+	}
+	for _, mod := range l.modules() {
+		if f, ok := mod.LogWriter.(Flusher); ok {
+			if fErr := f.Flush(); fErr != nil && err == nil {
+				err = fErr
+			}
+		}
+	}
+	return
+}
+
+// Rotate each log writer that is a rotating file, e.g. a LogFile, now. See LogFile.ForceRotate.
+// Every file is rotated, even if one fails. Returns the first error, if any.
+func (l *Log) Rotate() (err error) {
+	for _, mod := range l.modules() {
+		if r, ok := mod.LogWriter.(interface {
+			ForceRotate() error
+		}); ok {
+			if rErr := r.ForceRotate(); rErr != nil && err == nil {
+				err = rErr
+			}
+		}
+	}
+	return
+}
+
+// Reopen each log writer that is a file, e.g. a LogFile, with the same name. See LogFile.Reopen.
+// Every file is reopened, even if one fails. Returns the first error, if any.
+func (l *Log) ReopenAll() (err error) {
+	for _, mod := range l.modules() {
+		if r, ok := mod.LogWriter.(interface {
+			Reopen() error
+		}); ok {
+			if rErr := r.Reopen(); rErr != nil && err == nil {
+				err = rErr
+			}
+		}
+	}
+	return
+}
+
+// Reopen the files of the Log (see ReopenAll) when the process receives one of the signals, or
+// SIGHUP if none is given, e.g. from the postrotate script of logrotate(8):
+//
+//	stop := l.ReopenOnSignal()
+//	defer stop()
+//
+// An error is logged by the internal logger, see SetInternalLogger. Call stop to remove the
+// signal handler.
+func (l *Log) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := l.ReopenAll(); err != nil {
+					internalf("%s: Error reopening log files. %s", GetCaller(), err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
 }
 
 // Close all log interfaces
-func (l *Log) Close() {
-	for _, mod := range l.logModules {
-		mod.Close()
+// In async mode, the queued messages are written, and the background goroutine stopped, first.
+// Every writer is closed, even if one fails, e.g. a network writer that could not send its
+// buffer. Returns the errors joined, if any.
+// Close is idempotent. Calling it again does nothing, and returns nil.
+// Close of a child logger does nothing, and returns nil, as the writers belong to the parent.
+// The children of a closed Log write nothing.
+func (l *Log) Close() error {
+	if l.isChild {
+		return nil
+	}
+	l.modulesMu.Lock()
+	if l.closed {
+		l.modulesMu.Unlock()
+		return nil
 	}
+	l.closed = true
+	mods := l.logModules
 	l.logModules = nil
+	l.modulesMu.Unlock()
+
+	// The queued messages hold their writers, so they are written after the modules are removed.
+	if aq := l.getAsync(); aq != nil {
+		aq.close()
+	}
+	var errs []error
+	for _, mod := range mods {
+		if err := mod.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // Write a message to the log(s)
 func (l *Log) LogEvent(sev Severity, msgId string, msg string, params map[string]string) {
-	if sev > l.filter {
+	l.logEvent(sev, msgId, msg, params, nil)
+}
+
+// Write a message to the log(s), with the typed values of the params in fields, if any.
+func (l *Log) logEvent(sev Severity, msgId string, msg string, params map[string]string, fields Fields) {
+	rule := l.ruleThreshold(msgId, params)
+	if !l.accepts(sev, rule) {
+		return
+	}
+	if !l.keepTraceSample(params) {
+		return
+	}
+	if !l.keepSample(msgId) {
 		return
 	}
 
 	em := validateEventMsg(l.newEventMsg(sev, msgId, msg, params))
-	str, err := l.formatter.Format(*em)
-	if err != nil {
-		log.Println("logger.LogEvent WARN: Error in formatting message. No log output generated.")
+	// The modules get formatted messages, even in async mode, so the event is released on return.
+	defer releaseEventMsg(em)
+	em.Fields = l.keyFields(fields)
+	if l.repairUTF8 {
+		em = repairEventMsgUTF8(em)
+	}
+	// Each formatter formats the event once, for the modules that share it.
+	var formatted []formattedMsg
+	global, lf, aq := l.GetFilter(), l.getFormatter(), l.getAsync()
+	for _, mod := range l.modules() {
+		if sev > mod.threshold(rule, global) {
+			continue
+		}
+		ef := mod.formatter
+		if ef == nil {
+			ef = lf
+		}
+		var bMsg []byte
+		formatted, bMsg = formatOnce(formatted, ef, em)
+		if bMsg == nil {
+			continue
+		}
+		if aq != nil {
+			aq.enqueue(mod.LogWriter, sev, bMsg, l.errorHandler)
+			continue
+		}
+		writeModule(mod.LogWriter, sev, bMsg, l.errorHandler)
+	}
+}
+
+// Write a formatted message to a module, with the severity if it is a SeverityWriter, and call
+// the error handler, if any, on failure.
+func writeModule(w LogWriter, sev Severity, msg []byte, handler func(w LogWriter, err error)) {
+	var err error
+	if sw, ok := w.(SeverityWriter); ok {
+		_, err = sw.WriteSeverity(sev, msg)
+	} else {
+		_, err = w.Write(msg)
+	}
+	if err == nil || handler == nil {
 		return
 	}
-	bMsg := []byte(str)
-	for _, mod := range l.logModules {
-		mod.Write(bMsg)
+	we := &WriteError{Length: len(msg), Err: err}
+	if fw, ok := w.(FileWriter); ok {
+		we.Filename = fw.LogFilename()
 	}
+	handler(w, we)
+}
+
+// Buffers of the FormatterTo formatters.
+var formatBufPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// The output of a formatter for an event. A nil msg indicates a formatting error.
+type formattedMsg struct {
+	ef  EventFormatter
+	msg []byte
+}
+
+// Returns the event formatted by ef, reusing the output in formatted if ef already formatted it.
+// Formatters of a type that is not comparable are not reused.
+// Returns the updated outputs, and the message, or nil if formatting failed.
+func formatOnce(formatted []formattedMsg, ef EventFormatter, em *EventMsg) ([]formattedMsg, []byte) {
+	comparable := reflect.TypeOf(ef).Comparable()
+	if comparable {
+		for _, f := range formatted {
+			if f.ef == ef {
+				return formatted, f.msg
+			}
+		}
+	}
+	var bMsg []byte
+	if bf, ok := ef.(BinaryFormatter); ok {
+		var err error
+		if bMsg, err = bf.FormatBinary(nil, *em); err != nil {
+			internalf("logger.LogEvent WARN: Error in formatting message. No log output generated.")
+			bMsg = nil
+		}
+	} else if ft, ok := ef.(FormatterTo); ok {
+		buf := formatBufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		if err := ft.FormatTo(buf, *em); err != nil {
+			internalf("logger.LogEvent WARN: Error in formatting message. No log output generated.")
+		} else {
+			// Copied, as the message is retained by the async writer, and shared by modules.
+			bMsg = append([]byte(nil), buf.Bytes()...)
+		}
+		formatBufPool.Put(buf)
+	} else if str, err := ef.Format(*em); err != nil {
+		internalf("logger.LogEvent WARN: Error in formatting message. No log output generated.")
+	} else {
+		bMsg = []byte(str)
+	}
+	if comparable {
+		formatted = append(formatted, formattedMsg{ef: ef, msg: bMsg})
+	}
+	return formatted, bMsg
+}
+
+// Log a message at most once per process for a given msgId, e.g. for startup, deprecation,
+// or config default warnings. Repeated calls with the same msgId are suppressed.
+// This is goroutine safe.
+func (l *Log) Once(sev Severity, msgId string, msg string, params map[string]string) {
+	if _, seen := l.onceSeen.LoadOrStore(msgId, true); seen {
+		return
+	}
+	l.LogEvent(sev, msgId, msg, params)
+}
+
+// Forget the message ids logged by Once, so they are logged again. Intended for tests.
+func (l *Log) ResetOnce() {
+	l.onceSeen.Range(func(k, v interface{}) bool {
+		l.onceSeen.Delete(k)
+		return true
+	})
+}
+
+// Start timing an operation. Returns a function that, when called, logs an INFO event for
+// the msgId with a "duration_ms" param of the elapsed milliseconds since Timer was called.
+//
+// Example:
+//      done := l.Timer("DBQUERY")
+//      rows := db.Query(...)
+//      done(map[string]string{"rows": strconv.Itoa(len(rows))})
+func (l *Log) Timer(msgId string) func(params map[string]string) {
+	start := time.Now()
+	return func(params map[string]string) {
+		d := time.Since(start)
+		params = copyParams(params)
+		params["duration_ms"] = strconv.FormatInt(int64(d/time.Millisecond), 10)
+		l.LogEvent(Info, msgId, msgId+" completed in "+d.String(), params)
+	}
+}
+
+// Log a served HTTP request, with the msgId "HTTP_REQUEST", and the params
+// method, path, proto, remote_addr, status, duration_ms, and user_agent, added to any given
+// params. The referer param is added if the request has one. See also Apache().
+// The severity is based on the status class: 5xx is ERROR, 4xx is WARNING, else INFO.
+//
+// Example:
+//      start := time.Now()
+//      h.ServeHTTP(rec, r)
+//      l.HTTPRequest(r, rec.status, time.Since(start), nil)
+func (l *Log) HTTPRequest(r *http.Request, status int, dur time.Duration, params map[string]string) {
+	var sev Severity = Info
+	switch {
+	case status >= 500:
+		sev = Error
+	case status >= 400:
+		sev = Warning
+	}
+	params = copyParams(params)
+	params["method"] = r.Method
+	params["path"] = r.URL.Path
+	params["proto"] = r.Proto
+	params["remote_addr"] = r.RemoteAddr
+	params["status"] = strconv.Itoa(status)
+	params["duration_ms"] = strconv.FormatInt(int64(dur/time.Millisecond), 10)
+	params["user_agent"] = r.UserAgent()
+	if ref := r.Referer(); len(ref) > 0 {
+		params["referer"] = ref
+	}
+	l.LogEvent(sev, httpRequestMsgId, fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status), params)
 }
 
 // Convenience fnction to log an EMERGENCY level message
@@ -204,12 +808,27 @@ func (l *Log) Debug(msgId string, msg string, params map[string]string) {
 func (l *Log) newEventMsg(sev Severity, msgId string, msg string, params map[string]string) *EventMsg {
 	defer func() {
 		if x := recover(); x != nil {
-			fmt.Printf("Error writing log: %s\n", x)
+			internalf("Error writing log: %s", x)
 			return
 		}
 	}()
 
-	em := EventMsg{
+	params = l.mergeFields(params)
+	if l.reportGoroutineID {
+		params = copyParams(params)
+		params["goroutine_id"] = goroutineID()
+	}
+	if l.callerFormat != CallerNone {
+		params = copyParams(params)
+		params["caller"] = caller(l.callerFormat)
+	}
+	if l.reportUptime {
+		params = copyParams(params)
+		params["uptime_ms"] = strconv.FormatInt(int64(time.Since(l.start)/time.Millisecond), 10)
+	}
+
+	em := eventMsgPool.Get().(*EventMsg)
+	*em = EventMsg{
 		Sev:       sev.String(),
 		Pid:       os.Getpid(),
 		Hostname:  l.hostname,
@@ -219,7 +838,45 @@ func (l *Log) newEventMsg(sev Severity, msgId string, msg string, params map[str
 		Params:    params,
 		Msg:       msg}
 
-	return &em
+	return em
+}
+
+// Events created by newEventMsg, reused to reduce allocations under a high log volume.
+var eventMsgPool = sync.Pool{
+	New: func() interface{} {
+		return new(EventMsg)
+	},
+}
+
+// Return an event to the pool. The event is cleared, so the pool does not keep its params.
+// It must not be used after.
+func releaseEventMsg(em *EventMsg) {
+	*em = EventMsg{}
+	eventMsgPool.Put(em)
+}
+
+// Returns a copy of the params, so they can be modified without changing the caller's map.
+// A nil map returns an empty map.
+func copyParams(params map[string]string) map[string]string {
+	c := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		c[k] = v
+	}
+	return c
+}
+
+// Returns the id of the current goroutine.
+// The id is parsed from the header of runtime.Stack, i.e. "goroutine 123 [running]:", on each
+// call, as it cannot be cached per goroutine. runtime.Stack formats the caller's stack, so this
+// is not cheap.
+func goroutineID() string {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	return string(b)
 }
 
 // Get the caller function/method name in the stack.
@@ -1,12 +1,22 @@
 package logger
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http/httptest"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/mooredwightd/gotestutil"
 )
@@ -22,6 +32,51 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// A LogWriter that keeps each message in memory.
+type testWriter struct {
+	lines []string
+	sync.Mutex
+}
+
+func (tw *testWriter) Write(p []byte) (int, error) {
+	tw.Lock()
+	defer tw.Unlock()
+	tw.lines = append(tw.lines, string(p))
+	return len(p), nil
+}
+
+func (tw *testWriter) Close() error {
+	return nil
+}
+
+// Returns the written messages
+func (tw *testWriter) Lines() []string {
+	tw.Lock()
+	defer tw.Unlock()
+	return append([]string(nil), tw.lines...)
+}
+
+// Returns the written JSON messages as EventMsgs
+func (tw *testWriter) Events(t *testing.T) []EventMsg {
+	var ems []EventMsg
+	for _, s := range tw.Lines() {
+		em, err := ParseJSON(s)
+		gotestutil.AssertNil(t, err, GetCaller()+fmt.Sprintf(" %s: %s", err, s))
+		ems = append(ems, em)
+	}
+	return ems
+}
+
+// An EventFormatter that counts calls to Format.
+type spyFormatter struct {
+	calls int
+}
+
+func (sf *spyFormatter) Format(em EventMsg) (string, error) {
+	sf.calls++
+	return em.Msg, nil
+}
+
 func checkForJsonFields(t *testing.T, fmap map[int]string) (found bool) {
 	found = true
 	flds1 := []string{"timestamp", "severity", "hostname", "appname",
@@ -79,23 +134,58 @@ func TestSeverity_String(t *testing.T) {
 		gotestutil.AssertEqual(t, severityToString[0], v, GetCaller()+" Expected panic")
 	})
 
-	// Should fail for invalid Severity type.
-	// Throws a panic
+	// Should not panic for an out of range Severity.
 	runName = testName + "=3"
 	t.Run(runName, func(t *testing.T) {
-		defer func() {
-			if x := recover(); x != nil {
-				log.Printf("%s caught panic %s", runName, x)
-				return
-			}
-		}()
-
 		v := Severity(100).String()
-		gotestutil.AssertEqual(t, "", v, GetCaller()+" Expected panic")
+		gotestutil.AssertEqual(t, "UNKNOWN(100)", v, GetCaller()+" Expected UNKNOWN(100)")
+		v = Severity(-5).String()
+		gotestutil.AssertEqual(t, "UNKNOWN(-5)", v, GetCaller()+" Expected UNKNOWN(-5)")
+		v = Severity(InvalidSeverity).String()
+		gotestutil.AssertEqual(t, "Invalid", v, GetCaller()+" Expected Invalid")
 	})
 
 }
 
+func TestSeverity_SyslogPriority(t *testing.T) {
+	for i, s := range []Severity{Emergency, Alert, Critical, Error, Warning, Notice, Info, Debug} {
+		gotestutil.AssertEqual(t, i, s.SyslogPriority(), GetCaller()+" Expected the syslog code of "+s.String())
+	}
+	gotestutil.AssertEqual(t, -1, Severity(InvalidSeverity).SyslogPriority(), GetCaller()+" Expected -1")
+	gotestutil.AssertEqual(t, -1, Severity(100).SyslogPriority(), GetCaller()+" Expected -1")
+
+	gotestutil.AssertEqual(t, 134, ComputePRI(16, Info), GetCaller()+" Expected local0.info")
+	gotestutil.AssertEqual(t, 0, ComputePRI(0, Emergency), GetCaller()+" Expected kern.emerg")
+	gotestutil.AssertEqual(t, -1, ComputePRI(24, Info), GetCaller()+" Expected an invalid facility")
+	gotestutil.AssertEqual(t, -1, ComputePRI(1, Severity(100)), GetCaller()+" Expected an invalid severity")
+}
+
+func TestRegisterSeverity(t *testing.T) {
+	testName := "TestRegisterSeverity"
+	trace := Severity(Debug + 1)
+	gotestutil.AssertNil(t, RegisterSeverity("trace", trace), GetCaller()+" Expected TRACE registered")
+	gotestutil.AssertEqual(t, "TRACE", trace.String(), GetCaller()+" Expected the name")
+	gotestutil.AssertEqual(t, trace, StringToSeverity("Trace"), GetCaller()+" Expected the level")
+
+	for _, tt := range []struct {
+		name  string
+		level Severity
+	}{{"TRACE", trace + 1}, {"VERBOSE", trace}, {"VERBOSE", Debug}, {" ", trace + 1}, {"DEBUG", trace + 1}} {
+		gotestutil.AssertEqual(t, InvalidArgumentError, RegisterSeverity(tt.name, tt.level),
+			GetCaller()+" Expected an error for "+tt.name)
+	}
+
+	// Filtered by the default filter, until the filter is raised.
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	l.SetFormatter(&spyFormatter{})
+	l.LogEvent(trace, testName, "filtered", nil)
+	gotestutil.AssertNil(t, l.SetFilter(trace), GetCaller()+" Expected a valid filter")
+	l.LogEvent(trace, testName, "traced", nil)
+	gotestutil.AssertEqual(t, []string{"traced"}, tw.Lines(), GetCaller()+" Expected the custom level logged")
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.SetFilter(trace+5), GetCaller()+" Expected an unregistered level rejected")
+}
+
 func TestIsValidSeverity(t *testing.T) {
 	testName := "TestIsValidSeverity"
 	var ok bool
@@ -121,6 +211,29 @@ func TestIsValidSeverity(t *testing.T) {
 
 }
 
+func TestStringToSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want Severity
+	}{
+		{"warn", Warning},
+		{"warning", Warning},
+		{"Information", Info},
+		{"err", Error},
+		{"CRITICAL", Critical},
+		{" notice ", Notice},
+		{"emergency", Emergency},
+		{"BLAHH", InvalidSeverity},
+		{"", InvalidSeverity},
+	} {
+		gotestutil.AssertEqual(t, tt.want, StringToSeverity(tt.s), GetCaller()+" Unexpected level of "+tt.s)
+	}
+	// TRACE is Debug, unless it is registered as a custom level.
+	if trace := StringToSeverity("trace"); trace != Debug {
+		gotestutil.AssertEqual(t, "TRACE", trace.String(), GetCaller()+" Expected a registered TRACE")
+	}
+}
+
 func TestLogManger(t *testing.T) {
 	testName := "TestNewLogManager01"
 
@@ -146,7 +259,7 @@ func TestLogManger(t *testing.T) {
 	})
 
 	// Invalid LogFile paramter for New File
-	// Alert should panic
+	// Falls back to stderr, and Alert should not panic
 	t.Run(testName+"=2", func(t *testing.T) {
 		//var except = false
 		defer func() {
@@ -158,11 +271,35 @@ func TestLogManger(t *testing.T) {
 			}
 		}()
 		lf := &LogFile{}
+		_, err := lf.Write([]byte(testName))
+		gotestutil.AssertEqual(t, FileNotOpenError, err, GetCaller()+" Expected a write to a zero value to fail")
 		l := LogManger("TestNew", lf)
+		gotestutil.AssertTrue(t, l.logModules[0].LogWriter != lf, GetCaller()+" Expected the writer replaced")
 		l.Alert(testName, "TestNew01 test msg", map[string]string{})
 	})
 }
 
+func TestLogMangerNilWriter(t *testing.T) {
+	testName := "TestLogMangerNilWriter"
+	f, err := ioutil.TempFile("", testName)
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating temp file")
+	defer os.Remove(f.Name())
+	defer func(stderr *os.File) {
+		os.Stderr = stderr
+	}(os.Stderr)
+	os.Stderr = f
+
+	l := LogManger(testName, nil)
+	l.Info(testName, "to stderr", nil)
+	l.Close()
+	f.Close()
+
+	b, err := ioutil.ReadFile(f.Name())
+	gotestutil.AssertNil(t, err, GetCaller()+" Error reading temp file")
+	gotestutil.AssertTrue(t, strings.Contains(string(b), "to stderr"), GetCaller()+" Expected output on stderr")
+	gotestutil.AssertTrue(t, strings.HasSuffix(string(b), "\n"), GetCaller()+" Expected a line")
+}
+
 func TestLog_AddLogger(t *testing.T) {
 	testName := "TestLog_AddLogger"
 	tStr := testName + " test string"
@@ -205,7 +342,7 @@ func TestLog_AddLogger(t *testing.T) {
 	})
 
 	// Insert an invalid LogFile into the Log Manager
-	// Should log an error, but not fail.
+	// Should log an error, and fall back to stderr, but not fail. Adding it is skipped.
 	names = make(map[int]string, 5)
 	runName = testName + "=2"
 	t.Run(runName, func(t *testing.T) {
@@ -220,7 +357,7 @@ func TestLog_AddLogger(t *testing.T) {
 		defer func() {
 			l.Close()
 		}()
-		names[1] = lf.LogFilename()
+		l.AddLogger(lf)
 
 		for i := 2; i <= 3; i++ {
 			name := fmt.Sprintf("%s%02.2d", testName, i)
@@ -245,19 +382,11 @@ func TestLog_Close(t *testing.T) {
 	testName := "TestLog_Close"
 
 	t.Run(testName+"=1", func(t *testing.T) {
-		name := testName + "01"
-		lf, err := File(name)
-		gotestutil.AssertNil(t, err, GetCaller()+" Error creating new log file w/ NewFile()")
-		gotestutil.AssertNotNil(t, lf, GetCaller()+" Expected valid LogFile")
-
-		fn := lf.LogFilename()
-		l := LogManger(testName, lf)
-		defer func() {
-			os.Remove(fn)
-			l.Close()
-		}()
+		l := LogManger(testName, DiscardWriter())
+		defer l.Close()
 		gotestutil.AssertEqual(t, len(l.logModules), 1, GetCaller()+" Expected 1 logger")
-		l.Close()
+		l.Info(testName, "discarded", nil)
+		gotestutil.AssertNil(t, l.Close(), GetCaller()+" Error closing")
 		gotestutil.AssertEqual(t, len(l.logModules), 0, GetCaller()+" Expected 0 logger")
 	})
 
@@ -268,6 +397,936 @@ func TestLog_Close(t *testing.T) {
 		l.Close()
 		gotestutil.AssertEqual(t, len(l.logModules), 0, GetCaller()+" Expected 0 loggers")
 	})
+
+	// Close twice, in async mode, with a file.
+	t.Run(testName+"=3", func(t *testing.T) {
+		lf, err := File(testName)
+		gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+		defer os.Remove(lf.LogFilename())
+		cw := &closeWriter{}
+		l := LogManger(testName, lf)
+		l.AddLogger(cw)
+		gotestutil.AssertNil(t, l.AsyncBuffer(10, OverflowBlock), GetCaller()+" Error enabling async mode")
+		l.Info(testName, "queued", nil)
+		gotestutil.AssertNil(t, l.Close(), GetCaller()+" Error closing")
+		gotestutil.AssertNil(t, l.Close(), GetCaller()+" Expected nil closing again")
+		gotestutil.AssertTrue(t, cw.closed, GetCaller()+" Expected the writer closed")
+		gotestutil.AssertEqual(t, 1, len(cw.Lines()), GetCaller()+" Expected the queued message written")
+		_, err = lf.Write([]byte(testName))
+		gotestutil.AssertEqual(t, os.ErrClosed, err, GetCaller()+" Expected the file closed")
+	})
+
+	// Failed writers do not stop the others, and the errors are joined.
+	t.Run(testName+"=4", func(t *testing.T) {
+		cw := &closeWriter{}
+		l := LogManger(testName, &failingCloser{})
+		l.AddLogger(cw)
+		l.AddLogger(&failingCloser{})
+		err := l.Close()
+		gotestutil.AssertNotNil(t, err, GetCaller()+" Expected the close errors")
+		gotestutil.AssertEqual(t, 2, strings.Count(err.Error(), "close failed"), GetCaller()+" Expected both errors: "+err.Error())
+		gotestutil.AssertTrue(t, cw.closed, GetCaller()+" Expected the other writer closed")
+		gotestutil.AssertNil(t, l.Close(), GetCaller()+" Expected nil closing again")
+	})
+}
+
+// A testWriter that records Close.
+type closeWriter struct {
+	testWriter
+	closed bool
+}
+
+func (cw *closeWriter) Close() error {
+	cw.closed = true
+	return nil
+}
+
+// A writer whose Close fails.
+type failingCloser struct {
+	failingWriter
+}
+
+func (fc *failingCloser) Close() error {
+	return errors.New("failingCloser: close failed")
+}
+
+func TestMultiWriter(t *testing.T) {
+	testName := "TestMultiWriter"
+	tw1, tw2 := &closeWriter{}, &closeWriter{}
+	fw := &failingCloser{failingWriter{fail: true}}
+	w := MultiWriter(tw1, fw, tw2)
+	l := LogManger(testName, w)
+	l.SetFormatter(&spyFormatter{})
+
+	// A failed writer does not stop the others.
+	l.Info(testName, "fan out", nil)
+	gotestutil.AssertEqual(t, []string{"fan out"}, tw1.Lines(), GetCaller()+" Expected the first writer written")
+	gotestutil.AssertEqual(t, []string{"fan out"}, tw2.Lines(), GetCaller()+" Expected the last writer written")
+	_, err := w.Write([]byte(testName))
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected the write error")
+
+	err = w.Close()
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected the close error")
+	gotestutil.AssertTrue(t, tw1.closed && tw2.closed, GetCaller()+" Expected every writer closed")
+}
+
+func TestLog_RemoveLogger(t *testing.T) {
+	testName := "TestLog_RemoveLogger"
+	tw1, tw2, tw3 := &closeWriter{}, &closeWriter{}, &closeWriter{}
+	l := LogManger(testName, tw1)
+	l.SetFormatter(&spyFormatter{})
+	l.AddLoggerWithFilter(tw2, Error)
+	c := l.With(map[string]string{"child": "true"})
+
+	l.Info(testName, "all", nil)
+	gotestutil.AssertTrue(t, l.RemoveLogger(tw1), GetCaller()+" Expected the writer removed")
+	gotestutil.AssertFalse(t, l.RemoveLogger(tw1), GetCaller()+" Expected false for a removed writer")
+	gotestutil.AssertFalse(t, tw1.closed, GetCaller()+" Expected the removed writer not closed")
+	l.Error(testName, "removed", nil)
+	gotestutil.AssertEqual(t, []string{"all"}, tw1.Lines(), GetCaller()+" Expected no lines after removal")
+
+	// The replacement keeps the module filter.
+	gotestutil.AssertTrue(t, l.ReplaceLogger(tw2, tw3), GetCaller()+" Expected the writer replaced")
+	gotestutil.AssertFalse(t, l.ReplaceLogger(tw2, tw3), GetCaller()+" Expected false for a replaced writer")
+	l.Info(testName, "filtered", nil)
+	l.Error(testName, "replaced", nil)
+	gotestutil.AssertEqual(t, []string{"removed"}, tw2.Lines(), GetCaller()+" Expected no lines after replacement")
+	gotestutil.AssertEqual(t, []string{"replaced"}, tw3.Lines(), GetCaller()+" Expected the module filter")
+
+	// The child shares the writers of the parent.
+	c.Error(testName, "child", nil)
+	gotestutil.AssertEqual(t, []string{"all"}, tw1.Lines(), GetCaller()+" Expected the removed writer unchanged")
+	gotestutil.AssertEqual(t, []string{"replaced", "child"}, tw3.Lines(), GetCaller()+" Expected the replacement")
+
+	gotestutil.AssertNil(t, l.CloseLogger(tw3), GetCaller()+" Expected the writer closed")
+	gotestutil.AssertTrue(t, tw3.closed, GetCaller()+" Expected Close called")
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.CloseLogger(tw3), GetCaller()+" Expected an error for a removed writer")
+	gotestutil.AssertEqual(t, 0, len(l.modules()), GetCaller()+" Expected no modules")
+}
+
+// Run with -race. Logs from several goroutines while writers are added and removed.
+func TestLog_ConcurrentModules(t *testing.T) {
+	testName := "TestLog_ConcurrentModules"
+	base := &testWriter{}
+	l := LogManger(testName, base)
+	defer l.Close()
+
+	const loggers, events = 4, 200
+	var wg sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				l.Info(testName, fmt.Sprintf("logger %d event %d", i, j), nil)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < events; j++ {
+			tw := &testWriter{}
+			l.AddLogger(tw)
+			l.Filters()
+			l.With(map[string]string{"j": strconv.Itoa(j)}).Debug(testName, "child", nil)
+			l.RemoveLogger(tw)
+		}
+	}()
+	wg.Wait()
+
+	gotestutil.AssertEqual(t, loggers*events+events, len(base.Lines()), GetCaller()+" Expected every event written")
+	gotestutil.AssertEqual(t, 1, len(l.modules()), GetCaller()+" Expected the added writers removed")
+}
+
+func TestLog_ConcurrentFilter(t *testing.T) {
+	testName := "TestLog_ConcurrentFilter"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	defer l.Close()
+	l.SetFilter(Info)
+
+	const loggers, events = 4, 200
+	var wg sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				l.Info(testName, fmt.Sprintf("logger %d event %d", i, j), nil)
+				l.Debug(testName, "debug", nil)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < events; j++ {
+			l.SetFilter(Debug)
+			l.GetFilter()
+			l.SetFilter(Info)
+		}
+	}()
+	wg.Wait()
+
+	gotestutil.AssertEqual(t, Severity(Info), l.GetFilter(), GetCaller()+" Expected the last filter")
+	gotestutil.AssertTrue(t, len(tw.Lines()) >= loggers*events, GetCaller()+" Expected every Info event written")
+}
+
+// Run with -race. Logs from several goroutines while the filter rules are replaced.
+func TestLog_ConcurrentFilterRules(t *testing.T) {
+	testName := "TestLog_ConcurrentFilterRules"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	defer l.Close()
+	l.SetFilter(Info)
+
+	const loggers, events = 4, 200
+	var wg sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < events; j++ {
+				l.Error("NOISY", fmt.Sprintf("logger %d event %d", i, j), nil)
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < events; j++ {
+			l.SetFilterRules([]FilterRule{{MsgId: "NOISY", Threshold: Critical}})
+			l.GetFilterRules()
+			l.SetFilterRules(nil)
+		}
+	}()
+	wg.Wait()
+
+	gotestutil.AssertEqual(t, 0, len(l.GetFilterRules()), GetCaller()+" Expected the last rules")
+	l.Error("NOISY", "after", nil)
+	gotestutil.AssertEqual(t, "after", tw.Events(t)[len(tw.Lines())-1].Msg, GetCaller()+" Expected no rule")
+}
+
+func TestLog_Config(t *testing.T) {
+	testName := "TestLog_Config"
+	var names = make(map[int]string, 2)
+
+	lf, err := File(testName + "01")
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating new log file w/ File()")
+	names[0] = lf.LogFilename()
+	l := LogManger(testName, lf)
+	defer func() {
+		l.Close()
+		for _, v := range names {
+			os.Remove(v)
+		}
+	}()
+
+	lf2, err := SizeLimitedFile(testName+"02", LogMinFileSize)
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating new log file w/ SizeLimitedFile()")
+	names[1] = lf2.LogFilename()
+	l.AddLogger(lf2)
+	l.SetFilter(Warning)
+	l.SetFormatter(PlainText())
+
+	c := l.Config()
+	gotestutil.AssertEqual(t, testName, c.Appname, GetCaller()+" Expected appname")
+	gotestutil.AssertEqual(t, l.hostname, c.Hostname, GetCaller()+" Expected hostname")
+	gotestutil.AssertEqual(t, Version, c.Version, GetCaller()+" Expected version")
+	gotestutil.AssertEqual(t, "WARN", c.Filter, GetCaller()+" Expected filter")
+	gotestutil.AssertEqual(t, "plain_text", c.Formatter, GetCaller()+" Expected formatter")
+	gotestutil.AssertEqual(t, 2, len(c.Modules), GetCaller()+" Expected 2 modules")
+	gotestutil.AssertEqual(t, PolicyType(PolicyNone).String(), c.Modules[0].Policy, GetCaller()+" Expected policy")
+	gotestutil.AssertEqual(t, names[0], c.Modules[0].Filename, GetCaller()+" Expected filename")
+	gotestutil.AssertEqual(t, PolicyType(PolicyFileSize).String(), c.Modules[1].Policy, GetCaller()+" Expected policy")
+	gotestutil.AssertEqual(t, names[1], c.Modules[1].Filename, GetCaller()+" Expected filename")
+	gotestutil.AssertEqual(t, "WARN", c.Modules[1].Filter, GetCaller()+" Expected module filter")
+	gotestutil.AssertEqual(t, "", c.Modules[1].Formatter, GetCaller()+" Expected no module formatter")
+
+	l.AddLoggerWithFormatter(&testWriter{}, Logfmt())
+	c = l.Config()
+	gotestutil.AssertEqual(t, "logfmt", c.Modules[2].Formatter, GetCaller()+" Expected module formatter")
+}
+
+// A testWriter that is a FileWriter, with a file name.
+type fileTestWriter struct {
+	testWriter
+	name string
+}
+
+func (fw *fileTestWriter) LogRotateCheck() bool  { return false }
+func (fw *fileTestWriter) LogRotate() bool       { return false }
+func (fw *fileTestWriter) LogPolicy() PolicyType { return PolicyNone }
+func (fw *fileTestWriter) LogFilename() string   { return fw.name }
+
+func TestLog_AddLoggerNilPointer(t *testing.T) {
+	testName := "TestLog_AddLoggerNilPointer"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	// Typed nil pointers are not added, and do not panic, e.g. in LogFilename.
+	for _, w := range []LogWriter{(*fileTestWriter)(nil), (*LogFile)(nil), (*testWriter)(nil)} {
+		gotestutil.AssertEqual(t, InvalidArgumentError, l.AddLoggerWithFilter(w, Debug),
+			fmt.Sprintf("%s Expected an invalid writer error for %T", GetCaller(), w))
+		l.AddLogger(w)
+	}
+	gotestutil.AssertNil(t, l.AddLoggerWithFilter(&fileTestWriter{name: testName}, Debug), GetCaller()+" Expected a valid writer")
+	gotestutil.AssertEqual(t, 2, len(l.logModules), GetCaller()+" Expected 2 loggers")
+}
+
+func TestLog_AddLoggerWithFormatter(t *testing.T) {
+	testName := "TestLog_AddLoggerWithFormatter"
+	jsonW, textW, textW2 := &testWriter{}, &testWriter{}, &testWriter{}
+	l := LogManger(testName, jsonW)
+	sf := &spyFormatter{}
+	l.AddLoggerWithFormatter(textW, sf)
+	l.AddLoggerWithFormatter(textW2, sf)
+
+	l.Info(testName, "formatted per module", map[string]string{"p1": "param1"})
+
+	ems := jsonW.Events(t)
+	gotestutil.AssertEqual(t, "formatted per module", ems[0].Msg, GetCaller()+" Expected JSON")
+	gotestutil.AssertEqual(t, []string{"formatted per module"}, textW.Lines(), GetCaller()+" Expected the module formatter")
+	gotestutil.AssertEqual(t, textW.Lines(), textW2.Lines(), GetCaller()+" Expected the same output")
+	gotestutil.AssertEqual(t, 1, sf.calls, GetCaller()+" Expected the shared formatter called once")
+}
+
+func TestLog_SetDefaultParams(t *testing.T) {
+	tw := &testWriter{}
+	l := LogManger("TestLog_SetDefaultParams", tw)
+	defaults := map[string]string{"env": "prod", "region": "us-east"}
+	l.SetDefaultParams(defaults)
+	defaults["env"] = "changed"
+
+	l.Info("DEFAULTS", "first", nil)
+	l.Info("DEFAULTS", "second", map[string]string{"region": "eu-west", "p1": "param1"})
+	l.WithNamespace("db").Info("DEFAULTS", "child", map[string]string{"rows": "2"})
+	l.SetDefaultParams(nil)
+	l.Info("DEFAULTS", "cleared", nil)
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 4, len(ems), GetCaller()+" Expected 4 events")
+	for _, em := range ems[:3] {
+		gotestutil.AssertEqual(t, "prod", em.Params["env"], GetCaller()+" Expected the default param: "+em.Msg)
+	}
+	gotestutil.AssertEqual(t, "us-east", ems[0].Params["region"], GetCaller()+" Expected the default param")
+	gotestutil.AssertEqual(t, "eu-west", ems[1].Params["region"], GetCaller()+" Expected the call param to win")
+	gotestutil.AssertEqual(t, "param1", ems[1].Params["p1"], GetCaller()+" Expected the call param")
+	gotestutil.AssertEqual(t, "2", ems[2].Params["db.rows"], GetCaller()+" Expected the namespaced param")
+	gotestutil.AssertEqual(t, 0, len(ems[3].Params), GetCaller()+" Expected no params after clearing")
+}
+
+func TestLog_InfoF(t *testing.T) {
+	testName := "TestLog_InfoF"
+	tw, textW := &testWriter{}, &testWriter{}
+	l := LogManger(testName, tw)
+	l.AddLoggerWithFormatter(textW, PlainText())
+	l.SetDefaultParams(map[string]string{"count": "default", "env": "prod"})
+
+	l.WithNamespace("up").InfoF(testName, "typed", Fields{
+		"count": 42, "ok": true, "err": errors.New("failed"), "tags": []string{"a", "b"},
+	})
+
+	var rec struct {
+		Params map[string]interface{} `json:"params"`
+	}
+	err := json.Unmarshal([]byte(tw.Lines()[0]), &rec)
+	gotestutil.AssertNil(t, err, GetCaller()+fmt.Sprintf(" %s: %s", err, tw.Lines()[0]))
+	gotestutil.AssertEqual(t, map[string]interface{}{
+		"count":    "default",
+		"env":      "prod",
+		"up.count": float64(42),
+		"up.ok":    true,
+		"up.err":   "failed",
+		"up.tags":  []interface{}{"a", "b"},
+	}, rec.Params, GetCaller()+" Expected typed JSON params")
+
+	line := textW.Lines()[0]
+	for _, s := range []string{"up.count=42", "up.ok=true", "up.err=failed", "up.tags=[a b]"} {
+		gotestutil.AssertTrue(t, strings.Contains(line, s), GetCaller()+" Expected "+s+" in "+line)
+	}
+}
+
+func TestLog_SetReportUptime(t *testing.T) {
+	tw := &testWriter{}
+	l := LogManger("TestLog_SetReportUptime", tw)
+	l.SetReportUptime(true)
+
+	l.Info("UPTIME", "first", nil)
+	time.Sleep(20 * time.Millisecond)
+	l.Info("UPTIME", "second", nil)
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 2, len(ems), GetCaller()+" Expected 2 events")
+	first, err := strconv.Atoi(ems[0].Params["uptime_ms"])
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected a numeric uptime_ms")
+	second, err := strconv.Atoi(ems[1].Params["uptime_ms"])
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected a numeric uptime_ms")
+	gotestutil.AssertTrue(t, first < 20, GetCaller()+fmt.Sprintf(" Expected uptime_ms near zero, got %d", first))
+	gotestutil.AssertTrue(t, second >= first+20, GetCaller()+fmt.Sprintf(" Expected uptime_ms to increase, %d, %d", first, second))
+}
+
+func TestLog_SetReportGoroutineID(t *testing.T) {
+	tw := &testWriter{}
+	l := LogManger("TestLog_SetReportGoroutineID", tw)
+	l.SetReportGoroutineID(true)
+	params := map[string]string{"p1": "param1"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Info("GOROUTINE", "goroutine id test", params)
+		}()
+	}
+	wg.Wait()
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 2, len(ems), GetCaller()+" Expected 2 events")
+	id1, id2 := ems[0].Params["goroutine_id"], ems[1].Params["goroutine_id"]
+	gotestutil.AssertNotEmptyString(t, id1, GetCaller()+" Expected a goroutine id")
+	gotestutil.AssertNotEmptyString(t, id2, GetCaller()+" Expected a goroutine id")
+	gotestutil.AssertStringsNotEqual(t, id1, id2, GetCaller()+" Expected different goroutine ids")
+	_, err := strconv.Atoi(id1)
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected a numeric goroutine id: "+id1)
+	gotestutil.AssertEqual(t, 1, len(params), GetCaller()+" Expected caller params unchanged")
+}
+
+func TestLog_SetTraceSampling(t *testing.T) {
+	tw := &testWriter{}
+	l := LogManger("TestLog_SetTraceSampling", tw)
+	l.SetTraceSampling("trace_id", 4)
+
+	kept := 0
+	for i := 0; i < 100; i++ {
+		n := len(tw.Lines())
+		params := map[string]string{"trace_id": fmt.Sprintf("trace-%d", i)}
+		l.Info("SAMPLE", "first event", params)
+		l.Info("SAMPLE", "second event", params)
+		added := len(tw.Lines()) - n
+		gotestutil.AssertTrue(t, added == 0 || added == 2,
+			GetCaller()+" Expected both or neither event kept, trace "+params["trace_id"])
+		if added == 2 {
+			kept++
+		}
+	}
+	gotestutil.AssertTrue(t, kept > 0 && kept < 100,
+		GetCaller()+fmt.Sprintf(" Expected some traces kept and some dropped, kept %d", kept))
+
+	// Events without the param are kept
+	n := len(tw.Lines())
+	l.Info("SAMPLE", "no trace", map[string]string{})
+	gotestutil.AssertEqual(t, n+1, len(tw.Lines()), GetCaller()+" Expected event without trace id kept")
+}
+
+func TestLog_SetSampler(t *testing.T) {
+	testName := "TestLog_SetSampler"
+	clock := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	defer func() {
+		now = time.Now
+	}()
+	now = func() time.Time {
+		return clock
+	}
+
+	tests := []struct {
+		name    string
+		sampler Sampler
+		kept    int
+		next    int // Events kept in the next period, of 1
+	}{
+		{"rate", NewRateSampler("FLOOD", 3), 3, 1},
+		{"nth", NewNthSampler("FLOOD", 4), 3, 0}, // Keeps the 1st, 5th, and 9th
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tw := &testWriter{}
+			l := LogManger(testName, tw)
+			l.SetSampler(tt.sampler)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					l.Info("FLOOD", "flood", nil)
+				}()
+			}
+			wg.Wait()
+			l.Info("OTHER", "other msgId", nil)
+			gotestutil.AssertEqual(t, tt.kept+1, len(tw.Lines()), GetCaller()+" Expected sampled events")
+
+			// The next period summarizes the suppressed events
+			clock = clock.Add(samplerPeriod)
+			l.Info("FLOOD", "flood", nil)
+			ems := tw.Events(t)
+			gotestutil.AssertEqual(t, tt.kept+2+tt.next, len(ems), GetCaller()+" Expected a summary")
+			sum := ems[tt.kept+1]
+			gotestutil.AssertEqual(t, suppressedMsgId, sum.MsgId, GetCaller()+" Expected a summary")
+			gotestutil.AssertEqual(t, strconv.Itoa(10-tt.kept), sum.Params["suppressed"], GetCaller()+" Expected suppressed count")
+			gotestutil.AssertEqual(t, "FLOOD", sum.Params["msg_id"], GetCaller()+" Expected the msg_id")
+		})
+	}
+}
+
+func TestRateSampler_RemoveIdle(t *testing.T) {
+	clock := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	defer func() {
+		now = time.Now
+	}()
+	now = func() time.Time {
+		return clock
+	}
+
+	rs := NewRateSampler("", 1)
+	for i := 0; i < 100; i++ {
+		rs.Sample("GENERATED_" + strconv.Itoa(i))
+	}
+	rs.Sample("ACTIVE")
+	gotestutil.AssertEqual(t, 101, len(rs.states), GetCaller()+" Expected a state per msgId")
+
+	// An active msgId is kept, and idle msgIds are removed.
+	clock = clock.Add(samplerIdle / 2)
+	keep, _ := rs.Sample("ACTIVE")
+	gotestutil.AssertTrue(t, keep, GetCaller()+" Expected the event kept")
+	clock = clock.Add(samplerIdle / 2)
+	rs.Sample("ACTIVE")
+	gotestutil.AssertEqual(t, 1, len(rs.states), GetCaller()+" Expected the idle msgIds removed")
+
+	// A removed msgId starts again.
+	keep, suppressed := rs.Sample("GENERATED_1")
+	gotestutil.AssertTrue(t, keep, GetCaller()+" Expected the event kept")
+	gotestutil.AssertEqual(t, uint64(0), suppressed, GetCaller()+" Expected no summary")
+}
+
+func TestLog_SetFilterRules(t *testing.T) {
+	testName := "TestLog_SetFilterRules"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	l.SetFilter(Info)
+	err := l.SetFilterRules([]FilterRule{
+		{MsgId: "NOISY", Threshold: Error},
+		{ParamKey: "component", ParamValue: "db", Threshold: Debug},
+		{Appname: "other", Threshold: Emergency},
+	})
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected valid rules")
+
+	l.Info("NOISY", "dropped by rule", nil)
+	l.Error("NOISY", "kept by rule", nil)
+	l.Info("QUIET", "kept by default", nil)
+	l.Debug("QUIET", "dropped by default", nil)
+	l.Debug("QUIET", "kept by param rule", map[string]string{"component": "db"})
+	l.Debug("QUIET", "dropped, param value differs", map[string]string{"component": "web"})
+
+	var msgs []string
+	for _, em := range tw.Events(t) {
+		msgs = append(msgs, em.Msg)
+	}
+	gotestutil.AssertEqual(t, []string{"kept by rule", "kept by default", "kept by param rule"}, msgs,
+		GetCaller()+" Expected selective filtering")
+
+	err = l.SetFilterRules([]FilterRule{{MsgId: "BAD", Threshold: Severity(100)}})
+	gotestutil.AssertEqual(t, InvalidArgumentError, err, GetCaller()+" Expected invalid threshold")
+	gotestutil.AssertEqual(t, 3, len(l.GetFilterRules()), GetCaller()+" Expected rules unchanged")
+}
+
+func TestLog_LogEventNoModules(t *testing.T) {
+	testName := "TestLog_LogEventNoModules"
+	sf := &spyFormatter{}
+	l := LogManger(testName, &testWriter{})
+	l.SetFormatter(sf)
+
+	l.Info(testName, "before close", nil)
+	gotestutil.AssertEqual(t, 1, sf.calls, GetCaller()+" Expected one Format call")
+
+	l.Close()
+	l.Info(testName, "after close", nil)
+	gotestutil.AssertEqual(t, 1, sf.calls, GetCaller()+" Expected no Format call after Close")
+}
+
+func TestLog_ChildSharesState(t *testing.T) {
+	testName := "TestLog_ChildSharesState"
+	cw := &closeWriter{}
+	l := LogManger(testName, cw)
+	c := l.With(map[string]string{"child": "true"})
+
+	// The filter and formatter of the parent apply to the child.
+	l.SetFilter(Error)
+	c.Info(testName, "filtered", nil)
+	l.SetFormatter(PlainText())
+	c.Error(testName, "plain", nil)
+	gotestutil.AssertEqual(t, 1, len(cw.Lines()), GetCaller()+" Expected the parent filter")
+	gotestutil.AssertTrue(t, strings.Contains(cw.Lines()[0], "|plain|[child=true]"), GetCaller()+" Expected the parent formatter, got "+cw.Lines()[0])
+
+	// Close of the child does nothing. Close of the parent stops the child.
+	gotestutil.AssertNil(t, c.Close(), GetCaller()+" Expected nil closing the child")
+	gotestutil.AssertFalse(t, cw.closed, GetCaller()+" Expected the writer open")
+	c.Error(testName, "open", nil)
+	gotestutil.AssertNil(t, l.Close(), GetCaller()+" Expected nil closing the parent")
+	gotestutil.AssertTrue(t, cw.closed, GetCaller()+" Expected the writer closed")
+	c.Error(testName, "closed", nil)
+	gotestutil.AssertEqual(t, 2, len(cw.Lines()), GetCaller()+" Expected no lines after Close")
+}
+
+func TestLog_WithError(t *testing.T) {
+	testName := "TestLog_WithError"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	cause := errors.New("disk full")
+	err := fmt.Errorf("loading config: %w", cause)
+	c := l.WithError(err)
+	c.Error(testName, "child event", map[string]string{"p1": "param1"})
+	c.Error(testName, "call site wins", map[string]string{"error": "override"})
+	l.Error(testName, "parent event", nil)
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 3, len(ems), GetCaller()+" Expected 3 events")
+	gotestutil.AssertEqual(t, err.Error(), ems[0].Params["error"], GetCaller()+" Expected error")
+	gotestutil.AssertEqual(t, cause.Error(), ems[0].Params["error.cause"], GetCaller()+" Expected error.cause")
+	gotestutil.AssertEqual(t, "*fmt.wrapError,*errors.errorString", ems[0].Params["error.types"],
+		GetCaller()+" Expected error.types")
+	gotestutil.AssertEqual(t, "param1", ems[0].Params["p1"], GetCaller()+" Expected call site param")
+	gotestutil.AssertEqual(t, "override", ems[1].Params["error"], GetCaller()+" Expected call site to win")
+	_, ok := ems[2].Params["error"]
+	gotestutil.AssertFalse(t, ok, GetCaller()+" Expected parent without error fields")
+
+	// Each error of errors.Join is walked, depth first.
+	joined := fmt.Errorf("saving: %w", errors.Join(cause, errors.New("network down")))
+	l.WithError(joined).Error(testName, "joined", nil)
+	em := tw.Events(t)[3]
+	gotestutil.AssertEqual(t, joined.Error(), em.Params["error"], GetCaller()+" Expected error")
+	gotestutil.AssertEqual(t, "disk full; network down", em.Params["error.cause"], GetCaller()+" Expected each error.cause")
+	gotestutil.AssertEqual(t, "*fmt.wrapError,*errors.joinError,*errors.errorString,*errors.errorString",
+		em.Params["error.types"], GetCaller()+" Expected error.types")
+
+	gotestutil.AssertTrue(t, l.WithError(nil) == l, GetCaller()+" Expected nil error to return the parent")
+}
+
+func TestLog_SetErrorHandler(t *testing.T) {
+	testName := "TestLog_SetErrorHandler"
+	fw := &failingWriter{fail: true}
+	l := LogManger(testName, &testWriter{})
+	l.AddLogger(fw)
+	l.SetFormatter(&spyFormatter{})
+
+	// Silent by default.
+	l.Info(testName, "no handler", nil)
+
+	var failed []LogWriter
+	var errs []error
+	l.SetErrorHandler(func(w LogWriter, err error) {
+		failed = append(failed, w)
+		errs = append(errs, err)
+	})
+	l.Info(testName, "message", nil)
+	gotestutil.AssertEqual(t, 1, len(errs), GetCaller()+" Expected one error for the failing writer")
+	gotestutil.AssertTrue(t, failed[0] == LogWriter(fw), GetCaller()+" Expected the failing writer")
+	var we *WriteError
+	gotestutil.AssertTrue(t, errors.As(errs[0], &we), GetCaller()+" Expected a *WriteError")
+	gotestutil.AssertEqual(t, len("message"), we.Length, GetCaller()+" Expected the message length")
+	gotestutil.AssertEqual(t, "", we.Filename, GetCaller()+" Expected no file name")
+
+	// A LogFile reports its file name, and in async mode the handler is called after the write.
+	lf, err := File(testName)
+	gotestutil.AssertNil(t, err, GetCaller()+" Error opening the file")
+	defer os.Remove(lf.LogFilename())
+	defer lf.Close()
+	lf.f.Close()
+	l.AddLogger(lf)
+	l.AsyncBuffer(10, OverflowBlock)
+	defer l.Close()
+	l.Info(testName, "async", nil)
+	l.Flush()
+	gotestutil.AssertEqual(t, 3, len(errs), GetCaller()+" Expected errors for both failing writers")
+	gotestutil.AssertTrue(t, errors.As(errs[2], &we), GetCaller()+" Expected a *WriteError")
+	gotestutil.AssertEqual(t, lf.LogFilename(), we.Filename, GetCaller()+" Expected the file name")
+	gotestutil.AssertTrue(t, errors.Is(errs[2], os.ErrClosed), GetCaller()+" Expected the cause")
+}
+
+func TestLog_Filters(t *testing.T) {
+	l := LogManger("TestLog_Filters", &testWriter{})
+	l.AddLogger(&testWriter{})
+	l.AddLoggerWithFilter(&testWriter{}, Debug)
+	l.SetFilter(Notice)
+
+	global, perModule := l.Filters()
+	gotestutil.AssertEqual(t, Severity(Notice), global, GetCaller()+" Expected global filter")
+	gotestutil.AssertEqual(t, []Severity{Notice, Notice, Debug}, perModule, GetCaller()+" Expected module filters")
+}
+
+func TestLog_AddLoggerWithFilter(t *testing.T) {
+	testName := "TestLog_AddLoggerWithFilter"
+	tw, debugW, errW := &testWriter{}, &testWriter{}, &testWriter{}
+	l := LogManger(testName, tw)
+	l.SetFilter(Info)
+	gotestutil.AssertNil(t, l.AddLoggerWithFilter(debugW, Debug), GetCaller()+" Expected a valid filter")
+	gotestutil.AssertNil(t, l.AddLoggerWithFilter(errW, Error), GetCaller()+" Expected a valid filter")
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.AddLoggerWithFilter(&testWriter{}, Severity(100)),
+		GetCaller()+" Expected an invalid filter error")
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.AddLoggerWithFilter(&LogFile{}, Debug),
+		GetCaller()+" Expected an invalid writer error")
+	gotestutil.AssertEqual(t, 3, len(l.logModules), GetCaller()+" Expected 3 loggers")
+
+	l.Debug(testName, "debug", nil)
+	l.Info(testName, "info", nil)
+	l.Error(testName, "error", nil)
+	gotestutil.AssertEqual(t, 2, len(tw.Lines()), GetCaller()+" Expected INFO+ with the Log filter")
+	gotestutil.AssertEqual(t, 3, len(debugW.Lines()), GetCaller()+" Expected DEBUG+ with the module filter")
+	gotestutil.AssertEqual(t, 1, len(errW.Lines()), GetCaller()+" Expected ERROR+ with the module filter")
+
+	// A rule wins over the module filters
+	l.SetFilterRules([]FilterRule{{MsgId: "AUDIT", Threshold: Notice}})
+	l.Notice("AUDIT", "rule", nil)
+	l.Info("AUDIT", "rule", nil)
+	gotestutil.AssertEqual(t, 3, len(tw.Lines()), GetCaller()+" Expected NOTICE+ with the rule")
+	gotestutil.AssertEqual(t, 4, len(debugW.Lines()), GetCaller()+" Expected NOTICE+ with the rule")
+	gotestutil.AssertEqual(t, 2, len(errW.Lines()), GetCaller()+" Expected NOTICE+ with the rule")
+}
+
+func TestLog_AddFileAndConsole(t *testing.T) {
+	testName := "TestLog_AddFileAndConsole"
+	fileW, consoleW := &testWriter{}, &testWriter{}
+	l := LogManger(testName, DiscardWriter())
+	l.SetFilter(Debug)
+	gotestutil.AssertEqual(t, InvalidArgumentError, l.AddFileAndConsole(fileW, &LogFile{}),
+		GetCaller()+" Expected an invalid writer error")
+	gotestutil.AssertEqual(t, 1, len(l.logModules), GetCaller()+" Expected neither writer added")
+	gotestutil.AssertNil(t, l.AddFileAndConsole(fileW, consoleW), GetCaller()+" Expected the writers added")
+
+	l.Info(testName, "info detail", map[string]string{"p1": "param1"})
+	l.Error(testName, "error detail", map[string]string{"p1": "param1"})
+
+	// The file has each event in JSON, and the console only the ERROR, as a summary.
+	ems := fileW.Events(t)
+	gotestutil.AssertEqual(t, 2, len(ems), GetCaller()+" Expected the INFO and ERROR in the file")
+	gotestutil.AssertEqual(t, "info detail", ems[0].Msg, GetCaller()+" Expected the INFO in JSON")
+	gotestutil.AssertEqual(t, "param1", ems[1].Params["p1"], GetCaller()+" Expected the ERROR in JSON")
+	lines := consoleW.Lines()
+	gotestutil.AssertEqual(t, 1, len(lines), GetCaller()+" Expected only the ERROR on the console")
+	gotestutil.AssertTrue(t, strings.Contains(lines[0], "ERROR "+testName+" error detail p1=param1"),
+		GetCaller()+" Expected a summary: "+lines[0])
+	gotestutil.AssertFalse(t, json.Valid([]byte(lines[0])), GetCaller()+" Expected no JSON: "+lines[0])
+}
+
+func TestLog_With(t *testing.T) {
+	testName := "TestLog_With"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	rl := l.With(map[string]string{"request_id": "r1", "user_id": "u1"})
+	rl.Info(testName, "child", map[string]string{"user_id": "u2", "p1": "param1"})
+	rl.With(map[string]string{"step": "2"}).Info(testName, "grandchild", nil)
+	l.Info(testName, "parent", nil)
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, map[string]string{"request_id": "r1", "user_id": "u2", "p1": "param1"},
+		ems[0].Params, GetCaller()+" Expected call site params to win")
+	gotestutil.AssertEqual(t, map[string]string{"request_id": "r1", "user_id": "u1", "step": "2"},
+		ems[1].Params, GetCaller()+" Expected nested fields")
+	gotestutil.AssertEqual(t, 0, len(ems[2].Params), GetCaller()+" Expected the parent unchanged")
+}
+
+func TestLog_WithNamespace(t *testing.T) {
+	testName := "TestLog_WithNamespace"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	db := l.WithError(errors.New("base")).WithNamespace("db")
+	db.Info(testName, "namespaced", map[string]string{"rows": "10"})
+	db.WithNamespace("pool").Info(testName, "nested", map[string]string{"size": "4"})
+	db.WithError(errors.New("child")).Info(testName, "namespaced error", nil)
+	l.Info(testName, "parent", map[string]string{"rows": "5"})
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, map[string]string{"rows": "", "db.rows": "10", "error": "base"},
+		map[string]string{"rows": ems[0].Params["rows"], "db.rows": ems[0].Params["db.rows"],
+			"error": ems[0].Params["error"]}, GetCaller()+" Expected prefixed call site keys only")
+	gotestutil.AssertEqual(t, "4", ems[1].Params["db.pool.size"], GetCaller()+" Expected nested namespace")
+	gotestutil.AssertEqual(t, "child", ems[2].Params["db.error"], GetCaller()+" Expected prefixed error key")
+	gotestutil.AssertEqual(t, map[string]string{"rows": "5"}, ems[3].Params, GetCaller()+" Expected parent keys unprefixed")
+}
+
+func TestLog_LogEventCtx(t *testing.T) {
+	testName := "TestLog_LogEventCtx"
+	type userKey struct{}
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	ctx := context.WithValue(ContextWithTraceID(context.Background(), "t1"), userKey{}, "u1")
+	rl := l.WithContextValue(userKey{}, "user_id")
+	rl.LogEventCtx(ctx, Info, testName, "mapped", map[string]string{"p1": "param1"})
+	rl.LogEventCtx(ctx, Info, testName, "call site", map[string]string{"trace_id": "t2"})
+	l.LogEventCtx(ctx, Info, testName, "parent", nil)
+	l.LogEventCtx(nil, Info, testName, "nil context", nil)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	rl.LogEventCtx(cancelled, Error, testName, "cancelled", nil)
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 4, len(ems), GetCaller()+" Expected the cancelled event dropped")
+	gotestutil.AssertEqual(t, map[string]string{"trace_id": "t1", "user_id": "u1", "p1": "param1"},
+		ems[0].Params, GetCaller()+" Expected the context values")
+	gotestutil.AssertEqual(t, map[string]string{"trace_id": "t2", "user_id": "u1"},
+		ems[1].Params, GetCaller()+" Expected call site params to win")
+	gotestutil.AssertEqual(t, map[string]string{"trace_id": "t1"}, ems[2].Params, GetCaller()+" Expected the parent unmapped")
+	gotestutil.AssertEqual(t, 0, len(ems[3].Params), GetCaller()+" Expected no params")
+}
+
+func TestLog_SetTraceExtractor(t *testing.T) {
+	testName := "TestLog_SetTraceExtractor"
+	type spanKey struct{}
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	l.SetTraceExtractor(func(ctx context.Context) (string, string) {
+		span, _ := ctx.Value(spanKey{}).([2]string)
+		return span[0], span[1]
+	})
+
+	ctx := ContextWithTraceID(context.Background(), "t0")
+	l.LogEventCtx(ctx, Info, testName, "untraced", nil)
+	l.LogEventCtx(context.WithValue(ctx, spanKey{}, [2]string{"t1", "s1"}), Info, testName, "traced", nil)
+	l.SetTraceExtractor(nil)
+	l.LogEventCtx(context.WithValue(ctx, spanKey{}, [2]string{"t1", "s1"}), Info, testName, "disabled", nil)
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, map[string]string{"trace_id": "t0"}, ems[0].Params, GetCaller()+" Expected the context trace id")
+	gotestutil.AssertEqual(t, map[string]string{"trace_id": "t1", "span_id": "s1"}, ems[1].Params,
+		GetCaller()+" Expected the extracted ids")
+	gotestutil.AssertEqual(t, map[string]string{"trace_id": "t0"}, ems[2].Params, GetCaller()+" Expected the extractor disabled")
+}
+
+func TestLog_Once(t *testing.T) {
+	testName := "TestLog_Once"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	l.Once(Warning, "DEPRECATED", "first", nil)
+	l.Once(Warning, "DEPRECATED", "second", nil)
+	l.WithError(errors.New("child")).Once(Warning, "DEPRECATED", "child", nil)
+	l.Once(Warning, "DEFAULTS", "other msgId", nil)
+	gotestutil.AssertEqual(t, 2, len(tw.Lines()), GetCaller()+" Expected a single output per msgId")
+
+	l.ResetOnce()
+	l.Once(Warning, "DEPRECATED", "after reset", nil)
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 3, len(ems), GetCaller()+" Expected output after ResetOnce")
+	gotestutil.AssertEqual(t, "first", ems[0].Msg, GetCaller()+" Expected the first message")
+	gotestutil.AssertEqual(t, "after reset", ems[2].Msg, GetCaller()+" Expected the message after reset")
+}
+
+func TestLog_Timer(t *testing.T) {
+	testName := "TestLog_Timer"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	sleep := 50 * time.Millisecond
+
+	done := l.Timer("OPERATION")
+	time.Sleep(sleep)
+	done(map[string]string{"p1": "param1"})
+
+	ems := tw.Events(t)
+	gotestutil.AssertEqual(t, 1, len(ems), GetCaller()+" Expected 1 event")
+	gotestutil.AssertEqual(t, "OPERATION", ems[0].MsgId, GetCaller()+" Expected the msgId")
+	gotestutil.AssertEqual(t, "param1", ems[0].Params["p1"], GetCaller()+" Expected call params")
+	ms, err := strconv.Atoi(ems[0].Params["duration_ms"])
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected a numeric duration_ms")
+	gotestutil.AssertTrue(t, ms >= 50 && ms < 500,
+		GetCaller()+fmt.Sprintf(" Expected duration_ms near %d, got %d", sleep/time.Millisecond, ms))
+}
+
+func TestLog_HTTPRequest(t *testing.T) {
+	testName := "TestLog_HTTPRequest"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	l.SetFilter(Debug)
+
+	tests := []struct {
+		status int
+		sev    Severity
+	}{
+		{200, Info},
+		{302, Info},
+		{404, Warning},
+		{503, Error},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest("POST", "/api/items?id=1", nil)
+		r.Header.Set("User-Agent", testName)
+		l.HTTPRequest(r, tt.status, 1500*time.Millisecond, map[string]string{"p1": "param1"})
+
+		em := tw.Events(t)[i]
+		gotestutil.AssertEqual(t, tt.sev.String(), em.Sev, GetCaller()+fmt.Sprintf(" Severity for %d", tt.status))
+		gotestutil.AssertEqual(t, httpRequestMsgId, em.MsgId, GetCaller()+" Expected the msgId")
+		expected := map[string]string{
+			"method":      "POST",
+			"path":        "/api/items",
+			"proto":       "HTTP/1.1",
+			"remote_addr": r.RemoteAddr,
+			"status":      strconv.Itoa(tt.status),
+			"duration_ms": "1500",
+			"user_agent":  testName,
+			"p1":          "param1",
+		}
+		for k, v := range expected {
+			gotestutil.AssertEqual(t, v, em.Params[k], GetCaller()+" Param "+k)
+		}
+	}
+}
+
+func TestLog_SetRepairUTF8(t *testing.T) {
+	testName := "TestLog_SetRepairUTF8"
+	invalid := "bad \xff\xfe bytes"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	l.SetFormatter(PlainText())
+	params := map[string]string{"p\xc3": invalid}
+
+	l.Info(testName, invalid, params)
+	gotestutil.AssertFalse(t, utf8.ValidString(tw.Lines()[0]), GetCaller()+" Expected invalid UTF-8 without repair")
+
+	l.SetRepairUTF8(true)
+	l.Info(testName+"\xc0", invalid, params)
+	line := tw.Lines()[1]
+	gotestutil.AssertTrue(t, utf8.ValidString(line), GetCaller()+" Expected valid UTF-8: "+line)
+	gotestutil.AssertTrue(t, strings.Contains(line, "bad \uFFFD bytes"), GetCaller()+" Expected U+FFFD: "+line)
+	gotestutil.AssertEqual(t, invalid, params["p\xc3"], GetCaller()+" Expected caller params unchanged")
+}
+
+func TestLog_SetCallerFormat(t *testing.T) {
+	testName := "TestLog_SetCallerFormat"
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+
+	l.Info(testName, "no caller", nil)
+	l.SetCallerFormat(CallerShort)
+	_, file, line, _ := runtime.Caller(0)
+	l.Info(testName, "short", nil)
+	l.SetCallerFormat(CallerFunc)
+	l.Info(testName, "func", nil)
+	l.SetCallerFormat(CallerFull)
+	l.WithError(errors.New("child")).LogEvent(Info, testName, "full", nil)
+
+	file = file[strings.LastIndex(file, "/"):]
+	fn := testFuncName()
+	ems := tw.Events(t)
+	_, ok := ems[0].Params["caller"]
+	gotestutil.AssertFalse(t, ok, GetCaller()+" Expected no caller by default")
+	gotestutil.AssertEqual(t, fmt.Sprintf("%s:%d", file[1:], line+1), ems[1].Params["caller"],
+		GetCaller()+" Expected short caller")
+	gotestutil.AssertEqual(t, fn[strings.LastIndex(fn, "/")+1:], ems[2].Params["caller"],
+		GetCaller()+" Expected func caller")
+	gotestutil.AssertEqual(t, fmt.Sprintf("%s, %s, Line %d", file, fn, line+5), ems[3].Params["caller"],
+		GetCaller()+" Expected full caller")
+}
+
+// Returns the function name of the caller
+func testFuncName() string {
+	pc, _, _, _ := runtime.Caller(1)
+	return runtime.FuncForPC(pc).Name()
 }
 
 func TestLog_LogEvent(t *testing.T) {
@@ -432,3 +1491,22 @@ func TestLog_Debug2(t *testing.T) {
 	tStr := Severity(Debug).String()
 	success = gotestutil.AssertTextNotInFiles(t, map[int]string{1: fn}, tStr)
 }
+
+func BenchmarkLog_Info(b *testing.B) {
+	l := LogManger("BenchmarkLog_Info", DiscardWriter())
+	params := map[string]string{"p1": "param1", "p2": "param2"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("MsgId_1", "Benchmark message.", params)
+	}
+}
+
+func BenchmarkLog_InfoGoroutineID(b *testing.B) {
+	l := LogManger("BenchmarkLog_InfoGoroutineID", DiscardWriter())
+	l.SetReportGoroutineID(true)
+	params := map[string]string{"p1": "param1", "p2": "param2"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("MsgId_1", "Benchmark message.", params)
+	}
+}
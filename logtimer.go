@@ -1,11 +1,13 @@
 // LogTimer is used for time or interval based log rotations using Go time functions.
 // Default implementation is
 //     DailyTimer, via NewDailyTImer, that establishes a timer that fires at 00:00:00.
+//     DailyTimer, via NewDailyTimerAt, that establishes a timer that fires daily at hh:mm.
 //     Timer, via NewTimer, which creates a generic timer that fires after the specified duration.
+//     CronTimer, via NewCronTimer, that fires on a 5-field cron schedule, e.g. "0 */6 * * *".
 package logger
 
 import (
-	"log"
+	"sync"
 	"time"
 )
 
@@ -16,25 +18,55 @@ type LogTimer struct {
 	d     time.Duration // The duration registered when the timer was started.
 	cb    func()        // provided by client/caller
 	timer *time.Timer   // Pointer to the Go Timer
+	// The cron schedule of a cron timer. If set, next is recomputed each time it is reset.
+	schedule *cronSchedule
+	// The time of day of a daily timer. If daily is set, next is recomputed each time it is reset.
+	daily        bool
+	hour, minute int
+	// Guards base, next and d, which are updated when the timer fires, or is reset.
+	mu sync.Mutex
 }
 
 // Create a new timer that executes the function parameter at the given time.
 // This timer starts the basetime at 12am (midnight) based on the location specified.
-// The duration is always calculated as the difference  between now and 12am.
+// The duration is always calculated as the difference  between now and the next midnight.
 func NewDailyTimer(loc *time.Location, f func()) (lt *LogTimer) {
-	lt = &LogTimer{d: 24 * time.Hour, cb: f}
-	t := time.Now()
+	return NewDailyTimerAt(loc, 0, 0, f)
+}
+
+// Create a new timer that executes the function parameter daily at hour:minute, in the location
+// specified. If the time today has already passed, the timer first fires tomorrow, and if it is
+// exactly now, the timer fires immediately.
+//
+// The trigger time is computed on the wall clock, so a day across a DST change is 23 or 25
+// hours. A time of day that does not exist, i.e. in a spring-forward gap, is normalized as by
+// time.Date, i.e. an hour earlier or later, e.g. 02:30 is 01:30 EST or 03:30 EDT.
+func NewDailyTimerAt(loc *time.Location, hour, minute int, f func()) (lt *LogTimer) {
+	lt = &LogTimer{cb: f, daily: true, hour: hour, minute: minute}
+	// Until the timer is set, as the callback may reset it.
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	t := now()
 	if loc == nil {
 		loc = t.Location()
 	}
-	lt.base = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).Round(time.Minute)
-	d := lt.calcDurationFromNow(lt.base.Add(lt.d))
+	t = t.In(loc)
+	lt.next = lt.dailyTime(t, 0)
+	if lt.next.Before(t) {
+		lt.next = lt.dailyTime(t, 1)
+	}
+	lt.base = lt.dailyTime(lt.next, -1)
+	lt.d = lt.next.Sub(t)
 
-	lt.next = lt.base.Add(lt.d)
-	lt.timer = time.AfterFunc(d, lt.doTimerFunc)
+	lt.timer = time.AfterFunc(lt.d, lt.doTimerFunc)
 	return lt
 }
 
+// Returns the time of day of a daily timer, on the day of t plus days, in the location of t.
+func (lt *LogTimer) dailyTime(t time.Time, days int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+days, lt.hour, lt.minute, 0, 0, t.Location())
+}
+
 // Creates a new timer for the "local" location (current time zone).
 // The duration specifies when the timer executes the function parameter (f).
 // This is the same as calling NewTimer with time.Now().Location.
@@ -47,19 +79,51 @@ func NewLocalTimer(dur time.Duration, f func()) (lt *LogTimer) {
 // The dur is the duration to wait before calling the function.
 // The location is the time zone for the timer (clock).
 // The function, f, is  called when the timer expires.
+// The base time is truncated to the minute, unless the duration is less than a minute.
 func NewTimer(dur time.Duration, l *time.Location, f func()) (lt *LogTimer) {
 	lt = &LogTimer{d: dur, cb: f}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
 
 	n := time.Now()
 	if l == nil {
 		l = n.Location()
 	}
-	lt.base = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), 0, 0, l)
+	if dur < time.Minute {
+		lt.base = n.In(l)
+	} else {
+		lt.base = time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), 0, 0, l)
+	}
 	lt.next = lt.base.Add(lt.d)
 	lt.timer = time.AfterFunc(lt.d, lt.doTimerFunc)
 	return
 }
 
+// Create a new timer that executes the function parameter on a 5-field cron schedule, e.g.
+// "0 */6 * * *" for every 6 hours on the hour. The schedule is evaluated in the location specified.
+// After the timer fires, Reset re-arms it for the next scheduled time.
+// Returns ParseError if the spec is not valid, or never matches.
+func NewCronTimer(spec string, loc *time.Location, f func()) (lt *LogTimer, err error) {
+	cs, err := parseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	n := time.Now()
+	if loc == nil {
+		loc = n.Location()
+	}
+	lt = &LogTimer{cb: f, schedule: cs, base: n.In(loc)}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.next = cs.next(lt.base)
+	if lt.next.IsZero() {
+		return nil, ParseError
+	}
+	lt.d = time.Until(lt.next)
+	lt.timer = time.AfterFunc(lt.d, lt.doTimerFunc)
+	return lt, nil
+}
+
 // Stop the timer.
 // If the timer has stopped or expired, it drains the channel.
 func (lt *LogTimer) Stop() {
@@ -72,23 +136,68 @@ func (lt *LogTimer) Stop() {
 }
 
 // Reset the timer by stopping, and then reset the duration, starting an active timer.
+// The trigger time is recomputed from now, i.e. now plus the duration, or the next scheduled
+// time of a daily or cron timer. This may be called after the timer fired, e.g. from its callback.
 func (lt *LogTimer) Reset() {
 	lt.Stop()
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	n := now().In(lt.base.Location())
+	switch {
+	case lt.schedule != nil:
+		lt.next = lt.schedule.next(n)
+		if lt.next.IsZero() {
+			return
+		}
+		lt.d = lt.next.Sub(n)
+	case lt.daily:
+		lt.next = lt.dailyTime(n, 0)
+		if !lt.next.After(n) {
+			lt.next = lt.dailyTime(n, 1)
+		}
+		lt.d = lt.next.Sub(n)
+	default:
+		lt.next = n.Add(lt.d)
+	}
+	lt.base = n
 	lt.timer.Reset(lt.d)
 }
 
-// Returns the duration of the timer
+// Re-arm a stopped timer to fire at the current trigger time.
+// If the trigger time has passed, the timer fires immediately.
+func (lt *LogTimer) resume() {
+	if lt.timer == nil {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	d := time.Until(lt.next)
+	if d < 0 {
+		d = 0
+	}
+	lt.timer.Reset(d)
+}
+
+// Returns the duration of the timer. For a daily or cron timer, this is the duration from when
+// it was last armed to the trigger time.
 func (lt *LogTimer) Duration() (d time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
 	return lt.d
 }
 
 // Returns the trigger time, i.e. the time the callback is expected to be called.
 func (lt *LogTimer) TriggerTime() time.Time {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
 	return lt.next
 }
 
 // Returns the current time location.
 func (lt *LogTimer) Location() *time.Location {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
 	return lt.base.Location()
 }
 
@@ -97,17 +206,12 @@ func (lt *LogTimer) Location() *time.Location {
 func (lt *LogTimer) doTimerFunc() {
 	defer func() {
 		if x := recover(); x != nil {
-			log.Printf("LogTimer: panic during in doTimerFunc(). %s.\n", x)
+			internalf("LogTimer: panic during in doTimerFunc(). %s.\n", x)
 		}
 	}()
-	lt.cb()
+	// Before the callback, which may Reset the timer.
+	lt.mu.Lock()
 	lt.base = lt.next
-}
-
-// Calculate a duration beteen now and a future time.
-// Rounds to the neareset minute.
-func (lt *LogTimer) calcDurationFromNow(t time.Time) (d time.Duration) {
-	d = t.Sub(time.Now().Round(time.Minute))
-	//log.Printf("calcDurationFromNow: now:%s, future:%s, duration:%s", time.Now().String(), t.String(), d.String())
-	return
+	lt.mu.Unlock()
+	lt.cb()
 }
@@ -70,6 +70,121 @@ func TestLogTimer_TriggerTime(t *testing.T) {
 	}
 }
 
+func TestLogTimer_Reset(t *testing.T) {
+	d := 2 * time.Minute
+	tmr := NewTimer(d, time.Now().Location(), func() {})
+	defer tmr.Stop()
+
+	prev := tmr.TriggerTime()
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		tmr.Reset()
+		next := tmr.TriggerTime()
+		gotestutil.AssertTrue(t, next.After(prev), fmt.Sprintf("Reset %d: expected %s after %s", i, next, prev))
+		gotestutil.AssertTrue(t, next.Sub(time.Now()) <= d && next.Sub(time.Now()) > d-time.Second,
+			fmt.Sprintf("Reset %d: expected the trigger time a duration from now, got %s", i, next))
+		prev = next
+	}
+
+	// Reset from the callback, as a rotation does, after the timer fired.
+	fired := make(chan time.Time, 3)
+	ready := make(chan *LogTimer, 1)
+	rt := NewTimer(20*time.Millisecond, time.Now().Location(), func() {
+		rt := <-ready
+		fired <- rt.TriggerTime()
+		rt.Reset()
+		ready <- rt
+	})
+	ready <- rt
+	defer rt.Stop()
+	prev = time.Time{}
+	for i := 0; i < 3; i++ {
+		tt := <-fired
+		gotestutil.AssertTrue(t, tt.After(prev), fmt.Sprintf("Fire %d: expected %s after %s", i, tt, prev))
+		prev = tt
+	}
+	time.Sleep(time.Millisecond)
+	gotestutil.AssertTrue(t, rt.TriggerTime().After(prev), "Expected the trigger time advanced by the last Reset")
+}
+
+func TestNewDailyTimerAt(t *testing.T) {
+	n := time.Now().In(time.UTC)
+	for _, offset := range []time.Duration{-time.Hour, time.Hour} {
+		at := n.Add(offset)
+		tmr := NewDailyTimerAt(time.UTC, at.Hour(), at.Minute(), func() {})
+		tt := tmr.TriggerTime()
+		tmr.Stop()
+		gotestutil.AssertEqual(t, at.Hour(), tt.Hour(), "Trigger hour did not match.")
+		gotestutil.AssertEqual(t, at.Minute(), tt.Minute(), "Trigger minute did not match.")
+		gotestutil.AssertTrue(t, tt.After(n), "Trigger time is earlier than current time.")
+		if offset < 0 {
+			// Passed today, so scheduled for tomorrow.
+			gotestutil.AssertTrue(t, tt.Sub(n) > 22*time.Hour, "Expected trigger tomorrow, got "+tt.String())
+		} else {
+			gotestutil.AssertTrue(t, tt.Sub(n) <= time.Hour, "Expected trigger in an hour, got "+tt.String())
+		}
+	}
+}
+
+func TestNewDailyTimer_DST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("No time zone data. %s", err)
+	}
+	defer func() {
+		now = time.Now
+	}()
+	at := func(t time.Time) {
+		now = func() time.Time {
+			return t
+		}
+	}
+	midnight := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, loc)
+	}
+
+	// Started exactly at midnight, the timer fires now, and a few seconds before, not early.
+	at(midnight(time.March, 9))
+	tmr := NewDailyTimer(loc, func() {})
+	tmr.Stop()
+	gotestutil.AssertEqual(t, midnight(time.March, 9), tmr.TriggerTime(), "Expected the trigger time now")
+	gotestutil.AssertEqual(t, time.Duration(0), tmr.Duration(), "Expected no wait")
+	at(midnight(time.January, 2).Add(-20 * time.Second))
+	tmr = NewDailyTimer(loc, func() {})
+	tmr.Stop()
+	gotestutil.AssertEqual(t, midnight(time.January, 2), tmr.TriggerTime(), "Expected the next midnight")
+	gotestutil.AssertEqual(t, 20*time.Second, tmr.Duration(), "Expected the time until midnight")
+
+	// Reset after firing, on the spring-forward and fall-back days.
+	for _, tc := range []struct {
+		day   time.Time
+		cycle time.Duration
+	}{
+		{midnight(time.March, 10), 23 * time.Hour},
+		{midnight(time.November, 3), 25 * time.Hour},
+		{midnight(time.July, 4), 24 * time.Hour},
+	} {
+		at(tc.day.Add(-time.Hour))
+		tmr = NewDailyTimer(loc, func() {})
+		gotestutil.AssertEqual(t, tc.day, tmr.TriggerTime(), "Expected the trigger at midnight")
+		at(tc.day.Add(time.Millisecond))
+		tmr.Reset()
+		tmr.Stop()
+		next := tmr.TriggerTime()
+		gotestutil.AssertEqual(t, 0, next.Hour(), "Expected the next trigger at midnight, got "+next.String())
+		gotestutil.AssertEqual(t, tc.cycle, next.Sub(tc.day), "Expected a wall clock day, got "+next.String())
+		gotestutil.AssertEqual(t, tc.cycle-time.Millisecond, tmr.Duration(), "Expected the time until the trigger")
+	}
+
+	// A time in the spring-forward gap is normalized to an hour earlier or later, the same day.
+	at(midnight(time.March, 10))
+	tmr = NewDailyTimerAt(loc, 2, 30, func() {})
+	tmr.Stop()
+	next := tmr.TriggerTime()
+	gotestutil.AssertTrue(t, next.Day() == 10 && (next.Hour() == 1 || next.Hour() == 3) && next.Minute() == 30,
+		"Expected 01:30 EST or 03:30 EDT, got "+next.String())
+}
+
 func TestNewTimer(t *testing.T) {
 	var msg string
 	name1 := "NewTimer01"
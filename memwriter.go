@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Implements a LogWriter that keeps the most recent formatted messages in memory, in a ring
+// buffer, e.g. to serve the last lines from a debug HTTP handler without reading log files.
+//
+// Example:
+//
+//	mw := logger.MemoryWriter(500)
+//	l.AddLogger(mw)
+//	http.HandleFunc("/debug/log", func(w http.ResponseWriter, r *http.Request) {
+//	    fmt.Fprintln(w, strings.Join(mw.Lines(), "\n"))
+//	})
+//
+// The severity of each message from a Log is kept, so a dump, e.g. for a post-mortem bundle, can
+// list the most severe messages first. See LinesBySeverity.
+type RingWriter struct {
+	lines []ringLine
+	next  int  // Index of the next write
+	full  bool // Set once the buffer has wrapped
+	sync.Mutex
+}
+
+// A kept message, and its severity. InvalidSeverity if it was written with Write.
+type ringLine struct {
+	line string
+	sev  Severity
+}
+
+// Creates a LogWriter that keeps the last capacity messages. Once it is full, each write
+// evicts the oldest message. A capacity less than 1 keeps 1 message.
+func MemoryWriter(capacity int) *RingWriter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingWriter{lines: make([]ringLine, capacity)}
+}
+
+// Keep a message, without a trailing newline, and with no severity. This implements the
+// io.Writer interface
+// This is goroutine safe.
+func (rw *RingWriter) Write(p []byte) (n int, err error) {
+	return rw.WriteSeverity(InvalidSeverity, p)
+}
+
+// Keep a message, without a trailing newline, and its severity. This implements the
+// SeverityWriter interface, so a Log writes each message with its severity.
+// This is goroutine safe.
+func (rw *RingWriter) WriteSeverity(sev Severity, p []byte) (n int, err error) {
+	rw.Lock()
+	defer rw.Unlock()
+
+	rw.lines[rw.next] = ringLine{line: strings.TrimSuffix(string(p), "\n"), sev: sev}
+	rw.next++
+	if rw.next == len(rw.lines) {
+		rw.next = 0
+		rw.full = true
+	}
+	return len(p), nil
+}
+
+// Returns a copy of the kept messages, oldest first.
+// This is goroutine safe.
+func (rw *RingWriter) Lines() []string {
+	return lineStrings(rw.kept())
+}
+
+// Returns a copy of the kept messages, most severe first, e.g. ERROR before INFO, and oldest
+// first within a severity. Messages written with Write, which have no severity, are last.
+// Only the dump is ordered. The messages are kept in the order written.
+// This is goroutine safe.
+func (rw *RingWriter) LinesBySeverity() []string {
+	kept := rw.kept()
+	sort.SliceStable(kept, func(i, j int) bool {
+		return severityRank(kept[i].sev) < severityRank(kept[j].sev)
+	})
+	return lineStrings(kept)
+}
+
+// Returns a copy of the kept messages, oldest first.
+func (rw *RingWriter) kept() []ringLine {
+	rw.Lock()
+	defer rw.Unlock()
+
+	if !rw.full {
+		return append([]ringLine(nil), rw.lines[:rw.next]...)
+	}
+	kept := make([]ringLine, 0, len(rw.lines))
+	kept = append(kept, rw.lines[rw.next:]...)
+	return append(kept, rw.lines[:rw.next]...)
+}
+
+// Returns the sort order of a severity, with Emergency first, and no severity last.
+func severityRank(sev Severity) int {
+	if sev < SeverityMinLevel {
+		return math.MaxInt16 + 1
+	}
+	return int(sev)
+}
+
+// Returns the messages of the kept lines.
+func lineStrings(kept []ringLine) []string {
+	lines := make([]string, len(kept))
+	for i, rl := range kept {
+		lines[i] = rl.line
+	}
+	return lines
+}
+
+// Close is a no-op, so the messages stay readable. This implements the io.Closer interface
+func (rw *RingWriter) Close() error {
+	return nil
+}
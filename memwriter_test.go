@@ -0,0 +1,81 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestMemoryWriter(t *testing.T) {
+	testName := "TestMemoryWriter"
+	mw := MemoryWriter(3)
+	l := LogManger(testName, DiscardWriter())
+	l.AddLogger(mw)
+	l.SetFormatter(&spyFormatter{})
+
+	gotestutil.AssertEqual(t, 0, len(mw.Lines()), GetCaller()+" Expected no lines")
+	l.Info(testName, "msg 1", nil)
+	l.Info(testName, "msg 2", nil)
+	gotestutil.AssertEqual(t, []string{"msg 1", "msg 2"}, mw.Lines(), GetCaller()+" Expected lines in order")
+
+	// The oldest lines are evicted.
+	for i := 3; i <= 5; i++ {
+		l.Info(testName, fmt.Sprintf("msg %d", i), nil)
+	}
+	gotestutil.AssertEqual(t, []string{"msg 3", "msg 4", "msg 5"}, mw.Lines(), GetCaller()+" Expected the last 3 lines")
+
+	// Run with -race.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				mw.Write([]byte("concurrent\n"))
+				mw.Lines()
+			}
+		}()
+	}
+	wg.Wait()
+	gotestutil.AssertEqual(t, []string{"concurrent", "concurrent", "concurrent"}, mw.Lines(), GetCaller()+" Expected full buffer")
+}
+
+func TestMemoryWriter_LinesBySeverity(t *testing.T) {
+	testName := "TestMemoryWriter_LinesBySeverity"
+	for _, async := range []bool{false, true} {
+		t.Run(fmt.Sprintf("async=%t", async), func(t *testing.T) {
+			mw := MemoryWriter(5)
+			l := LogManger(testName, DiscardWriter())
+			defer l.Close()
+			l.AddLogger(mw)
+			l.SetFormatter(&spyFormatter{})
+			if async {
+				gotestutil.AssertNil(t, l.AsyncBuffer(10, OverflowBlock), GetCaller()+" Error setting async")
+			}
+
+			l.Info(testName, "info 1", nil)
+			l.Error(testName, "error 1", nil)
+			l.Warning(testName, "warn 1", nil)
+			l.Info(testName, "info 2", nil)
+			l.Error(testName, "error 2", nil)
+			gotestutil.AssertNil(t, l.Flush(), GetCaller()+" Error flushing")
+
+			// ERRORs before INFOs, and oldest first within a severity.
+			gotestutil.AssertEqual(t, []string{"error 1", "error 2", "warn 1", "info 1", "info 2"},
+				mw.LinesBySeverity(), GetCaller()+" Expected the most severe first")
+			// The kept order is unchanged.
+			gotestutil.AssertEqual(t, []string{"info 1", "error 1", "warn 1", "info 2", "error 2"},
+				mw.Lines(), GetCaller()+" Expected lines in order")
+		})
+	}
+
+	// A message written without a severity is last.
+	mw := MemoryWriter(3)
+	mw.Write([]byte("no severity\n"))
+	mw.WriteSeverity(Debug, []byte("debug\n"))
+	mw.WriteSeverity(Critical, []byte("critical\n"))
+	gotestutil.AssertEqual(t, []string{"critical", "debug", "no severity"}, mw.LinesBySeverity(),
+		GetCaller()+" Expected no severity last")
+}
@@ -0,0 +1,492 @@
+// MessagePack Formatter
+// A MessagePack formatter encodes each event as a binary MessagePack map, which is smaller and
+// faster to produce than the text formats, for very high log rates. The keys are those of the
+// JSONFormatter, i.e. "timestamp", "severity", "hostname", "appname", "pid", "msg_id", "message"
+// and "params", a map of string values. The timestamp is the MessagePack timestamp extension,
+// so the location is not preserved, and it is decoded in UTC.
+//
+// MessagePack values are self-delimiting, so the records are concatenated, with no separator.
+// A LogFile alters embedded newlines by default, so set SetRawWrites on a LogFile that receives
+// the records. Read the file back with a MsgPackDecoder.
+//
+// Example:
+//
+//	lf, _ := logger.File("/var/log/myapp/events")
+//	lf.SetRawWrites(true)
+//	l := logger.LogManger("myapp", lf)
+//	l.SetFormatter(logger.MsgPack())
+//	...
+//	d := logger.NewMsgPackDecoder(f)
+//	for {
+//	    em, err := d.Decode()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    ...
+//	}
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// A formatter that encodes events as bytes, rather than text, e.g. the MsgPackFormatter.
+// The Log detects it, and uses FormatBinary rather than Format, so the record is not converted
+// to a string.
+type BinaryFormatter interface {
+	EventFormatter
+	// Append the encoded event to dst, and return the extended buffer.
+	FormatBinary(dst []byte, em EventMsg) ([]byte, error)
+}
+
+// MessagePack format bytes used by the encoder and decoder.
+const (
+	mpNil       = 0xc0
+	mpFalse     = 0xc2
+	mpTrue      = 0xc3
+	mpBin8      = 0xc4
+	mpBin16     = 0xc5
+	mpBin32     = 0xc6
+	mpExt8      = 0xc7
+	mpExt16     = 0xc8
+	mpExt32     = 0xc9
+	mpFloat32   = 0xca
+	mpFloat64   = 0xcb
+	mpUint8     = 0xcc
+	mpUint16    = 0xcd
+	mpUint32    = 0xce
+	mpUint64    = 0xcf
+	mpInt8      = 0xd0
+	mpInt16     = 0xd1
+	mpInt32     = 0xd2
+	mpInt64     = 0xd3
+	mpFixExt1   = 0xd4
+	mpFixExt4   = 0xd6
+	mpFixExt8   = 0xd7
+	mpFixExt16  = 0xd8
+	mpStr8      = 0xd9
+	mpStr16     = 0xda
+	mpStr32     = 0xdb
+	mpArray16   = 0xdc
+	mpArray32   = 0xdd
+	mpMap16     = 0xde
+	mpMap32     = 0xdf
+	mpTimestamp = 0xff // The extension type of a timestamp, -1.
+)
+
+// Limits the size of a decoded string, map or extension, so a corrupt length does not exhaust
+// memory.
+const msgPackMaxLen = 16 << 20
+
+// MsgPackFormatter encodes events as MessagePack. See MsgPack.
+type MsgPackFormatter struct {
+	name string
+}
+
+// Create a new MessagePack event message formatter.
+// Returns a BinaryFormatter interface.
+func MsgPack() BinaryFormatter {
+	return &MsgPackFormatter{name: "msgpack"}
+}
+
+// Returns the name of the formatter
+func (mf *MsgPackFormatter) Name() string {
+	return mf.name
+}
+
+// Implements EventFormatter interface. The string holds the binary record.
+func (mf *MsgPackFormatter) Format(em EventMsg) (msg string, err error) {
+	b, err := mf.FormatBinary(nil, em)
+	return string(b), err
+}
+
+// Implements BinaryFormatter interface. Params are encoded sorted by key.
+func (mf *MsgPackFormatter) FormatBinary(dst []byte, em EventMsg) ([]byte, error) {
+	b := appendMsgPackMapLen(dst, 8)
+	b = appendMsgPackString(b, "timestamp")
+	b = appendMsgPackTimestamp(b, em.Timestamp)
+	b = appendMsgPackString(b, "severity")
+	b = appendMsgPackString(b, em.Sev)
+	b = appendMsgPackString(b, "hostname")
+	b = appendMsgPackString(b, em.Hostname)
+	b = appendMsgPackString(b, "appname")
+	b = appendMsgPackString(b, em.Appname)
+	b = appendMsgPackString(b, "pid")
+	b = appendMsgPackInt(b, int64(em.Pid))
+	b = appendMsgPackString(b, "msg_id")
+	b = appendMsgPackString(b, em.MsgId)
+	b = appendMsgPackString(b, "message")
+	b = appendMsgPackString(b, em.Msg)
+	b = appendMsgPackString(b, "params")
+	b = appendMsgPackMapLen(b, len(em.Params))
+	// Sorted for stable output, without allocating for a few keys.
+	var buf [16]string
+	keys := buf[:0]
+	for k := range em.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = appendMsgPackString(b, k)
+		b = appendMsgPackString(b, em.Params[k])
+	}
+	return b, nil
+}
+
+// Append the header of a map of n entries.
+func appendMsgPackMapLen(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, mpMap16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, mpMap32), uint32(n))
+}
+
+// Append a string, with the shortest header of its length.
+func appendMsgPackString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, mpStr8, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, mpStr16), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, mpStr32), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// Append an integer, as a fixint, int32 or int64.
+func appendMsgPackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 127:
+		return append(b, byte(v))
+	case v >= -32 && v < 0:
+		return append(b, byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, mpInt32), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, mpInt64), uint64(v))
+}
+
+// Append a timestamp extension, in the 64-bit format if the seconds fit in 34 bits, else the
+// 96-bit format.
+func appendMsgPackTimestamp(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	if sec >= 0 && sec < 1<<34 {
+		return binary.BigEndian.AppendUint64(append(b, mpFixExt8, mpTimestamp), nsec<<34|uint64(sec))
+	}
+	b = binary.BigEndian.AppendUint32(append(b, mpExt8, 12, mpTimestamp), uint32(nsec))
+	return binary.BigEndian.AppendUint64(b, uint64(sec))
+}
+
+// MsgPackDecoder reads the events of a stream of MessagePack records, e.g. a file written with
+// the MsgPackFormatter. Keys other than those of the MsgPackFormatter are skipped.
+type MsgPackDecoder struct {
+	r *bufio.Reader
+}
+
+// Create a decoder of the records read from r.
+func NewMsgPackDecoder(r io.Reader) *MsgPackDecoder {
+	return &MsgPackDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode the next event. Returns io.EOF at the end of the stream, io.ErrUnexpectedEOF if the
+// last record is truncated, and ParseError if a record is not valid.
+func (d *MsgPackDecoder) Decode() (em EventMsg, err error) {
+	if _, err = d.r.Peek(1); err != nil {
+		return
+	}
+	em, err = decodeMsgPackEvent(d.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// Parse one record formatted by the MsgPackFormatter into an EventMsg.
+func ParseMsgPack(b []byte) (EventMsg, error) {
+	return NewMsgPackDecoder(bytes.NewReader(b)).Decode()
+}
+
+// Decode an event map.
+func decodeMsgPackEvent(r *bufio.Reader) (em EventMsg, err error) {
+	n, err := readMsgPackMapLen(r)
+	if err != nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		var k string
+		if k, err = readMsgPackString(r); err != nil {
+			return
+		}
+		switch k {
+		case "timestamp":
+			em.Timestamp, err = readMsgPackTimestamp(r)
+		case "severity":
+			em.Sev, err = readMsgPackString(r)
+		case "hostname":
+			em.Hostname, err = readMsgPackString(r)
+		case "appname":
+			em.Appname, err = readMsgPackString(r)
+		case "pid":
+			var pid int64
+			pid, err = readMsgPackInt(r)
+			em.Pid = int(pid)
+		case "msg_id":
+			em.MsgId, err = readMsgPackString(r)
+		case "message":
+			em.Msg, err = readMsgPackString(r)
+		case "params":
+			em.Params, err = readMsgPackParams(r)
+		default:
+			err = skipMsgPackValue(r, 0)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Read a map of strings. An empty map is returned as nil.
+func readMsgPackParams(r *bufio.Reader) (map[string]string, error) {
+	n, err := readMsgPackMapLen(r)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	params := make(map[string]string, int(min(int64(n), 64)))
+	for i := 0; i < n; i++ {
+		k, err := readMsgPackString(r)
+		if err != nil {
+			return nil, err
+		}
+		if params[k], err = readMsgPackString(r); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// Read the header of a map. Returns the number of entries.
+func readMsgPackMapLen(r *bufio.Reader) (int, error) {
+	c, err := r.ReadByte()
+	switch {
+	case err != nil:
+		return 0, err
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == mpMap16:
+		return readMsgPackUint(r, 2)
+	case c == mpMap32:
+		return readMsgPackUint(r, 4)
+	}
+	return 0, ParseError
+}
+
+// Read a string.
+func readMsgPackString(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == mpStr8:
+		n, err = readMsgPackUint(r, 1)
+	case c == mpStr16:
+		n, err = readMsgPackUint(r, 2)
+	case c == mpStr32:
+		n, err = readMsgPackUint(r, 4)
+	default:
+		return "", ParseError
+	}
+	if err != nil {
+		return "", err
+	}
+	b, err := readMsgPackBytes(r, n)
+	return string(b), err
+}
+
+// Read an integer of any encoding.
+func readMsgPackInt(r *bufio.Reader) (int64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var size int
+	switch {
+	case c <= 0x7f, c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= mpUint8 && c <= mpUint64:
+		size = 1 << (c - mpUint8)
+	case c >= mpInt8 && c <= mpInt64:
+		size = 1 << (c - mpInt8)
+	default:
+		return 0, ParseError
+	}
+	b, err := readMsgPackBytes(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, x := range b {
+		u = u<<8 | uint64(x)
+	}
+	if c >= mpInt8 {
+		// Sign extend.
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	}
+	if u > math.MaxInt64 {
+		return 0, ParseError
+	}
+	return int64(u), nil
+}
+
+// Read a timestamp extension, in any of the 32, 64 or 96-bit formats.
+func readMsgPackTimestamp(r *bufio.Reader) (time.Time, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return time.Time{}, err
+	}
+	n := 0
+	switch c {
+	case mpFixExt4:
+		n = 4
+	case mpFixExt8:
+		n = 8
+	case mpExt8:
+		if n, err = readMsgPackUint(r, 1); err != nil {
+			return time.Time{}, err
+		}
+		if n != 12 {
+			return time.Time{}, ParseError
+		}
+	default:
+		return time.Time{}, ParseError
+	}
+	b, err := readMsgPackBytes(r, n+1)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if b[0] != mpTimestamp {
+		return time.Time{}, ParseError
+	}
+	b = b[1:]
+	var sec, nsec int64
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(b))
+	case 8:
+		v := binary.BigEndian.Uint64(b)
+		sec, nsec = int64(v&(1<<34-1)), int64(v>>34)
+	case 12:
+		nsec, sec = int64(binary.BigEndian.Uint32(b)), int64(binary.BigEndian.Uint64(b[4:]))
+	}
+	if nsec >= 1e9 {
+		return time.Time{}, ParseError
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
+
+// Skip a value of any type. depth limits the nesting of arrays and maps.
+func skipMsgPackValue(r *bufio.Reader, depth int) error {
+	if depth > 32 {
+		return ParseError
+	}
+	c, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	// The number of bytes, and of nested values, that follow the header.
+	var size, values int
+	switch {
+	case c <= 0x7f, c >= 0xe0, c == mpNil, c == mpFalse, c == mpTrue:
+	case c&0xe0 == 0xa0:
+		size = int(c & 0x1f)
+	case c&0xf0 == 0x90:
+		values = int(c & 0x0f)
+	case c&0xf0 == 0x80:
+		values = 2 * int(c&0x0f)
+	case c >= mpUint8 && c <= mpUint64:
+		size = 1 << (c - mpUint8)
+	case c >= mpInt8 && c <= mpInt64:
+		size = 1 << (c - mpInt8)
+	case c == mpFloat32:
+		size = 4
+	case c == mpFloat64:
+		size = 8
+	case c >= mpFixExt1 && c <= mpFixExt16:
+		size = 1 + 1<<(c-mpFixExt1)
+	case c == mpBin8, c == mpStr8:
+		size, err = readMsgPackUint(r, 1)
+	case c == mpBin16, c == mpStr16:
+		size, err = readMsgPackUint(r, 2)
+	case c == mpBin32, c == mpStr32:
+		size, err = readMsgPackUint(r, 4)
+	case c >= mpExt8 && c <= mpExt32:
+		if size, err = readMsgPackUint(r, 1<<(c-mpExt8)); err == nil {
+			size++ // The type
+		}
+	case c == mpArray16, c == mpArray32:
+		values, err = readMsgPackUint(r, 2<<(c-mpArray16))
+	case c == mpMap16, c == mpMap32:
+		values, err = readMsgPackUint(r, 2<<(c-mpMap16))
+		values *= 2
+	default:
+		return ParseError
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = r.Discard(size); err != nil {
+		return err
+	}
+	for i := 0; i < values; i++ {
+		if err = skipMsgPackValue(r, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read a big-endian unsigned integer of size bytes, as a length.
+func readMsgPackUint(r *bufio.Reader, size int) (int, error) {
+	b, err := readMsgPackBytes(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, x := range b {
+		n = n<<8 | int(x)
+	}
+	if n > msgPackMaxLen {
+		return 0, ParseError
+	}
+	return n, nil
+}
+
+// Read exactly n bytes. Returns io.EOF if the stream ends first.
+func readMsgPackBytes(r *bufio.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,45 @@
+// Panic handling flushes the logs before a panic propagates, so the events leading up to it,
+// and the panic itself, are not lost in a buffer.
+//
+// Example:
+//
+//	func main() {
+//	    l := logger.LogManger("MyApp", f)
+//	    defer l.InstallPanicFlush()
+//	    ...
+//	}
+package logger
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Must be deferred, e.g. at the top of main or a goroutine: defer l.InstallPanicFlush().
+// If the goroutine is panicking, logs the panic with Recover, flushes all modules, and
+// re-panics with the same value.
+func (l *Log) InstallPanicFlush() {
+	if x := recover(); x != nil {
+		l.Recover(x)
+		panic(x)
+	}
+}
+
+// Log a recovered panic value at Emergency, with the stack as the "stack" param, and flush
+// all modules. Does nothing if recovered is nil.
+//
+// Example:
+//
+//	defer func() {
+//	    if x := recover(); x != nil {
+//	        l.Recover(x)
+//	    }
+//	}()
+func (l *Log) Recover(recovered interface{}) {
+	if recovered == nil {
+		return
+	}
+	l.Emergency("PANIC", fmt.Sprintf("panic: %v", recovered),
+		map[string]string{"stack": string(debug.Stack())})
+	l.Flush()
+}
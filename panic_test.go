@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+// A testWriter that counts calls to Flush
+type flushWriter struct {
+	testWriter
+	flushes int
+}
+
+func (fw *flushWriter) Flush() error {
+	fw.flushes++
+	return nil
+}
+
+func TestLog_InstallPanicFlush(t *testing.T) {
+	fw := &flushWriter{}
+	l := LogManger("TestLog_InstallPanicFlush", fw)
+
+	var recovered interface{}
+	var lines []string
+	var flushes int
+	func() {
+		defer func() {
+			recovered = recover()
+			lines, flushes = fw.Lines(), fw.flushes
+		}()
+		func() {
+			defer l.InstallPanicFlush()
+			panic("test panic")
+		}()
+	}()
+
+	gotestutil.AssertEqual(t, "test panic", recovered, "Expected the panic to be re-raised")
+	gotestutil.AssertEqual(t, 1, flushes, "Expected a flush before the re-raise")
+	gotestutil.AssertEqual(t, 1, len(lines), "Expected the panic event before the re-raise")
+	ems := fw.Events(t)
+	gotestutil.AssertEqual(t, Severity(Emergency).String(), ems[0].Sev, "Expected an EMERG event")
+	gotestutil.AssertEqual(t, "panic: test panic", ems[0].Msg, "Expected the panic value")
+	gotestutil.AssertTrue(t, strings.Contains(ems[0].Params["stack"], "TestLog_InstallPanicFlush"),
+		"Expected the stack param")
+}
+
+func TestLog_Recover(t *testing.T) {
+	fw := &flushWriter{}
+	l := LogManger("TestLog_Recover", fw)
+
+	l.Recover(nil)
+	gotestutil.AssertEqual(t, 0, len(fw.Lines()), "Expected no event for a nil value")
+
+	func() {
+		defer func() {
+			l.Recover(recover())
+		}()
+		panic("recovered panic")
+	}()
+	gotestutil.AssertEqual(t, 1, len(fw.Lines()), "Expected the panic event")
+	gotestutil.AssertEqual(t, 1, fw.flushes, "Expected a flush")
+}
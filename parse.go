@@ -0,0 +1,134 @@
+// Parse reverses the formatters, converting a formatted log line back into an EventMsg.
+// This is used by tools that consume the output of this package, e.g. relays, aggregators,
+// and tests that round-trip events.
+//
+// Parsing is lossy for the Timestamp: the location is restored as a fixed offset, and the
+// monotonic clock reading is not preserved. The JSON DefaultTimeFormat has whole seconds, so
+// the fraction is lost, too. Compare timestamps with time.Time.Equal.
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Returned when a log line cannot be parsed.
+	ParseError error = errors.New("Parse Exception")
+)
+
+// Parse a line formatted by the JSONFormatter into an EventMsg.
+// Fields added by formatter options (e.g. "schema") are ignored. The top-level "trace_id" and
+// "span_id" fields are restored to Params.
+func ParseJSON(line string) (em EventMsg, err error) {
+	var rec struct {
+		EventMsg
+		TraceID string `json:"trace_id"`
+		SpanID  string `json:"span_id"`
+	}
+	if err = json.Unmarshal([]byte(strings.TrimSpace(line)), &rec); err != nil {
+		return
+	}
+	em = rec.EventMsg
+	for k, v := range map[string]string{TraceIDParam: rec.TraceID, SpanIDParam: rec.SpanID} {
+		if v == "" {
+			continue
+		}
+		if em.Params == nil {
+			em.Params = make(map[string]string)
+		}
+		em.Params[k] = v
+	}
+	return
+}
+
+// Parse a line of logfmt key=value pairs into an EventMsg.
+// The keys timestamp, severity, hostname, appname, pid, msg_id and message set the matching
+// EventMsg field. All other keys are added to Params.
+// Values may be double-quoted, using Go escapes. The timestamp must be RFC 3339.
+func ParseLogfmt(line string) (em EventMsg, err error) {
+	pairs, err := splitLogfmt(line)
+	if err != nil {
+		return
+	}
+	for _, kv := range pairs {
+		switch k, v := kv[0], kv[1]; k {
+		case "timestamp":
+			if em.Timestamp, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return
+			}
+		case "severity":
+			em.Sev = v
+		case "hostname":
+			em.Hostname = v
+		case "appname":
+			em.Appname = v
+		case "pid":
+			if em.Pid, err = strconv.Atoi(v); err != nil {
+				return
+			}
+		case "msg_id":
+			em.MsgId = v
+		case "message":
+			em.Msg = v
+		default:
+			if em.Params == nil {
+				em.Params = make(map[string]string)
+			}
+			em.Params[k] = v
+		}
+	}
+	return
+}
+
+// Split a logfmt line into key/value pairs. A key without a value has an empty value.
+func splitLogfmt(line string) (pairs [][2]string, err error) {
+	s := strings.TrimSpace(line)
+	for len(s) > 0 {
+		var k, v string
+		i := strings.IndexAny(s, "= ")
+		if i < 0 {
+			pairs = append(pairs, [2]string{s, ""})
+			break
+		}
+		k, s = s[:i], s[i:]
+		if s[0] == '=' {
+			s = s[1:]
+			if v, s, err = readLogfmtValue(s); err != nil {
+				return nil, err
+			}
+		}
+		if len(k) == 0 {
+			return nil, ParseError
+		}
+		pairs = append(pairs, [2]string{k, v})
+		s = strings.TrimLeft(s, " ")
+	}
+	return
+}
+
+// Read a value, which is either quoted or ends at the next space.
+// Returns the value, and the remainder of the string.
+func readLogfmtValue(s string) (v string, rest string, err error) {
+	if len(s) == 0 || s[0] != '"' {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			return s, "", nil
+		}
+		return s[:i], s[i:], nil
+	}
+	// Find the closing quote, skipping escaped characters.
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err = strconv.Unquote(s[:i+1])
+			return v, s[i+1:], err
+		}
+	}
+	return "", "", ParseError
+}
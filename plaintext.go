@@ -1,59 +1,101 @@
 package logger
 
 import (
-	"strings"
-	"fmt"
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
 )
 
 const (
-	DefaultFieldSeparator string = "|"	// For log formatter
+	DefaultFieldSeparator string = "|" // For log formatter
+	DefaultParamSeparator string = "," // Between params, with the default field separator
 )
 
 type PlainTextFormatter struct {
-	name      string
-	separator string
+	name       string
+	separator  string
+	timeFormat string // Empty is DefaultTimeFormat
 }
 
 // Create a new Plain Text event message formatter.
-// Returns an EventFormatter interface.
-func PlainText() EventFormatter {
-	return PlainTextFormatter{
-		name:"plain_text",
-		separator:DefaultFieldSeparator}
+func PlainText() *PlainTextFormatter {
+	return &PlainTextFormatter{
+		name:      "plain_text",
+		separator: DefaultFieldSeparator}
 }
 
-// Set the field delimeter for log messages.
-func (ptf PlainTextFormatter) SetDelimeter(d string) {
+// Returns the name of the formatter
+func (ptf *PlainTextFormatter) Name() string {
+	return ptf.name
+}
+
+// Set the field delimeter for log messages, e.g. "\t".
+// A delimeter other than the default also separates the params.
+func (ptf *PlainTextFormatter) SetDelimeter(d string) {
 	ptf.separator = d
 }
 
+// Set the timestamp layout, e.g. time.RFC3339, a custom time.Format layout, or the
+// TimeFormatUnix or TimeFormatUnixMilli sentinel. An empty layout restores DefaultTimeFormat.
+func (ptf *PlainTextFormatter) SetTimeFormat(layout string) {
+	ptf.timeFormat = layout
+}
+
 // Implements EventFormatter interface.
-func (ptf PlainTextFormatter) Format(em EventMsg) (msg string, err error) {
-	var defaultFmt = "%s|%s|%s|%s|%d|%s|%s|"
-	var altSepFmt = "%s%s%s%s%s%s%s%s%d%s%s%s%s%s"
-	ptf.separator = DefaultFieldSeparator
-
-	tm := strings.Replace(fmt.Sprintf("%s", em.Timestamp.String()), " ", "", -1)
-	if ptf.separator == DefaultFieldSeparator {
-		msg = fmt.Sprintf(defaultFmt,
-			tm, em.Sev, em.Hostname, em.Appname, em.Pid, em.MsgId, em.Msg)
-	} else {
-		msg = fmt.Sprintf(altSepFmt,
-			tm, ptf.separator,
-			em.Sev, ptf.separator,
-			em.Hostname, ptf.separator,
-			em.Appname,ptf.separator,
-			em.Pid, ptf.separator,
-			em.MsgId, ptf.separator,
-			em.Msg, ptf.separator)
+func (ptf *PlainTextFormatter) Format(em EventMsg) (msg string, err error) {
+	var buf bytes.Buffer
+	ptf.write(&buf, em)
+	return buf.String(), nil
+}
+
+// Implements FormatterTo interface.
+func (ptf *PlainTextFormatter) FormatTo(w io.Writer, em EventMsg) error {
+	if buf, ok := w.(*bytes.Buffer); ok {
+		ptf.write(buf, em)
+		return nil
 	}
-	msg += "["
-	for n, v := range em.Params {
-		msg += fmt.Sprintf("%s=%s,", n, v)
+	var buf bytes.Buffer
+	ptf.write(&buf, em)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Write the fields, each followed by the separator, and the params in brackets.
+func (ptf *PlainTextFormatter) write(buf *bytes.Buffer, em EventMsg) {
+	paramSep := DefaultParamSeparator
+	if ptf.separator != DefaultFieldSeparator {
+		paramSep = ptf.separator
+	}
+
+	var arr [64]byte
+	buf.Write(appendTimestamp(arr[:0], em.Timestamp, ptf.timeFormat))
+	buf.WriteString(ptf.separator)
+	for _, s := range [...]string{em.Sev, em.Hostname, em.Appname} {
+		buf.WriteString(s)
+		buf.WriteString(ptf.separator)
+	}
+	buf.Write(strconv.AppendInt(arr[:0], int64(em.Pid), 10))
+	buf.WriteString(ptf.separator)
+	buf.WriteString(em.MsgId)
+	buf.WriteString(ptf.separator)
+	buf.WriteString(em.Msg)
+	buf.WriteString(ptf.separator)
+
+	// Sorted by key, so the output is stable.
+	keys := make([]string, 0, len(em.Params))
+	for k := range em.Params {
+		keys = append(keys, k)
 	}
-	if msg[len(msg) - 1] == ',' {
-		msg = msg[:len(msg) - 1]
+	sort.Strings(keys)
+	buf.WriteByte('[')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString(paramSep)
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(em.Params[k])
 	}
-	msg += "]"
-	return
+	buf.WriteByte(']')
 }
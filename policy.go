@@ -14,6 +14,8 @@ const (
 	PolicyTimeLimit
 	// Rotate based on the file size.
 	PolicyFileSize
+	// Rotate based on the number of lines (events) in the file.
+	PolicyLineLimit
 	// For future expansion
 	PolicyCustom1
 	PolicyCustom2
@@ -22,7 +24,7 @@ const (
 
 // Sring representation of the policy
 var policyName = []string{
-	"Invalid", "PolicyNone", "PolicyDaily", "PolicyTimeLimit", "PolicyFileSize",
+	"Invalid", "PolicyNone", "PolicyDaily", "PolicyTimeLimit", "PolicyFileSize", "PolicyLineLimit",
 }
 
 // Returns the string representation of the policy
@@ -49,3 +51,13 @@ func (pt PolicyType) IsTimed() bool {
 func (pt PolicyType) IsSizeLimited() bool {
 	return (pt == PolicyFileSize)
 }
+
+// Returns true if the log file has a line limit
+func (pt PolicyType) IsLineLimited() bool {
+	return (pt == PolicyLineLimit)
+}
+
+// Returns true if the rotation check is done after each write
+func (pt PolicyType) rotatesOnWrite() bool {
+	return (pt == PolicyFileSize || pt == PolicyLineLimit)
+}
@@ -0,0 +1,169 @@
+// Sampling drops a portion of events before they are formatted.
+//
+// Trace sampling keeps or drops events based on a deterministic hash of a designated param,
+// e.g. "trace_id". All events with the same param value get the same decision, so the logs
+// for a given trace are either all kept or all dropped.
+//
+// A Sampler limits the events of a msgId, e.g. to stop a single msgId flooding the logs during an
+// incident. Suppressed events are counted, and summarized with a NOTICE event, "SUPPRESSED",
+// when the next event of the msgId is sampled after the summary period.
+package logger
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Interval of the rate limit, and of the summaries of suppressed events.
+	samplerPeriod = time.Second
+	// Message ID of the summary of suppressed events.
+	suppressedMsgId = "SUPPRESSED"
+	// The state of a msgId without events for this long is removed from a RateSampler.
+	samplerIdle = time.Minute
+)
+
+// Decides which events of a msgId are logged. Implementations must be goroutine safe.
+type Sampler interface {
+	// Returns true to keep the event. Suppressed is the number of events of the msgId dropped
+	// since the last summary, if a summary is due, else 0.
+	Sample(msgId string) (keep bool, suppressed uint64)
+}
+
+// The sampling state of one msgId.
+type sampleState struct {
+	periodStart time.Time
+	last        time.Time // Time of the last event, to evict an idle msgId.
+	count       uint64    // Events in the current period, for the rate limit.
+	total       uint64    // Events in total, for 1-in-N sampling.
+	suppressed  uint64
+}
+
+// Implements a Sampler that keeps up to a rate of events per second, or 1 in N events, of a
+// msgId. Each msgId is sampled separately.
+//
+// The state of a msgId is removed after a minute without events, so a sampler of every msgId
+// does not grow without bound, e.g. with generated msgIds. A removed msgId starts again, i.e.
+// its next event is kept, and a count of suppressed events not yet summarized is dropped.
+type RateSampler struct {
+	msgId  string // Empty samples every msgId.
+	rate   uint64 // Events per second, if not zero.
+	n      uint64 // Keep 1 in n events, if not zero.
+	states map[string]*sampleState
+	swept  time.Time // Time idle states were last removed.
+	sync.Mutex
+}
+
+// Creates a sampler that keeps up to perSecond events per second of the msgId.
+// An empty msgId limits each msgId separately.
+func NewRateSampler(msgId string, perSecond int) *RateSampler {
+	return &RateSampler{msgId: msgId, rate: uint64(perSecond), states: make(map[string]*sampleState)}
+}
+
+// Creates a sampler that keeps 1 in n events of the msgId, starting with the first.
+// An empty msgId samples each msgId separately.
+func NewNthSampler(msgId string, n int) *RateSampler {
+	return &RateSampler{msgId: msgId, n: uint64(n), states: make(map[string]*sampleState)}
+}
+
+// Implements the Sampler interface.
+func (rs *RateSampler) Sample(msgId string) (keep bool, suppressed uint64) {
+	if rs.msgId != "" && rs.msgId != msgId {
+		return true, 0
+	}
+	rs.Lock()
+	defer rs.Unlock()
+
+	t := now()
+	if t.Sub(rs.swept) >= samplerIdle {
+		rs.removeIdle(t)
+	}
+	st, ok := rs.states[msgId]
+	if !ok {
+		st = &sampleState{periodStart: t}
+		rs.states[msgId] = st
+	}
+	st.last = t
+	if t.Sub(st.periodStart) >= samplerPeriod {
+		st.periodStart, st.count = t, 0
+		suppressed, st.suppressed = st.suppressed, 0
+	}
+
+	st.count++
+	st.total++
+	keep = true
+	if rs.rate > 0 && st.count > rs.rate {
+		keep = false
+	}
+	if rs.n > 1 && (st.total-1)%rs.n != 0 {
+		keep = false
+	}
+	if !keep {
+		st.suppressed++
+	}
+	return
+}
+
+// Remove the states of msgIds without events for samplerIdle. This runs at most once per
+// samplerIdle, so the cost of the scan is spread over the events.
+// The caller must synchronize access.
+func (rs *RateSampler) removeIdle(t time.Time) {
+	for msgId, st := range rs.states {
+		if t.Sub(st.last) >= samplerIdle {
+			delete(rs.states, msgId)
+		}
+	}
+	rs.swept = t
+}
+
+// Set a sampler, applied to each event after the severity filter, before it is formatted.
+// A nil sampler disables sampling.
+//
+// Example:
+//
+//	l.SetSampler(logger.NewRateSampler("DBERROR", 100)) // Up to 100 DBERROR events a second
+func (l *Log) SetSampler(s Sampler) {
+	l.sampler = s
+}
+
+// Returns true if the event should be kept by the sampler. Logs a summary of suppressed
+// events, if one is due.
+func (l *Log) keepSample(msgId string) bool {
+	if l.sampler == nil || msgId == suppressedMsgId {
+		return true
+	}
+	keep, suppressed := l.sampler.Sample(msgId)
+	if suppressed > 0 {
+		l.Notice(suppressedMsgId, fmt.Sprintf("suppressed %d events for msg_id %s", suppressed, msgId),
+			map[string]string{"msg_id": msgId, "suppressed": strconv.FormatUint(suppressed, 10)})
+	}
+	return keep
+}
+
+// Keep 1 in rate of the traces identified by the param key.
+// Events without the param are always kept. A rate of 0 or 1 disables trace sampling.
+//
+// Example:
+//
+//	l.SetTraceSampling("trace_id", 10) // Keep 10% of traces
+func (l *Log) SetTraceSampling(key string, rate uint32) {
+	l.sampleKey = key
+	l.sampleRate = rate
+}
+
+// Returns true if the event should be kept by trace sampling.
+func (l *Log) keepTraceSample(params map[string]string) bool {
+	if l.sampleRate <= 1 {
+		return true
+	}
+	v, ok := params[l.sampleKey]
+	if !ok {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(v))
+	return h.Sum32()%l.sampleRate == 0
+}
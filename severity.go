@@ -1,6 +1,10 @@
 package logger
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
 
 // Public constants
 type Severity int16
@@ -22,8 +26,10 @@ const (
 )
 
 var (
-	// Text representation of log levels
-	severityToString = [...]string{
+	// Guards severityToString and stringToSeverity, which RegisterSeverity extends.
+	severityMu sync.RWMutex
+	// Text representation of log levels, indexed by level. Unregistered custom levels are empty.
+	severityToString = []string{
 		"Invalid", "EMERG", "ALERT", "CRIT", "ERROR", "WARN", "NOTIC", "INFO", "DEBUG",
 	}
 	stringToSeverity = map[string]int{
@@ -36,28 +42,111 @@ var (
 		severityToString[Info]:      Info,
 		severityToString[Debug]:     Debug,
 	}
+	// Common names of the levels, e.g. in a config file, mapped to the nearest level.
+	// A registered custom level of the same name, e.g. TRACE, takes precedence.
+	severityAliases = map[string]int{
+		"EMERGENCY":     Emergency,
+		"PANIC":         Emergency,
+		"CRITICAL":      Critical,
+		"FATAL":         Critical,
+		"ERR":           Error,
+		"WARNING":       Warning,
+		"NOTICE":        Notice,
+		"INFORMATION":   Info,
+		"INFORMATIONAL": Info,
+		"TRACE":         Debug,
+		"VERBOSE":       Debug,
+	}
 )
 
+// Register a custom severity level, below Debug, e.g. RegisterSeverity("TRACE", Debug+1).
+// The level must be greater than Debug, and the name, which is converted to uppercase, must not
+// be empty. Neither may already be registered. Events at the level are logged with LogEvent,
+// when the filter is at or above the level, e.g. SetFilter(Debug+1).
+// Returns InvalidArgumentError if the name or level is not valid. This is goroutine safe.
+func RegisterSeverity(name string, level Severity) error {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	severityMu.Lock()
+	defer severityMu.Unlock()
+
+	if name == "" || level <= SeverityMaxLevel {
+		return InvalidArgumentError
+	}
+	if _, exists := stringToSeverity[name]; exists {
+		return InvalidArgumentError
+	}
+	if int(level) < len(severityToString) && severityToString[level] != "" {
+		return InvalidArgumentError
+	}
+	for len(severityToString) <= int(level) {
+		severityToString = append(severityToString, "")
+	}
+	severityToString[level] = name
+	stringToSeverity[name] = int(level)
+	return nil
+}
+
+// Returns true if the Severity is a level from Emergency to Debug, or a registered custom level.
+func (s Severity) isValid() bool {
+	severityMu.RLock()
+	defer severityMu.RUnlock()
+	return s >= SeverityMinLevel && int(s) < len(severityToString) && severityToString[s] != ""
+}
 
 // Returns the string representation of a Severity value.
-// Returns true if valid, else false.
+// InvalidSeverity is "Invalid", and any other unknown value is e.g. "UNKNOWN(100)".
 func (s Severity) String() string {
+	severityMu.RLock()
+	defer severityMu.RUnlock()
+	switch {
+	case s == InvalidSeverity:
+		return severityToString[0]
+	case s < 0 || int(s) >= len(severityToString) || severityToString[s] == "":
+		return fmt.Sprintf("UNKNOWN(%d)", s)
+	}
 	return severityToString[s]
 }
 
-// Validates if a string represents a severity level.
+// Returns the syslog severity code of the Severity, from Emergency (0) to Debug (7).
+// Custom levels below Debug are Debug. Returns -1 if the Severity is not valid.
+func (s Severity) SyslogPriority() int {
+	if !s.isValid() {
+		return -1
+	}
+	if s > SeverityMaxLevel {
+		s = SeverityMaxLevel
+	}
+	return int(s - Emergency)
+}
+
+// Returns the syslog PRI value of a facility (0-23), e.g. 16 for local0, and a Severity.
+// Returns -1 if the facility or Severity is not valid.
+func ComputePRI(facility int, s Severity) int {
+	sev := s.SyslogPriority()
+	if facility < 0 || facility > 23 || sev < 0 {
+		return -1
+	}
+	return facility*8 + sev
+}
+
+// Validates if a string represents a severity level, or an alias of one.
 func IsValidSeverity(s string) bool {
-	_, valid := stringToSeverity[strings.ToUpper(s)]
-	return valid
+	return StringToSeverity(s) != InvalidSeverity
 }
 
-// Translates a text string to a Severity.
+// Translates a text string to a Severity. The text is case insensitive, and may be a level
+// name, e.g. "WARN", or a common alias, e.g. "warning", "Information" or "err".
 // If the text string is not valid, returns InvalidSeverity
 func StringToSeverity(s string) Severity {
-	v, valid := stringToSeverity[strings.ToUpper(s)]
-	if !valid {
-		return InvalidSeverity
+	s = strings.ToUpper(strings.TrimSpace(s))
+	severityMu.RLock()
+	defer severityMu.RUnlock()
+	if v, valid := stringToSeverity[s]; valid {
+		return Severity(v)
+	}
+	if v, valid := severityAliases[s]; valid {
+		return Severity(v)
 	}
-	return Severity(v)
+	return InvalidSeverity
 }
 
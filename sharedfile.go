@@ -0,0 +1,115 @@
+// Shared Files
+// LogFiles that open the same file with the same flags, e.g. two File loggers with the same name,
+// share one *os.File, rather than each holding a handle. Writes to the shared file are
+// serialized, and each event is written with a single Write, so lines from different LogFiles
+// are never interleaved. The file is closed when the last LogFile closes it.
+//
+// Atomicity: within a process, each event is written whole. Across processes, O_APPEND writes
+// of at most PIPE_BUF bytes (4096 on Linux) are atomic on local filesystems; longer events, or
+// network filesystems, may interleave. Gzip files are not shared.
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	// Open shared files, by absolute file name.
+	sharedFilesMu sync.Mutex
+	sharedFiles   = make(map[string]*sharedFile)
+)
+
+// A file shared by LogFiles, with a reference count.
+type sharedFile struct {
+	*os.File
+	key   string
+	flags int
+	refs  int
+	// Serializes writes.
+	mu sync.Mutex
+}
+
+// The reference of a LogFile to a shared file. Closing it twice releases one reference.
+// The caller must synchronize access, e.g. with the LogFile lock.
+type sharedHandle struct {
+	*sharedFile
+	closed bool
+}
+
+// Open the file, or share it, if it is already open with the same flags.
+// A file that is open with other flags, e.g. O_DSYNC, is opened separately, and not shared.
+// A file that was renamed or removed is not shared, so a reopen opens the new file.
+func openSharedFile(name string, flags int, mode os.FileMode) (*sharedHandle, error) {
+	key, err := filepath.Abs(name)
+	if err != nil {
+		key = name
+	}
+	sharedFilesMu.Lock()
+	defer sharedFilesMu.Unlock()
+
+	if sf, ok := sharedFiles[key]; ok && sf.flags == flags && sf.isCurrent(name) {
+		sf.refs++
+		return &sharedHandle{sharedFile: sf}, nil
+	}
+	f, err := osOpenFile(name, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	sf := &sharedFile{File: f, key: key, flags: flags, refs: 1}
+	if old, ok := sharedFiles[key]; !ok || !old.isCurrent(name) {
+		sharedFiles[key] = sf
+	}
+	return &sharedHandle{sharedFile: sf}, nil
+}
+
+// Returns true if the open file is still the file of the name, i.e. it was not renamed or
+// removed, e.g. by logrotate.
+func (sf *sharedFile) isCurrent(name string) bool {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+	open, err := sf.File.Stat()
+	return err == nil && os.SameFile(fi, open)
+}
+
+// Write p with a single write. This implements the io.Writer interface
+// Returns os.ErrClosed after Close.
+func (sh *sharedHandle) Write(p []byte) (int, error) {
+	if sh.closed {
+		return 0, os.ErrClosed
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.File.Write(p)
+}
+
+// Sync the file to storage. Returns os.ErrClosed after Close.
+func (sh *sharedHandle) Sync() error {
+	if sh.closed {
+		return os.ErrClosed
+	}
+	return sh.File.Sync()
+}
+
+// Release the reference, and close the file after the last one. This implements the io.Closer interface
+// Returns os.ErrClosed if it is already closed.
+func (sh *sharedHandle) Close() error {
+	if sh.closed {
+		return os.ErrClosed
+	}
+	sh.closed = true
+	sf := sh.sharedFile
+
+	sharedFilesMu.Lock()
+	defer sharedFilesMu.Unlock()
+	if sf.refs--; sf.refs > 0 {
+		return nil
+	}
+	if sharedFiles[sf.key] == sf {
+		delete(sharedFiles, sf.key)
+	}
+	return sf.File.Close()
+}
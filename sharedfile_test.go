@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestFile_Shared(t *testing.T) {
+	testName := "TestFile_Shared"
+	l1, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	l2, err := File(testName)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; \"%s\"\n", err, testName))
+	name := l1.LogFilename()
+	defer os.Remove(name)
+	gotestutil.AssertTrue(t, l1.f.(*sharedHandle).sharedFile == l2.f.(*sharedHandle).sharedFile,
+		GetCaller()+" Expected one shared file")
+
+	// Long lines from both files are not interleaved.
+	const writers, lines = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := l1
+			if i%2 == 1 {
+				l = l2
+			}
+			line := strings.Repeat(string(rune('a'+i)), 10000)
+			for j := 0; j < lines; j++ {
+				l.Write([]byte(line))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The file stays open until the last LogFile closes it, even if one is closed twice.
+	l1.Close()
+	l1.Close()
+	_, err = l1.Write([]byte("closed"))
+	gotestutil.AssertNotNil(t, err, GetCaller()+" Expected a closed error")
+	_, err = l2.Write([]byte("last"))
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected the shared file open")
+	l2.Close()
+	sharedFilesMu.Lock()
+	_, open := sharedFiles[l2.f.(*sharedHandle).key]
+	sharedFilesMu.Unlock()
+	gotestutil.AssertFalse(t, open, GetCaller()+" Expected the shared file released")
+
+	f, err := os.Open(name)
+	gotestutil.AssertNil(t, err, GetCaller()+" Error opening "+name)
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	var count int
+	for s.Scan() {
+		if line := s.Text(); line != "last" {
+			gotestutil.AssertEqual(t, strings.Repeat(line[:1], 10000), line, GetCaller()+" Expected a whole line")
+		}
+		count++
+	}
+	gotestutil.AssertEqual(t, writers*lines+1, count, GetCaller()+" Line count of "+name)
+}
@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Implements a LogWriter for a stream such as os.Stderr. Each message is written as a line.
+// Close does not close the stream.
+type StreamWriter struct {
+	w io.Writer
+	sync.Mutex
+}
+
+// Creates a LogWriter that writes to the standard error stream.
+func Stderr() *StreamWriter {
+	return &StreamWriter{w: os.Stderr}
+}
+
+// Write a message as a line. This implements the io.Writer interface
+// This is goroutine safe.
+func (sw *StreamWriter) Write(p []byte) (n int, err error) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		p = append(p[:len(p):len(p)], '\n')
+	}
+	return sw.w.Write(p)
+}
+
+// Close is a no-op, so the stream stays open. This implements the io.Closer interface
+func (sw *StreamWriter) Close() error {
+	return nil
+}
+
+// Implements a LogWriter that discards every message.
+type discardWriter struct{}
+
+// Creates a LogWriter that discards every message, e.g. to construct a LogManger in tests
+// without touching the filesystem, or to mute a logger with ReplaceLogger.
+func DiscardWriter() LogWriter {
+	return discardWriter{}
+}
+
+// Discard the message. This implements the io.Writer interface
+func (discardWriter) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+// Close is a no-op. This implements the io.Closer interface
+func (discardWriter) Close() error {
+	return nil
+}
+
+// Implements a LogWriter that writes each message to several LogWriters.
+type multiWriter struct {
+	ws []LogWriter
+}
+
+// Creates a LogWriter that writes each message to each of the writers, in order, e.g. to pass
+// one io.WriteCloser to a library that takes a single sink. With a Log, prefer AddLogger, which
+// also supports a filter and formatter per writer.
+func MultiWriter(ws ...LogWriter) LogWriter {
+	return &multiWriter{ws: append([]LogWriter(nil), ws...)}
+}
+
+// Write the message to each writer. This implements the io.Writer interface
+// A failed writer does not stop the others. Returns the first error, if any.
+func (mw *multiWriter) Write(p []byte) (n int, err error) {
+	for _, w := range mw.ws {
+		if _, wErr := w.Write(p); wErr != nil && err == nil {
+			err = wErr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush each writer that buffers output. This implements the Flusher interface
+// Returns the first error, if any.
+func (mw *multiWriter) Flush() (err error) {
+	for _, w := range mw.ws {
+		if f, ok := w.(Flusher); ok {
+			if fErr := f.Flush(); fErr != nil && err == nil {
+				err = fErr
+			}
+		}
+	}
+	return
+}
+
+// Close each writer. This implements the io.Closer interface
+// A failed writer does not stop the others. Returns the errors joined, if any.
+func (mw *multiWriter) Close() error {
+	var errs []error
+	for _, w := range mw.ws {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,160 @@
+// Syslog Writer
+// A syslog writer sends each formatted message to a remote syslog collector, as a UDP datagram,
+// or a newline terminated line over TCP. It can be used with any formatter.
+//
+// If the collector cannot be reached, at construction or after a write fails, messages are
+// buffered (up to syslogMaxBuffered, dropping the oldest), and the writer reconnects on a later
+// write, with a backoff between attempts that doubles up to syslogMaxBackoff. Buffered messages
+// are sent, in order, once it reconnects.
+//
+// Example:
+//
+//	w, err := logger.SyslogWriter("udp", "logs.example.com:514")
+//	l := logger.LogManger("MyApp", w)
+package logger
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	syslogDialTimeout  = 5 * time.Second
+	syslogMinBackoff   = 100 * time.Millisecond
+	syslogMaxBackoff   = 30 * time.Second
+	syslogMaxBuffered  = 1000
+	syslogMaxUDPLength = 64 * 1024
+)
+
+var (
+	// Dials the collector. Replaced in tests.
+	syslogDial = func(network, addr string) (net.Conn, error) {
+		return net.DialTimeout(network, addr, syslogDialTimeout)
+	}
+)
+
+// Implements a LogWriter for a remote syslog collector.
+type syslogWriter struct {
+	network  string
+	addr     string
+	stream   bool // TCP, so messages are newline terminated.
+	conn     net.Conn
+	buffered [][]byte
+	backoff  time.Duration
+	nextDial time.Time
+	sync.Mutex
+}
+
+// Create a writer that sends messages to the syslog collector at addr, e.g. "host:514".
+// The network is "udp" or "tcp" (or the "4" and "6" variants).
+// If the collector cannot be reached, the writer is still returned, and messages are buffered
+// until it connects. Returns InvalidArgumentError for another network.
+func SyslogWriter(network, addr string) (LogWriter, error) {
+	sw := &syslogWriter{network: network, addr: addr}
+	switch network {
+	case "udp", "udp4", "udp6":
+	case "tcp", "tcp4", "tcp6":
+		sw.stream = true
+	default:
+		return nil, InvalidArgumentError
+	}
+
+	sw.Lock()
+	defer sw.Unlock()
+	sw.dial()
+	return sw, nil
+}
+
+// Write a message to the collector. This implements the io.Writer interface
+// If the message cannot be sent, it is buffered, and sent after reconnecting.
+// This is goroutine safe.
+func (sw *syslogWriter) Write(p []byte) (n int, err error) {
+	sw.Lock()
+	defer sw.Unlock()
+
+	msg := append([]byte(nil), p...)
+	if sw.stream && (len(msg) == 0 || msg[len(msg)-1] != '\n') {
+		msg = append(msg, '\n')
+	} else if !sw.stream && len(msg) > syslogMaxUDPLength {
+		msg = msg[:syslogMaxUDPLength]
+	}
+	sw.buffer(msg)
+
+	if sw.conn == nil && !now().Before(sw.nextDial) {
+		sw.dial()
+	}
+	sw.send()
+	return len(p), nil
+}
+
+// Close the connection, after trying to send any buffered messages. This implements the io.Closer interface
+// This is goroutine safe.
+func (sw *syslogWriter) Close() error {
+	sw.Lock()
+	defer sw.Unlock()
+
+	if sw.conn == nil {
+		if len(sw.buffered) > 0 {
+			internalf("%s: %d messages not sent to %s", GetCaller(), len(sw.buffered), sw.addr)
+		}
+		return nil
+	}
+	sw.send()
+	err := sw.conn.Close()
+	sw.conn = nil
+	return err
+}
+
+// Add a message to the buffer, dropping the oldest if it is full.
+// The caller must synchronize access.
+func (sw *syslogWriter) buffer(msg []byte) {
+	if len(sw.buffered) >= syslogMaxBuffered {
+		sw.buffered = sw.buffered[1:]
+	}
+	sw.buffered = append(sw.buffered, msg)
+}
+
+// Connect to the collector. On failure, schedules the next attempt after the backoff.
+// The caller must synchronize access.
+func (sw *syslogWriter) dial() {
+	conn, err := syslogDial(sw.network, sw.addr)
+	if err != nil {
+		sw.fail(err)
+		return
+	}
+	sw.conn = conn
+	sw.backoff = 0
+}
+
+// Send the buffered messages, in order. On failure, the connection is closed, and the unsent
+// messages stay buffered.
+// The caller must synchronize access.
+func (sw *syslogWriter) send() {
+	if sw.conn == nil {
+		return
+	}
+	for len(sw.buffered) > 0 {
+		if _, err := sw.conn.Write(sw.buffered[0]); err != nil {
+			sw.conn.Close()
+			sw.conn = nil
+			sw.fail(err)
+			return
+		}
+		sw.buffered = sw.buffered[1:]
+	}
+	sw.buffered = nil
+}
+
+// Double the backoff, and schedule the next connection attempt.
+// The caller must synchronize access.
+func (sw *syslogWriter) fail(err error) {
+	sw.backoff *= 2
+	if sw.backoff < syslogMinBackoff {
+		sw.backoff = syslogMinBackoff
+	} else if sw.backoff > syslogMaxBackoff {
+		sw.backoff = syslogMaxBackoff
+	}
+	sw.nextDial = now().Add(sw.backoff)
+	internalf("%s: (\"%s\") %s. Retry in %s.", GetCaller(), sw.addr, err, sw.backoff)
+}
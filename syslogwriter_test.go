@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	testName := "TestSyslogWriter"
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	gotestutil.AssertNil(t, err, GetCaller()+" Error listening")
+	defer pc.Close()
+
+	w, err := SyslogWriter("udp", pc.LocalAddr().String())
+	gotestutil.AssertNil(t, err, GetCaller()+" Error creating the writer")
+	l := LogManger(testName, w)
+	l.SetFormatter(&spyFormatter{})
+	defer l.Close()
+
+	for _, s := range []string{"first datagram", "second datagram"} {
+		l.Info(testName, s, nil)
+		buf := make([]byte, 1024)
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		gotestutil.AssertNil(t, err, GetCaller()+" Error reading a datagram")
+		gotestutil.AssertEqual(t, s, string(buf[:n]), GetCaller()+" Expected a datagram per message")
+	}
+
+	_, err = SyslogWriter("unix", "/dev/log")
+	gotestutil.AssertEqual(t, InvalidArgumentError, err, GetCaller()+" Expected an invalid network error")
+}
+
+func TestSyslogWriter_Reconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	gotestutil.AssertNil(t, err, GetCaller()+" Error listening")
+	defer ln.Close()
+
+	clock := time.Now()
+	down := true
+	defer func() {
+		now = time.Now
+		syslogDial = func(network, addr string) (net.Conn, error) {
+			return net.DialTimeout(network, addr, syslogDialTimeout)
+		}
+	}()
+	now = func() time.Time {
+		return clock
+	}
+	syslogDial = func(network, addr string) (net.Conn, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return net.Dial(network, addr)
+	}
+
+	// The collector is down at construction, so messages are buffered.
+	w, err := SyslogWriter("tcp", ln.Addr().String())
+	gotestutil.AssertNil(t, err, GetCaller()+" Expected a writer while the collector is down")
+	defer w.Close()
+	w.Write([]byte("line 1"))
+	// After the backoff, the next write fails to reconnect, and the backoff doubles.
+	clock = clock.Add(syslogMinBackoff)
+	w.Write([]byte("line 2"))
+	down = false
+	clock = clock.Add(syslogMinBackoff)
+	w.Write([]byte("line 3"))
+	gotestutil.AssertEqual(t, 3, len(w.(*syslogWriter).buffered), GetCaller()+" Expected buffered lines")
+
+	// After the doubled backoff, the next write reconnects, and sends the buffered messages in order.
+	clock = clock.Add(syslogMinBackoff)
+	w.Write([]byte("line 4"))
+	gotestutil.AssertEqual(t, 0, len(w.(*syslogWriter).buffered), GetCaller()+" Expected the buffer sent")
+
+	conn, err := ln.Accept()
+	gotestutil.AssertNil(t, err, GetCaller()+" Error accepting")
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	var lines []string
+	for i := 0; i < 4; i++ {
+		s, err := r.ReadString('\n')
+		gotestutil.AssertNil(t, err, GetCaller()+" Error reading a line")
+		lines = append(lines, strings.TrimSuffix(s, "\n"))
+	}
+	gotestutil.AssertEqual(t, []string{"line 1", "line 2", "line 3", "line 4"}, lines, GetCaller()+" Expected lines in order")
+}
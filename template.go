@@ -0,0 +1,72 @@
+// Template Formatter
+// A template formatter formats events with a text/template, for output that the other formatters
+// do not cover. The template is parsed once, and executed with the EventMsg of each event, so
+// its fields are available as .Timestamp, .Sev, .Hostname, .Appname, .Pid, .MsgId, .Msg and
+// .Params. A missing param is empty, e.g. {{.Params.user_id}}.
+//
+// Besides the text/template builtins, the template may call:
+//
+//	time    the timestamp with a time.Format layout, or TimeFormatUnix, e.g. {{time .Timestamp "15:04:05"}}
+//	upper   the string in upper case
+//	lower   the string in lower case
+//	quote   the string quoted, if it has spaces, quotes or "=", as in Logfmt
+//
+// Example:
+//
+//	tf, err := logger.Template(`{{time .Timestamp "2006-01-02 15:04:05"}} [{{.Sev}}] {{.Msg}}` +
+//	    `{{range $k, $v := .Params}} {{$k}}={{quote $v}}{{end}}`)
+package logger
+
+import (
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Functions available to a template.
+var templateFuncs = template.FuncMap{
+	"time": func(t time.Time, layout string) string {
+		return formatTimestamp(t, layout)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"quote": func(v string) string {
+		if logfmtNeedsQuote(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	},
+}
+
+// Formats events with a text/template. See Template.
+type TemplateFormatter struct {
+	name string
+	tmpl *template.Template
+}
+
+// Create a new template event message formatter. The text is parsed once, and executed for
+// each event with the EventMsg.
+// Returns the error, if the text is not a valid template.
+func Template(text string) (EventFormatter, error) {
+	tmpl, err := template.New("event").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateFormatter{name: "template", tmpl: tmpl}, nil
+}
+
+// Returns the name of the formatter
+func (tf *TemplateFormatter) Name() string {
+	return tf.name
+}
+
+// Implements EventFormatter interface.
+// Returns the error, if the template fails to execute, e.g. it refers to a field that does not exist.
+func (tf *TemplateFormatter) Format(em EventMsg) (msg string, err error) {
+	var b strings.Builder
+	if err = tf.tmpl.Execute(&b, em); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,170 @@
+// Watch Config
+// A Log can be reconfigured without a restart by editing a small JSON config file, e.g.
+//
+//	{
+//	    "level": "INFO",
+//	    "format": "json",
+//	    "rules": [
+//	        {"msg_id": "PAYMENT", "level": "DEBUG"},
+//	        {"param_key": "component", "param_value": "db", "level": "WARN"}
+//	    ]
+//	}
+//
+// The file is polled for changes. A changed config is applied as a whole, and what changed is
+// logged. An invalid config is rejected with a warning, and the previous config is retained.
+// Omitted fields keep their current value, except rules, which are replaced when present.
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// How often a watched config file is checked for changes.
+	configPollInterval = 2 * time.Second
+
+	// Formatter constructors by name, for configuration.
+	formatterByName = map[string]func() EventFormatter{
+		"json": func() EventFormatter {
+			return Json()
+		},
+		"plain_text": func() EventFormatter {
+			return PlainText()
+		},
+		"logfmt": Logfmt,
+		"apache_common": func() EventFormatter {
+			return Apache(false)
+		},
+		"apache_combined": func() EventFormatter {
+			return Apache(true)
+		},
+		"console": func() EventFormatter {
+			return Console()
+		},
+		"gelf": GELF,
+		"xml":  XML,
+	}
+)
+
+// The JSON config file read by WatchConfig
+type watchedConfig struct {
+	Level  string               `json:"level"`
+	Format string               `json:"format"`
+	Rules  *[]watchedFilterRule `json:"rules"`
+}
+
+// A FilterRule in the JSON config file
+type watchedFilterRule struct {
+	Appname    string `json:"appname"`
+	MsgId      string `json:"msg_id"`
+	ParamKey   string `json:"param_key"`
+	ParamValue string `json:"param_value"`
+	Level      string `json:"level"`
+}
+
+// Load the config file at path, and watch it for changes.
+// If the initial config cannot be read or is invalid, an error is returned, and the file is
+// not watched. Call the returned stop function to stop watching. It may be called more than once.
+func (l *Log) WatchConfig(path string) (stop func(), err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.loadConfig(path); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(configPollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+			}
+			nfi, sErr := os.Stat(path)
+			if sErr != nil || (nfi.ModTime().Equal(fi.ModTime()) && nfi.Size() == fi.Size()) {
+				continue
+			}
+			fi = nfi
+			if lErr := l.loadConfig(path); lErr != nil {
+				l.Warning("CONFIG", "Invalid config ignored. Previous config retained.",
+					map[string]string{"file": path, "error": lErr.Error()})
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}, nil
+}
+
+// Read, validate, and apply a config file. Logs the changes.
+// Nothing is applied if the config is invalid.
+func (l *Log) loadConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var wc watchedConfig
+	if err = json.Unmarshal(b, &wc); err != nil {
+		return err
+	}
+
+	// Validate everything before applying anything.
+	filter := l.GetFilter()
+	if wc.Level != "" {
+		if filter = StringToSeverity(wc.Level); filter == InvalidSeverity {
+			return fmt.Errorf("invalid level \"%s\"", wc.Level)
+		}
+	}
+	var newFormatter func() EventFormatter
+	if wc.Format != "" {
+		if newFormatter = formatterByName[strings.ToLower(wc.Format)]; newFormatter == nil {
+			return fmt.Errorf("invalid format \"%s\"", wc.Format)
+		}
+	}
+	var rules []FilterRule
+	if wc.Rules != nil {
+		for _, r := range *wc.Rules {
+			sev := StringToSeverity(r.Level)
+			if sev == InvalidSeverity {
+				return fmt.Errorf("invalid rule level \"%s\"", r.Level)
+			}
+			rules = append(rules, FilterRule{Appname: r.Appname, MsgId: r.MsgId,
+				ParamKey: r.ParamKey, ParamValue: r.ParamValue, Threshold: sev})
+		}
+	}
+
+	changes := map[string]string{"file": path}
+	if old := l.GetFilter(); filter != old {
+		changes["level"] = old.String() + " -> " + filter.String()
+		l.SetFilter(filter)
+	}
+	if newFormatter != nil {
+		ef := newFormatter()
+		if from, to := formatterName(l.getFormatter()), formatterName(ef); from != to {
+			changes["format"] = from + " -> " + to
+			l.SetFormatter(ef)
+		}
+	}
+	if wc.Rules != nil {
+		changes["rules"] = fmt.Sprintf("%d -> %d", len(l.rules()), len(rules))
+		// Validated above, so this does not fail.
+		l.SetFilterRules(rules)
+	}
+	if len(changes) > 1 {
+		l.Notice("CONFIG", "Config changed", changes)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package logger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mooredwightd/gotestutil"
+)
+
+// Write a config file, with a modification time in the future so the change is detected.
+func writeConfig(t *testing.T, path string, cfg string, mtime time.Time) {
+	err := ioutil.WriteFile(path, []byte(cfg), 0660)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s; File: \"%s\"\n", err, path))
+	os.Chtimes(path, mtime, mtime)
+}
+
+// Wait until cond is true, or a timeout.
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestLog_WatchConfig(t *testing.T) {
+	testName := "TestLog_WatchConfig"
+	path := testName + ".json"
+	defer os.Remove(path)
+	defer func(d time.Duration) {
+		configPollInterval = d
+	}(configPollInterval)
+	configPollInterval = 10 * time.Millisecond
+
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	now := time.Now()
+
+	writeConfig(t, path, `{"level": "WARN", "rules": [{"msg_id": "PAYMENT", "level": "DEBUG"}]}`, now)
+	stop, err := l.WatchConfig(path)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	// Stopping twice does not panic.
+	defer stop()
+	defer stop()
+	gotestutil.AssertEqual(t, Severity(Warning), l.GetFilter(), "Expected the initial level")
+	gotestutil.AssertEqual(t, 1, len(l.GetFilterRules()), "Expected the initial rules")
+
+	writeConfig(t, path, `{"level": "debug", "format": "plain_text"}`, now.Add(time.Second))
+	// The change is logged after it is applied
+	ok := waitFor(func() bool {
+		return len(tw.Lines()) == 1
+	})
+	gotestutil.AssertTrue(t, ok, "Expected the change logged")
+	gotestutil.AssertEqual(t, Severity(Debug), l.GetFilter(), "Expected the level to change to DEBUG")
+	gotestutil.AssertEqual(t, "plain_text", formatterName(l.getFormatter()), "Expected the format to change")
+	gotestutil.AssertEqual(t, 1, len(l.GetFilterRules()), "Expected the rules retained")
+
+	gotestutil.AssertTrue(t, strings.Contains(tw.Lines()[0], "WARN -> DEBUG"), "Expected the change logged")
+
+	writeConfig(t, path, `{"level": "LOUD"}`, now.Add(2*time.Second))
+	ok = waitFor(func() bool {
+		return len(tw.Lines()) == 2
+	})
+	gotestutil.AssertTrue(t, ok, "Expected a warning for the invalid config")
+	gotestutil.AssertTrue(t, strings.Contains(tw.Lines()[1], "Invalid config"), "Expected a warning")
+	gotestutil.AssertEqual(t, Severity(Debug), l.GetFilter(), "Expected the previous level retained")
+
+	_, err = l.WatchConfig(testName + ".missing.json")
+	gotestutil.AssertNotNil(t, err, "Expected an error for a missing config")
+	writeConfig(t, path, `{"format": "yaml"}`, now.Add(3*time.Second))
+	_, err = l.WatchConfig(path)
+	gotestutil.AssertNotNil(t, err, "Expected an error for an invalid config")
+}
+
+// Run with -race. Reloads the config while several goroutines log.
+func TestLog_WatchConfigConcurrent(t *testing.T) {
+	testName := "TestLog_WatchConfigConcurrent"
+	path := testName + ".json"
+	defer os.Remove(path)
+	defer func(d time.Duration) {
+		configPollInterval = d
+	}(configPollInterval)
+	configPollInterval = time.Millisecond
+
+	tw := &testWriter{}
+	l := LogManger(testName, tw)
+	now := time.Now()
+	writeConfig(t, path, `{"format": "json"}`, now)
+	stop, err := l.WatchConfig(path)
+	gotestutil.AssertNil(t, err, fmt.Sprintf("%s\n", err))
+	defer stop()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					l.Info("PAYMENT", "event", nil)
+					l.With(map[string]string{"child": "true"}).Debug(testName, "child", nil)
+				}
+			}
+		}()
+	}
+	configs := []string{
+		`{"level": "WARN", "format": "plain_text", "rules": [{"msg_id": "PAYMENT", "level": "DEBUG"}]}`,
+		`{"level": "DEBUG", "format": "logfmt", "rules": []}`,
+	}
+	formats := []string{"plain_text", "logfmt"}
+	for i := 1; i <= 10; i++ {
+		writeConfig(t, path, configs[i%2], now.Add(time.Duration(i)*time.Second))
+		ok := waitFor(func() bool {
+			return formatterName(l.getFormatter()) == formats[i%2] && len(l.GetFilterRules()) == 1-i%2
+		})
+		gotestutil.AssertTrue(t, ok, fmt.Sprintf("Expected config %d applied", i))
+	}
+	close(done)
+	wg.Wait()
+	gotestutil.AssertEqual(t, "plain_text", formatterName(l.getFormatter()), "Expected the last format")
+}
@@ -0,0 +1,91 @@
+// XML Formatter
+// An XML formatter formats each event as an <event> element, for pipelines that ingest XML, e.g.
+//
+//	<event><timestamp>2017-03-04T05:06:07.008Z</timestamp><severity>ERROR</severity>
+//	<hostname>web1</hostname><appname>shop</appname><pid>42</pid><msg_id>DB_CONN</msg_id>
+//	<message>connection refused</message><params><param name="host">db1</param></params></event>
+//
+// Each event is a standalone fragment on one line, with no XML declaration, or root element, so
+// log files stay line-oriented, and can be rotated, tailed and split by line. A consumer that
+// needs a well-formed document wraps the lines in a root element, e.g. <events>...</events>.
+//
+// Text is escaped by encoding/xml, including line breaks, so a message never spans lines.
+// Characters that XML does not allow, e.g. NUL, are replaced with U+FFFD. Params are sorted by
+// name, and the <params> element is omitted if there are none.
+package logger
+
+import (
+	"encoding/xml"
+	"sort"
+	"time"
+)
+
+// XMLFormatter formats events as XML fragments. See XML.
+type XMLFormatter struct {
+	name string
+}
+
+// The element marshalled by the XMLFormatter.
+type xmlEvent struct {
+	XMLName   xml.Name   `xml:"event"`
+	Timestamp string     `xml:"timestamp"`
+	Sev       string     `xml:"severity"`
+	Hostname  string     `xml:"hostname"`
+	Appname   string     `xml:"appname"`
+	Pid       int        `xml:"pid"`
+	MsgId     string     `xml:"msg_id"`
+	Msg       string     `xml:"message"`
+	Params    *xmlParams `xml:"params,omitempty"`
+}
+
+// The <params> element.
+type xmlParams struct {
+	Param []xmlParam `xml:"param"`
+}
+
+// A <param name="..">value</param> element.
+type xmlParam struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Create a new XML event message formatter.
+// Returns an EventFormatter interface.
+func XML() EventFormatter {
+	return &XMLFormatter{name: "xml"}
+}
+
+// Returns the name of the formatter
+func (xf *XMLFormatter) Name() string {
+	return xf.name
+}
+
+// Implements EventFormatter interface.
+func (xf *XMLFormatter) Format(em EventMsg) (msg string, err error) {
+	rec := xmlEvent{
+		Timestamp: em.Timestamp.Format(time.RFC3339Nano),
+		Sev:       em.Sev,
+		Hostname:  em.Hostname,
+		Appname:   em.Appname,
+		Pid:       em.Pid,
+		MsgId:     em.MsgId,
+		Msg:       em.Msg,
+	}
+	if len(em.Params) > 0 {
+		ps := make([]xmlParam, 0, len(em.Params))
+		for k, v := range em.Params {
+			ps = append(ps, xmlParam{Name: k, Value: v})
+		}
+		sort.Slice(ps, func(i, j int) bool {
+			return ps[i].Name < ps[j].Name
+		})
+		rec.Params = &xmlParams{Param: ps}
+	}
+
+	b, xErr := xml.Marshal(rec)
+	if xErr != nil {
+		internalf("XML error: %s (%+v)\n", xErr, em)
+		return "", xErr
+	}
+	return string(b), nil
+}